@@ -0,0 +1,119 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the payment provider while it is considered down
+var ErrCircuitOpen = errors.New("payment provider circuit is open")
+
+// CircuitState is the state of the circuit breaker guarding calls to the payment provider
+type CircuitState string
+
+const (
+	// CircuitClosed lets every call through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen fails every call fast until the cooldown has passed
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single probe call through to find out whether the provider is back
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// circuitBreaker opens after threshold consecutive failed calls and stays open for cooldown. A nil breaker is
+// disabled and lets every call through.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newCircuitBreaker returns nil, a disabled breaker, when threshold is not positive
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// state must be called with mu held
+func (b *circuitBreaker) state() CircuitState {
+	switch {
+	case b.failures < b.threshold:
+		return CircuitClosed
+	case b.probing || b.now().Sub(b.openedAt) >= b.cooldown:
+		return CircuitHalfOpen
+	}
+	return CircuitOpen
+}
+
+// State reports the current state of the breaker
+func (b *circuitBreaker) State() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state()
+}
+
+// allow returns ErrCircuitOpen when a call must not be made. Once the cooldown has passed a single call is let
+// through and every other call keeps failing until done has been called for it.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state() {
+	case CircuitClosed:
+		return nil
+	case CircuitHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return nil
+		}
+	}
+	return ErrCircuitOpen
+}
+
+// done records the outcome of a call that allow let through
+func (b *circuitBreaker) done(failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+	}
+}
+
+// release gives up a call that allow let through without recording an outcome, e.g. when the caller went away
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
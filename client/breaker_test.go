@@ -0,0 +1,56 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CircuitBreaker(t *testing.T) {
+	t.Run("Test nil breaker lets every call through", func(t *testing.T) {
+		breaker := newCircuitBreaker(0, time.Minute)
+		assert.Nil(t, breaker)
+
+		breaker.done(true)
+		assert.NoError(t, breaker.allow())
+		assert.Equal(t, CircuitClosed, breaker.State())
+	})
+
+	t.Run("Test half open circuit lets a single probe through", func(t *testing.T) {
+		now := time.Now()
+		breaker := newCircuitBreaker(1, time.Minute)
+		breaker.now = func() time.Time { return now }
+
+		assert.NoError(t, breaker.allow())
+		breaker.done(true)
+		assert.Equal(t, CircuitOpen, breaker.State())
+		assert.ErrorIs(t, breaker.allow(), ErrCircuitOpen)
+
+		now = now.Add(time.Minute)
+		assert.NoError(t, breaker.allow())
+		assert.ErrorIs(t, breaker.allow(), ErrCircuitOpen)
+
+		// a failed probe opens the circuit for another cooldown
+		breaker.done(true)
+		assert.Equal(t, CircuitOpen, breaker.State())
+
+		now = now.Add(time.Minute)
+		assert.NoError(t, breaker.allow())
+		breaker.done(false)
+		assert.Equal(t, CircuitClosed, breaker.State())
+	})
+
+	t.Run("Test released probe lets the next call through", func(t *testing.T) {
+		now := time.Now()
+		breaker := newCircuitBreaker(1, time.Minute)
+		breaker.now = func() time.Time { return now }
+
+		breaker.done(true)
+		now = now.Add(time.Minute)
+
+		assert.NoError(t, breaker.allow())
+		breaker.release()
+		assert.NoError(t, breaker.allow())
+	})
+}
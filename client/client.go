@@ -2,98 +2,196 @@ package client
 
 import (
 	"consumer-payment-service/environment"
+	"consumer-payment-service/logging"
+	"consumer-payment-service/models"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 
 	"github.com/go-resty/resty/v2"
 )
 
 //go:generate mockgen -source=client.go -destination=../mocks/client_mock.go -package=mocks
 type ThirdPartyAPIClient interface {
-	MakeDeposit(accountId, reference string, amount float64) (*PaymentResponse, error)
-	MakeWithdrawal(accountId, reference string, amount float64) (*PaymentResponse, error)
-	RetrieveTransaction(reference string) (*PaymentResponse, error)
+	MakeDeposit(ctx context.Context, accountId, reference string, amount models.Money) (*PaymentResponse, error)
+	MakeWithdrawal(ctx context.Context, accountId, reference string, amount models.Money) (*PaymentResponse, error)
+	RetrieveTransaction(ctx context.Context, reference string) (*PaymentResponse, error)
+	Ping(ctx context.Context) error
+	CircuitState() CircuitState
 }
 
+// idempotencyKeyHeader carries the payment reference on deposits and withdrawals so the provider applies a
+// retried request only once
+const idempotencyKeyHeader = "Idempotency-Key"
+
 type paymentAPIClient struct {
 	restClient *resty.Client
 	config     *environment.Config
+	breaker    *circuitBreaker
 }
 
 func NewPaymentAPIClient(config *environment.Config) ThirdPartyAPIClient {
-	restClient := resty.New()
-	restClient.SetDebug(true)
+	return NewPaymentAPIClientWithHTTPClient(config, &http.Client{})
+}
+
+// NewPaymentAPIClientWithHTTPClient returns a client that sends its requests through httpClient
+func NewPaymentAPIClientWithHTTPClient(config *environment.Config, httpClient *http.Client) ThirdPartyAPIClient {
+	restClient := resty.NewWithClient(httpClient)
+	if config.ProviderTimeout > 0 {
+		restClient.SetTimeout(config.ProviderTimeout)
+	}
+	if config.ProviderDebug {
+		enableDebug(restClient)
+	}
+
+	// resty backs off exponentially with jitter between attempts, only requests that are safe to repeat add
+	// retryOnFailure, every other request is sent once
+	restClient.
+		SetRetryCount(config.ProviderRetries).
+		SetRetryWaitTime(config.ProviderRetryWait).
+		SetRetryMaxWaitTime(config.ProviderRetryMaxWait).
+		AddRetryCondition(func(*resty.Response, error) bool { return false })
+
+	// let the provider correlate its logs with ours
+	restClient.OnBeforeRequest(func(c *resty.Client, r *resty.Request) error {
+		if id := logging.RequestID(r.Context()); id != "" {
+			r.SetHeader(logging.RequestIDHeader, id)
+		}
+		return nil
+	})
 	return &paymentAPIClient{
 		restClient: restClient,
 		config:     config,
+		breaker:    newCircuitBreaker(config.ProviderBreakerThreshold, config.ProviderBreakerCooldown),
+	}
+}
+
+// retryOnFailure retries calls that did not reach the provider or that it failed to handle
+func retryOnFailure(resp *resty.Response, err error) bool {
+	return err != nil || resp.StatusCode() >= http.StatusInternalServerError
+}
+
+// CircuitState reports whether calls to the provider are currently let through
+func (p *paymentAPIClient) CircuitState() CircuitState {
+	return p.breaker.State()
+}
+
+// execute sends request through the circuit breaker, failing fast while the provider is considered down. Error
+// responses below 500 mean the provider is up and do not count against it.
+func (p *paymentAPIClient) execute(request *resty.Request, method, url string) (*resty.Response, error) {
+	if err := p.breaker.allow(); err != nil {
+		return nil, err
 	}
+
+	resp, err := request.Execute(method, url)
+	switch {
+	case errors.Is(err, context.Canceled):
+		p.breaker.release()
+	default:
+		p.breaker.done(err != nil || resp.StatusCode() >= http.StatusInternalServerError)
+	}
+
+	return resp, err
 }
 
-func (p *paymentAPIClient) MakeDeposit(accountId, reference string, amount float64) (*PaymentResponse, error) {
+func (p *paymentAPIClient) MakeDeposit(ctx context.Context, accountId, reference string, amount models.Money) (*PaymentResponse, error) {
 	payload := PaymentRequest{
 		AccountId: accountId,
 		Reference: reference,
-		Amount:    amount,
+		Amount:    json.Number(amount.Decimal()),
 	}
 	url := fmt.Sprintf("%s/payments?type=credit", p.config.THIRD_PARTY_SERVICE_BASE_URL)
-	resp, err := p.restClient.
+	request := p.restClient.
 		R().
+		SetContext(ctx).
+		SetHeader(idempotencyKeyHeader, reference).
 		SetResult(&PaymentResponse{}).
 		SetError(&ErrorResponse{}).
 		SetBody(payload).
-		Post(url)
+		AddRetryCondition(retryOnFailure)
+	resp, err := p.execute(request, http.MethodPost, url)
 	if err != nil {
-		log.Printf("error making deposit %v", err)
+		logging.FromContext(ctx).Error("error making deposit", "reference", reference, "error", err)
 		return nil, err
 	}
 
 	if resp.IsError() {
-		return nil, fmt.Errorf("make deposit error occurred with httpCode: %d, message: %s ", resp.StatusCode(), resp.Body())
+		return nil, newProviderError(resp.StatusCode(), resp.Error(), resp.Body())
 	}
 
 	return resp.Result().(*PaymentResponse), nil
 }
 
-func (p *paymentAPIClient) MakeWithdrawal(accountId, reference string, amount float64) (*PaymentResponse, error) {
+func (p *paymentAPIClient) MakeWithdrawal(ctx context.Context, accountId, reference string, amount models.Money) (*PaymentResponse, error) {
 	payload := PaymentRequest{
 		AccountId: accountId,
 		Reference: reference,
-		Amount:    amount,
+		Amount:    json.Number(amount.Decimal()),
 	}
 	url := fmt.Sprintf("%s/payments?type=debit", p.config.THIRD_PARTY_SERVICE_BASE_URL)
-	resp, err := p.restClient.
+	request := p.restClient.
 		R().
+		SetContext(ctx).
+		SetHeader(idempotencyKeyHeader, reference).
 		SetResult(&PaymentResponse{}).
 		SetError(&ErrorResponse{}).
 		SetBody(payload).
-		Post(url)
+		AddRetryCondition(retryOnFailure)
+	resp, err := p.execute(request, http.MethodPost, url)
 	if err != nil {
-		log.Printf("error making withdrawal %v", err)
+		logging.FromContext(ctx).Error("error making withdrawal", "reference", reference, "error", err)
 		return nil, err
 	}
 
 	if resp.IsError() {
-		return nil, fmt.Errorf("make withdrawal error occurred with httpCode: %d, message: %s ", resp.StatusCode(), resp.Body())
+		return nil, newProviderError(resp.StatusCode(), resp.Error(), resp.Body())
 	}
 
 	return resp.Result().(*PaymentResponse), nil
 }
 
-func (p *paymentAPIClient) RetrieveTransaction(reference string) (*PaymentResponse, error) {
+func (p *paymentAPIClient) RetrieveTransaction(ctx context.Context, reference string) (*PaymentResponse, error) {
 	url := fmt.Sprintf("%s/payments/%s", p.config.THIRD_PARTY_SERVICE_BASE_URL, reference)
-	resp, err := p.restClient.
+	request := p.restClient.
 		R().
+		SetContext(ctx).
 		SetResult(&PaymentResponse{}).
 		SetError(&ErrorResponse{}).
-		Get(url)
+		AddRetryCondition(retryOnFailure)
+	resp, err := p.execute(request, http.MethodGet, url)
 	if err != nil {
-		log.Printf("error retrieving payment %v", err)
+		logging.FromContext(ctx).Error("error retrieving payment", "reference", reference, "error", err)
 		return nil, err
 	}
 
 	if resp.IsError() {
-		return nil, fmt.Errorf("retrieve payment error httpCode: %d, message: %s ", resp.StatusCode(), resp.Body())
+		providerErr := newProviderError(resp.StatusCode(), resp.Error(), resp.Body())
+		// the lookup names no account, not finding the reference means the provider never received the payment
+		if providerErr.StatusCode == http.StatusNotFound {
+			providerErr.Kind = ProviderErrorPaymentNotFound
+		}
+		return nil, providerErr
 	}
 
 	return resp.Result().(*PaymentResponse), nil
 }
+
+// Ping checks that the third party payment service answers on its base URL, any response below 500 counts as up.
+// It is a probe so it is sent once and bypasses the circuit breaker.
+func (p *paymentAPIClient) Ping(ctx context.Context) error {
+	resp, err := p.restClient.
+		R().
+		SetContext(ctx).
+		Get(p.config.THIRD_PARTY_SERVICE_BASE_URL)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return newProviderError(resp.StatusCode(), nil, resp.Body())
+	}
+
+	return nil
+}
@@ -2,9 +2,15 @@ package client
 
 import (
 	"consumer-payment-service/environment"
+	"consumer-payment-service/logging"
+	"consumer-payment-service/models"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/jarcoal/httpmock"
@@ -23,7 +29,7 @@ func Test_PaymentClient_MakeDeposit(t *testing.T) {
 		inputArgs struct {
 			accountId string
 			reference string
-			amount    float64
+			amount    models.Money
 		}
 		testType int
 	}{
@@ -32,11 +38,11 @@ func Test_PaymentClient_MakeDeposit(t *testing.T) {
 			inputArgs: struct {
 				accountId string
 				reference string
-				amount    float64
+				amount    models.Money
 			}{
 				accountId: "account_id",
 				reference: "reference",
-				amount:    10.0,
+				amount:    models.NewMoney(1050, "NGN"),
 			},
 			testType: success,
 		},
@@ -46,11 +52,11 @@ func Test_PaymentClient_MakeDeposit(t *testing.T) {
 			inputArgs: struct {
 				accountId string
 				reference string
-				amount    float64
+				amount    models.Money
 			}{
 				accountId: "account_id",
 				reference: "reference",
-				amount:    10.0,
+				amount:    models.NewMoney(1050, "NGN"),
 			},
 			testType: requestError,
 		},
@@ -60,11 +66,11 @@ func Test_PaymentClient_MakeDeposit(t *testing.T) {
 			inputArgs: struct {
 				accountId string
 				reference string
-				amount    float64
+				amount    models.Money
 			}{
 				accountId: "account_id",
 				reference: "reference",
-				amount:    10.0,
+				amount:    models.NewMoney(1050, "NGN"),
 			},
 			testType: errorMakeDeposit,
 		},
@@ -92,10 +98,13 @@ func Test_PaymentClient_MakeDeposit(t *testing.T) {
 				mockPaymentResponse := PaymentResponse{
 					AccountId: testCase.inputArgs.accountId,
 					Reference: testCase.inputArgs.reference,
-					Amount:    testCase.inputArgs.amount,
+					Amount:    json.Number(testCase.inputArgs.amount.Decimal()),
 				}
 
 				httpmock.RegisterResponder("POST", mockUrl, func(r *http.Request) (*http.Response, error) {
+					body, _ := io.ReadAll(r.Body)
+					assert.JSONEq(t, `{"account_id":"account_id","reference":"reference","amount":10.50}`, string(body))
+
 					response, err := httpmock.NewJsonResponse(http.StatusOK, mockPaymentResponse)
 					if err != nil {
 						return httpmock.NewStringResponse(http.StatusBadRequest, ""), nil
@@ -103,15 +112,15 @@ func Test_PaymentClient_MakeDeposit(t *testing.T) {
 					return response, nil
 				})
 
-				resp, err := paymentAPIClient.MakeDeposit(testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
+				resp, err := paymentAPIClient.MakeDeposit(context.Background(), testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
 				assert.NoError(t, err)
 				assert.EqualValues(t, resp.AccountId, testCase.inputArgs.accountId)
-				assert.EqualValues(t, resp.Amount, testCase.inputArgs.amount)
+				assert.EqualValues(t, "10.50", resp.Amount)
 				assert.EqualValues(t, resp.Reference, testCase.inputArgs.reference)
 
 			case requestError:
 				httpmock.RegisterResponder("POST", mockUrl, httpmock.ConnectionFailure)
-				resp, err := paymentAPIClient.MakeDeposit(testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
+				resp, err := paymentAPIClient.MakeDeposit(context.Background(), testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
 				assert.Error(t, err)
 				assert.Nil(t, resp)
 
@@ -128,9 +137,15 @@ func Test_PaymentClient_MakeDeposit(t *testing.T) {
 					return response, nil
 				})
 
-				resp, err := paymentAPIClient.MakeDeposit(testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
+				resp, err := paymentAPIClient.MakeDeposit(context.Background(), testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
 				assert.Error(t, err)
 				assert.Nil(t, resp)
+
+				var providerErr *ProviderError
+				assert.ErrorAs(t, err, &providerErr)
+				assert.Equal(t, http.StatusInternalServerError, providerErr.StatusCode)
+				assert.Equal(t, "transaction failed", providerErr.Message)
+				assert.Equal(t, ProviderErrorTransient, providerErr.Kind)
 			}
 
 		})
@@ -150,7 +165,7 @@ func Test_PaymentClient_MakeWithdrawal(t *testing.T) {
 		inputArgs struct {
 			accountId string
 			reference string
-			amount    float64
+			amount    models.Money
 		}
 		testType int
 	}{
@@ -159,11 +174,11 @@ func Test_PaymentClient_MakeWithdrawal(t *testing.T) {
 			inputArgs: struct {
 				accountId string
 				reference string
-				amount    float64
+				amount    models.Money
 			}{
 				accountId: "account_id",
 				reference: "reference",
-				amount:    10.0,
+				amount:    models.NewMoney(1050, "NGN"),
 			},
 			testType: success,
 		},
@@ -173,11 +188,11 @@ func Test_PaymentClient_MakeWithdrawal(t *testing.T) {
 			inputArgs: struct {
 				accountId string
 				reference string
-				amount    float64
+				amount    models.Money
 			}{
 				accountId: "account_id",
 				reference: "reference",
-				amount:    10.0,
+				amount:    models.NewMoney(1050, "NGN"),
 			},
 			testType: requestError,
 		},
@@ -187,11 +202,11 @@ func Test_PaymentClient_MakeWithdrawal(t *testing.T) {
 			inputArgs: struct {
 				accountId string
 				reference string
-				amount    float64
+				amount    models.Money
 			}{
 				accountId: "account_id",
 				reference: "reference",
-				amount:    10.0,
+				amount:    models.NewMoney(1050, "NGN"),
 			},
 			testType: errorMakeWithdrawal,
 		},
@@ -219,7 +234,7 @@ func Test_PaymentClient_MakeWithdrawal(t *testing.T) {
 				mockPaymentResponse := PaymentResponse{
 					AccountId: testCase.inputArgs.accountId,
 					Reference: testCase.inputArgs.reference,
-					Amount:    testCase.inputArgs.amount,
+					Amount:    json.Number(testCase.inputArgs.amount.Decimal()),
 				}
 
 				httpmock.RegisterResponder("POST", mockUrl, func(r *http.Request) (*http.Response, error) {
@@ -230,15 +245,15 @@ func Test_PaymentClient_MakeWithdrawal(t *testing.T) {
 					return response, nil
 				})
 
-				resp, err := paymentAPIClient.MakeWithdrawal(testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
+				resp, err := paymentAPIClient.MakeWithdrawal(context.Background(), testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
 				assert.NoError(t, err)
 				assert.EqualValues(t, resp.AccountId, testCase.inputArgs.accountId)
-				assert.EqualValues(t, resp.Amount, testCase.inputArgs.amount)
+				assert.EqualValues(t, "10.50", resp.Amount)
 				assert.EqualValues(t, resp.Reference, testCase.inputArgs.reference)
 
 			case requestError:
 				httpmock.RegisterResponder("POST", mockUrl, httpmock.ConnectionFailure)
-				resp, err := paymentAPIClient.MakeWithdrawal(testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
+				resp, err := paymentAPIClient.MakeWithdrawal(context.Background(), testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
 				assert.Error(t, err)
 				assert.Nil(t, resp)
 
@@ -255,9 +270,14 @@ func Test_PaymentClient_MakeWithdrawal(t *testing.T) {
 					return response, nil
 				})
 
-				resp, err := paymentAPIClient.MakeWithdrawal(testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
+				resp, err := paymentAPIClient.MakeWithdrawal(context.Background(), testCase.inputArgs.accountId, testCase.inputArgs.reference, testCase.inputArgs.amount)
 				assert.Error(t, err)
 				assert.Nil(t, resp)
+
+				var providerErr *ProviderError
+				assert.ErrorAs(t, err, &providerErr)
+				assert.Equal(t, http.StatusInternalServerError, providerErr.StatusCode)
+				assert.Equal(t, "transaction failed", providerErr.Message)
 			}
 
 		})
@@ -270,6 +290,7 @@ func Test_PaymentClient_RetrievePayment(t *testing.T) {
 		success = iota
 		requestError
 		errorMakeWithdrawal
+		cancelledContext
 	)
 
 	testCases := []struct {
@@ -294,6 +315,12 @@ func Test_PaymentClient_RetrievePayment(t *testing.T) {
 			reference: "invalid_ref",
 			testType:  errorMakeWithdrawal,
 		},
+
+		{
+			name:      "Test error when context is cancelled",
+			reference: "ref-002",
+			testType:  cancelledContext,
+		},
 	}
 
 	cfg := &environment.Config{
@@ -321,7 +348,7 @@ func Test_PaymentClient_RetrievePayment(t *testing.T) {
 				mockPaymentResponse := PaymentResponse{
 					AccountId: "account_id",
 					Reference: testCase.reference,
-					Amount:    10.0,
+					Amount:    "10.50",
 				}
 
 				httpmock.RegisterResponder("GET", mockUrl, func(r *http.Request) (*http.Response, error) {
@@ -332,13 +359,13 @@ func Test_PaymentClient_RetrievePayment(t *testing.T) {
 					return response, nil
 				})
 
-				resp, err := paymentAPIClient.RetrieveTransaction(testCase.reference)
+				resp, err := paymentAPIClient.RetrieveTransaction(context.Background(), testCase.reference)
 				assert.NoError(t, err)
 				assert.Equal(t, testCase.reference, resp.Reference)
 
 			case requestError:
 				httpmock.RegisterResponder("GET", mockUrl, httpmock.ConnectionFailure)
-				resp, err := paymentAPIClient.RetrieveTransaction(testCase.reference)
+				resp, err := paymentAPIClient.RetrieveTransaction(context.Background(), testCase.reference)
 				assert.Error(t, err)
 				assert.Nil(t, resp)
 
@@ -355,12 +382,328 @@ func Test_PaymentClient_RetrievePayment(t *testing.T) {
 					return response, nil
 				})
 
-				resp, err := paymentAPIClient.RetrieveTransaction(testCase.reference)
+				resp, err := paymentAPIClient.RetrieveTransaction(context.Background(), testCase.reference)
 				assert.Error(t, err)
 				assert.Nil(t, resp)
+
+				var providerErr *ProviderError
+				assert.ErrorAs(t, err, &providerErr)
+				assert.Equal(t, http.StatusInternalServerError, providerErr.StatusCode)
+				assert.Equal(t, "transaction not found", providerErr.Message)
+
+			case cancelledContext:
+				httpmock.RegisterResponder("GET", mockUrl, func(r *http.Request) (*http.Response, error) {
+					if err := r.Context().Err(); err != nil {
+						return nil, err
+					}
+					return httpmock.NewStringResponse(http.StatusOK, "{}"), nil
+				})
+
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				resp, err := paymentAPIClient.RetrieveTransaction(ctx, testCase.reference)
+				assert.ErrorIs(t, err, context.Canceled)
+				assert.Nil(t, resp)
+			}
+
+		})
+	}
+
+}
+
+func Test_PaymentClient_Ping(t *testing.T) {
+	const (
+		success = iota
+		requestError
+		errorProviderUnavailable
+	)
+
+	testCases := []struct {
+		name       string
+		statusCode int
+		testType   int
+	}{
+		{
+			name:       "Test success",
+			statusCode: http.StatusOK,
+			testType:   success,
+		},
+
+		{
+			name:       "Test success when base URL is not routed",
+			statusCode: http.StatusNotFound,
+			testType:   success,
+		},
+
+		{
+			name:     "Test error with request",
+			testType: requestError,
+		},
+
+		{
+			name:       "Test error when payment provider is unavailable",
+			statusCode: http.StatusServiceUnavailable,
+			testType:   errorProviderUnavailable,
+		},
+	}
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+	}
+
+	httpClient := resty.New()
+
+	paymentAPIClient := &paymentAPIClient{
+		restClient: httpClient,
+		config:     cfg,
+	}
+
+	httpmock.ActivateNonDefault(httpClient.GetClient())
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mockUrl := cfg.THIRD_PARTY_SERVICE_BASE_URL
+			switch testCase.testType {
+			case success:
+				httpmock.RegisterResponder("GET", mockUrl, httpmock.NewStringResponder(testCase.statusCode, ""))
+
+				assert.NoError(t, paymentAPIClient.Ping(context.Background()))
+
+			case requestError:
+				httpmock.RegisterResponder("GET", mockUrl, httpmock.ConnectionFailure)
+
+				assert.Error(t, paymentAPIClient.Ping(context.Background()))
+
+			case errorProviderUnavailable:
+				httpmock.RegisterResponder("GET", mockUrl, httpmock.NewStringResponder(testCase.statusCode, "unavailable"))
+
+				err := paymentAPIClient.Ping(context.Background())
+				var providerErr *ProviderError
+				assert.ErrorAs(t, err, &providerErr)
+				assert.Equal(t, http.StatusServiceUnavailable, providerErr.StatusCode)
+			}
+		})
+	}
+}
+
+func Test_PaymentClient_RequestID(t *testing.T) {
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+	}
+
+	httpClient := &http.Client{}
+	httpmock.ActivateNonDefault(httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	paymentAPIClient := NewPaymentAPIClientWithHTTPClient(cfg, httpClient)
+
+	mockUrl := fmt.Sprintf("%s/payments/%s", cfg.THIRD_PARTY_SERVICE_BASE_URL, "ref-001")
+	calls := 0
+	httpmock.RegisterResponder("GET", mockUrl, func(r *http.Request) (*http.Response, error) {
+		calls++
+		assert.Equal(t, "req-0001", r.Header.Get(logging.RequestIDHeader))
+		return httpmock.NewJsonResponse(http.StatusOK, PaymentResponse{Reference: "ref-001"})
+	})
+
+	ctx := logging.WithRequestID(context.Background(), "req-0001")
+	resp, err := paymentAPIClient.RetrieveTransaction(ctx, "ref-001")
+	assert.NoError(t, err)
+	assert.Equal(t, "ref-001", resp.Reference)
+	assert.Equal(t, 1, calls)
+}
+
+func Test_PaymentClient_Retries(t *testing.T) {
+	const (
+		retrieveRetriedOnServerError = iota
+		retrieveRetriedOnNetworkError
+		retrieveNotRetriedOnClientError
+		depositRetriedWithIdempotencyKey
+		retriesExhausted
+		pingNotRetried
+	)
+
+	testCases := []struct {
+		name          string
+		testType      int
+		expectedCalls int
+	}{
+		{
+			name:          "Test retrieve is retried on server error",
+			testType:      retrieveRetriedOnServerError,
+			expectedCalls: 2,
+		},
+
+		{
+			name:          "Test retrieve is retried on network error",
+			testType:      retrieveRetriedOnNetworkError,
+			expectedCalls: 2,
+		},
+
+		{
+			name:          "Test retrieve is not retried on client error",
+			testType:      retrieveNotRetriedOnClientError,
+			expectedCalls: 1,
+		},
+
+		{
+			name:          "Test deposit is retried with the same idempotency key",
+			testType:      depositRetriedWithIdempotencyKey,
+			expectedCalls: 2,
+		},
+
+		{
+			name:          "Test error once retries are exhausted",
+			testType:      retriesExhausted,
+			expectedCalls: 3,
+		},
+
+		{
+			name:          "Test ping is not retried",
+			testType:      pingNotRetried,
+			expectedCalls: 1,
+		},
+	}
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+		ProviderRetries:              2,
+		ProviderRetryWait:            time.Millisecond,
+		ProviderRetryMaxWait:         5 * time.Millisecond,
+	}
+
+	httpClient := &http.Client{}
+	httpmock.ActivateNonDefault(httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	paymentAPIClient := NewPaymentAPIClientWithHTTPClient(cfg, httpClient)
+
+	retrieveUrl := fmt.Sprintf("%s/payments/%s", cfg.THIRD_PARTY_SERVICE_BASE_URL, "ref-001")
+	depositUrl := fmt.Sprintf("%s/payments?type=credit", cfg.THIRD_PARTY_SERVICE_BASE_URL)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			httpmock.Reset()
+
+			calls := 0
+			// failFirst fails the first call with failure and answers the next ones successfully
+			failFirst := func(failure httpmock.Responder) httpmock.Responder {
+				return func(r *http.Request) (*http.Response, error) {
+					calls++
+					if calls == 1 {
+						return failure(r)
+					}
+					return httpmock.NewJsonResponse(http.StatusOK, PaymentResponse{Reference: "ref-001"})
+				}
+			}
+
+			switch testCase.testType {
+			case retrieveRetriedOnServerError:
+				httpmock.RegisterResponder("GET", retrieveUrl, failFirst(httpmock.NewStringResponder(http.StatusServiceUnavailable, "")))
+
+				resp, err := paymentAPIClient.RetrieveTransaction(context.Background(), "ref-001")
+				assert.NoError(t, err)
+				assert.Equal(t, "ref-001", resp.Reference)
+
+			case retrieveRetriedOnNetworkError:
+				httpmock.RegisterResponder("GET", retrieveUrl, failFirst(httpmock.ConnectionFailure))
+
+				_, err := paymentAPIClient.RetrieveTransaction(context.Background(), "ref-001")
+				assert.NoError(t, err)
+
+			case retrieveNotRetriedOnClientError:
+				httpmock.RegisterResponder("GET", retrieveUrl, failFirst(httpmock.NewStringResponder(http.StatusNotFound, "")))
+
+				_, err := paymentAPIClient.RetrieveTransaction(context.Background(), "ref-001")
+				var providerErr *ProviderError
+				assert.ErrorAs(t, err, &providerErr)
+				assert.Equal(t, http.StatusNotFound, providerErr.StatusCode)
+				assert.Equal(t, ProviderErrorPaymentNotFound, providerErr.Kind)
+
+			case depositRetriedWithIdempotencyKey:
+				httpmock.RegisterResponder("POST", depositUrl, func(r *http.Request) (*http.Response, error) {
+					assert.Equal(t, "ref-001", r.Header.Get("Idempotency-Key"))
+					body, _ := io.ReadAll(r.Body)
+					assert.JSONEq(t, `{"account_id":"account_id","reference":"ref-001","amount":10.50}`, string(body))
+
+					return failFirst(httpmock.NewStringResponder(http.StatusBadGateway, ""))(r)
+				})
+
+				_, err := paymentAPIClient.MakeDeposit(context.Background(), "account_id", "ref-001", models.NewMoney(1050, "NGN"))
+				assert.NoError(t, err)
+
+			case retriesExhausted:
+				httpmock.RegisterResponder("GET", retrieveUrl, func(r *http.Request) (*http.Response, error) {
+					calls++
+					return httpmock.NewStringResponse(http.StatusServiceUnavailable, "unavailable"), nil
+				})
+
+				_, err := paymentAPIClient.RetrieveTransaction(context.Background(), "ref-001")
+				var providerErr *ProviderError
+				assert.ErrorAs(t, err, &providerErr)
+				assert.Equal(t, http.StatusServiceUnavailable, providerErr.StatusCode)
+
+			case pingNotRetried:
+				httpmock.RegisterResponder("GET", cfg.THIRD_PARTY_SERVICE_BASE_URL, failFirst(httpmock.NewStringResponder(http.StatusServiceUnavailable, "")))
+
+				assert.Error(t, paymentAPIClient.Ping(context.Background()))
 			}
 
+			assert.Equal(t, testCase.expectedCalls, calls)
 		})
 	}
+}
+
+func Test_PaymentClient_CircuitBreaker(t *testing.T) {
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+		ProviderBreakerThreshold:     2,
+		ProviderBreakerCooldown:      time.Minute,
+	}
+
+	httpClient := &http.Client{}
+	httpmock.ActivateNonDefault(httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	providerClient := NewPaymentAPIClientWithHTTPClient(cfg, httpClient)
+
+	now := time.Now()
+	providerClient.(*paymentAPIClient).breaker.now = func() time.Time { return now }
 
+	mockUrl := fmt.Sprintf("%s/payments/%s", cfg.THIRD_PARTY_SERVICE_BASE_URL, "ref-001")
+	calls := 0
+	statusCode := http.StatusNotFound
+	httpmock.RegisterResponder("GET", mockUrl, func(r *http.Request) (*http.Response, error) {
+		calls++
+		return httpmock.NewJsonResponse(statusCode, PaymentResponse{Reference: "ref-001"})
+	})
+
+	// client errors mean the provider is up
+	for i := 0; i < 2; i++ {
+		_, err := providerClient.RetrieveTransaction(context.Background(), "ref-001")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, CircuitClosed, providerClient.CircuitState())
+
+	statusCode = http.StatusInternalServerError
+	for i := 0; i < 2; i++ {
+		_, err := providerClient.RetrieveTransaction(context.Background(), "ref-001")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, CircuitOpen, providerClient.CircuitState())
+
+	// calls fail fast while the circuit is open
+	_, err := providerClient.RetrieveTransaction(context.Background(), "ref-001")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 4, calls)
+
+	// a successful probe once the cooldown has passed closes the circuit
+	now = now.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, providerClient.CircuitState())
+
+	statusCode = http.StatusOK
+	_, err = providerClient.RetrieveTransaction(context.Background(), "ref-001")
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitClosed, providerClient.CircuitState())
+	assert.Equal(t, 5, calls)
 }
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// redactedFields are masked in the debug logs of provider calls
+var redactedFields = map[string]bool{
+	"account_id": true,
+	"amount":     true,
+}
+
+const redacted = "[REDACTED]"
+
+// redactBody masks redactedFields in a JSON body, bodies that are not JSON are logged as they are
+func redactBody(body string) string {
+	var value any
+	if err := json.Unmarshal([]byte(body), &value); err != nil {
+		return body
+	}
+
+	data, err := json.MarshalIndent(redactValue(value), "", "   ")
+	if err != nil {
+		return body
+	}
+	return string(data)
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if redactedFields[key] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
+
+// enableDebug logs every provider request and response with their sensitive fields masked
+func enableDebug(restClient *resty.Client) {
+	restClient.
+		SetDebug(true).
+		SetLogger(&restyLogger{logger: slog.Default().With("component", "payment_client")}).
+		OnRequestLog(func(log *resty.RequestLog) error {
+			log.Body = redactBody(log.Body)
+			return nil
+		}).
+		OnResponseLog(func(log *resty.ResponseLog) error {
+			log.Body = redactBody(log.Body)
+			return nil
+		})
+}
+
+// restyLogger sends resty's own logging to slog
+type restyLogger struct {
+	logger *slog.Logger
+}
+
+func (l *restyLogger) Errorf(format string, v ...any) {
+	l.logger.Error(fmt.Sprintf(format, v...))
+}
+
+func (l *restyLogger) Warnf(format string, v ...any) {
+	l.logger.Warn(fmt.Sprintf(format, v...))
+}
+
+// Debugf is used by resty for request and response dumps, which are only produced once debugging is switched on
+func (l *restyLogger) Debugf(format string, v ...any) {
+	l.logger.Info(fmt.Sprintf(format, v...))
+}
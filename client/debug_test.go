@@ -0,0 +1,36 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_redactBody(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "Test account id and amount are masked",
+			body:     `{"account_id":"acc_001","reference":"ref-001","amount":10.50}`,
+			expected: `{"account_id":"[REDACTED]","reference":"ref-001","amount":"[REDACTED]"}`,
+		},
+		{
+			name:     "Test nested fields are masked",
+			body:     `{"data":[{"account_id":"acc_001","status":"SUCCESS"}]}`,
+			expected: `{"data":[{"account_id":"[REDACTED]","status":"SUCCESS"}]}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.JSONEq(t, testCase.expected, redactBody(testCase.body))
+		})
+	}
+
+	t.Run("Test body that is not JSON is kept", func(t *testing.T) {
+		assert.Equal(t, "service unavailable", redactBody("service unavailable"))
+	})
+}
@@ -1,17 +1,24 @@
 package client
 
+import "encoding/json"
+
+// PaymentRequest amounts are sent in major units, e.g. 10.50, written from models.Money without going through a float
 type PaymentRequest struct {
-	AccountId string  `json:"account_id"`
-	Reference string  `json:"reference"`
-	Amount    float64 `json:"amount"`
+	AccountId string      `json:"account_id"`
+	Reference string      `json:"reference"`
+	Amount    json.Number `json:"amount"`
 }
 
+// ErrorResponse is the body of provider error responses, ErrorCode is one of "declined", "insufficient_funds" or
+// "invalid_account" when the provider says why it refused a payment
 type ErrorResponse struct {
 	ErrorMessage string `json:"errorMessage"`
+	ErrorCode    string `json:"errorCode,omitempty"`
 }
 
 type PaymentResponse struct {
-	AccountId string  `json:"account_id"`
-	Reference string  `json:"reference"`
-	Amount    float64 `json:"amount"`
+	AccountId string      `json:"account_id"`
+	Reference string      `json:"reference"`
+	Amount    json.Number `json:"amount"`
+	Status    string      `json:"status"`
 }
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ProviderErrorKind classifies why the third party payment service refused or failed a call
+type ProviderErrorKind string
+
+const (
+	// ProviderErrorDeclined is a payment the provider refused to make
+	ProviderErrorDeclined ProviderErrorKind = "declined"
+	// ProviderErrorInsufficientFunds is a payment refused because the account at the provider lacks the funds
+	ProviderErrorInsufficientFunds ProviderErrorKind = "insufficient_funds"
+	// ProviderErrorInvalidAccount is a payment to or from an account the provider does not know
+	ProviderErrorInvalidAccount ProviderErrorKind = "invalid_account"
+	// ProviderErrorTransient is a failure of the provider itself, the same call may succeed later
+	ProviderErrorTransient ProviderErrorKind = "transient"
+	// ProviderErrorPaymentNotFound is a payment looked up by reference that the provider never received
+	ProviderErrorPaymentNotFound ProviderErrorKind = "payment_not_found"
+)
+
+// ProviderError is returned when the third party payment service answers with an error response
+type ProviderError struct {
+	StatusCode int
+	Message    string
+	Kind       ProviderErrorKind
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("payment provider error httpCode: %d, kind: %s, message: %s", e.StatusCode, e.Kind, e.Message)
+}
+
+// newProviderError reads the provider error message, falling back to the raw body when it is not the documented shape
+func newProviderError(statusCode int, errorResponse any, body []byte) *ProviderError {
+	message := string(body)
+	code := ""
+	if response, ok := errorResponse.(*ErrorResponse); ok {
+		if response.ErrorMessage != "" {
+			message = response.ErrorMessage
+		}
+		code = response.ErrorCode
+	}
+
+	return &ProviderError{StatusCode: statusCode, Message: message, Kind: classifyProviderError(statusCode, code)}
+}
+
+// classifyProviderError prefers the error code sent by the provider and falls back to the HTTP status. Any other
+// refusal of a well formed request is treated as a decline.
+func classifyProviderError(statusCode int, code string) ProviderErrorKind {
+	switch kind := ProviderErrorKind(code); kind {
+	case ProviderErrorDeclined, ProviderErrorInsufficientFunds, ProviderErrorInvalidAccount:
+		return kind
+	}
+
+	switch {
+	case statusCode >= http.StatusInternalServerError,
+		statusCode == http.StatusRequestTimeout,
+		statusCode == http.StatusTooManyRequests:
+		return ProviderErrorTransient
+	case statusCode == http.StatusNotFound:
+		return ProviderErrorInvalidAccount
+	}
+	return ProviderErrorDeclined
+}
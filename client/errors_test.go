@@ -0,0 +1,71 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewProviderError(t *testing.T) {
+	testCases := []struct {
+		name            string
+		statusCode      int
+		errorResponse   any
+		body            string
+		expectedKind    ProviderErrorKind
+		expectedMessage string
+	}{
+		{
+			name:            "Test error code sent by the provider",
+			statusCode:      http.StatusUnprocessableEntity,
+			errorResponse:   &ErrorResponse{ErrorMessage: "not enough funds", ErrorCode: "insufficient_funds"},
+			expectedKind:    ProviderErrorInsufficientFunds,
+			expectedMessage: "not enough funds",
+		},
+		{
+			name:            "Test invalid account error code",
+			statusCode:      http.StatusBadRequest,
+			errorResponse:   &ErrorResponse{ErrorMessage: "unknown account", ErrorCode: "invalid_account"},
+			expectedKind:    ProviderErrorInvalidAccount,
+			expectedMessage: "unknown account",
+		},
+		{
+			name:            "Test unknown error code falls back to the status",
+			statusCode:      http.StatusPaymentRequired,
+			errorResponse:   &ErrorResponse{ErrorMessage: "card blocked", ErrorCode: "blocked"},
+			expectedKind:    ProviderErrorDeclined,
+			expectedMessage: "card blocked",
+		},
+		{
+			name:            "Test account not found",
+			statusCode:      http.StatusNotFound,
+			errorResponse:   &ErrorResponse{},
+			body:            "not found",
+			expectedKind:    ProviderErrorInvalidAccount,
+			expectedMessage: "not found",
+		},
+		{
+			name:            "Test server error is transient",
+			statusCode:      http.StatusBadGateway,
+			body:            "bad gateway",
+			expectedKind:    ProviderErrorTransient,
+			expectedMessage: "bad gateway",
+		},
+		{
+			name:            "Test rate limit is transient",
+			statusCode:      http.StatusTooManyRequests,
+			expectedKind:    ProviderErrorTransient,
+			expectedMessage: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := newProviderError(testCase.statusCode, testCase.errorResponse, []byte(testCase.body))
+			assert.Equal(t, testCase.statusCode, err.StatusCode)
+			assert.Equal(t, testCase.expectedKind, err.Kind)
+			assert.Equal(t, testCase.expectedMessage, err.Message)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Package databasetest holds helpers for tests that run against the generated mock of the database store
+package databasetest
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/mocks"
+	"context"
+
+	"go.uber.org/mock/gomock"
+)
+
+// ExpectWithTx makes the mocked store run the callback of its next unit of work against itself
+func ExpectWithTx(store *mocks.MockMongoDBStore) {
+	store.
+		EXPECT().
+		WithTx(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, fn func(database.MongoDBStore) error) error {
+			return fn(store)
+		})
+}
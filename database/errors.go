@@ -0,0 +1,34 @@
+package database
+
+import "errors"
+
+// Errors returned by MongoDBStore implementations, callers should match them with errors.Is
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrAccountNotOwned is returned when an account exists but belongs to another user
+	ErrAccountNotOwned     = errors.New("account does not belong to user")
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrTransactionNotPending is returned when a transaction has already been completed or failed
+	ErrTransactionNotPending = errors.New("transaction is no longer pending")
+	// ErrDuplicateReference is returned when a payment reference or idempotency key has already been recorded
+	ErrDuplicateReference = errors.New("duplicate payment reference")
+	// ErrInsufficientFunds is returned when a debit or hold would take the available balance of an account below zero
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrCurrencyMismatch is returned when an amount is applied to an account held in another currency
+	ErrCurrencyMismatch = errors.New("currency does not match account currency")
+	// ErrTransactionNotReversible is returned when a transaction is not a completed payment that can be reversed
+	ErrTransactionNotReversible = errors.New("transaction cannot be reversed")
+	// ErrReversalExceedsAmount is returned when reversals of a payment would add up to more than its amount
+	ErrReversalExceedsAmount = errors.New("reversal exceeds the unreversed amount of the payment")
+	// ErrHoldNotActive is returned when an authorization has already been captured, voided or has expired
+	ErrHoldNotActive = errors.New("authorization is no longer active")
+	// ErrCaptureExceedsHold is returned when a capture is for more than the authorized amount
+	ErrCaptureExceedsHold = errors.New("capture exceeds the authorized amount")
+	// ErrAccountClosed is returned when an account that has been closed is used or closed again
+	ErrAccountClosed = errors.New("account is closed")
+	// ErrAccountBalanceNotZero is returned when an account that still holds money is closed
+	ErrAccountBalanceNotZero = errors.New("account balance is not zero")
+	// ErrAccountHasPendingPayments is returned when an account with payments still in flight is closed
+	ErrAccountHasPendingPayments = errors.New("account has pending payments")
+)
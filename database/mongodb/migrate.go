@@ -0,0 +1,113 @@
+package mongodb
+
+import (
+	"consumer-payment-service/models"
+	"context"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MigrateFloatAmounts rewrites account balances and transaction amounts still stored as floating point numbers
+// into models.Money documents in the given currency. Documents already migrated are left untouched so it is
+// safe to run on every start up.
+func MigrateFloatAmounts(ctx context.Context, client *mongo.Client, databaseName, currency string) error {
+	if !models.ValidCurrency(currency) {
+		return models.ErrInvalidCurrency
+	}
+
+	fields := map[string]string{
+		AccountsCollectionName:     "balance",
+		TransactionsCollectionName: "amount",
+	}
+
+	for collectionName, field := range fields {
+		filter := bson.M{field: bson.M{"$type": "double"}}
+		pipeline := mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				field: bson.M{
+					"minor": bson.M{
+						"$toLong": bson.M{
+							"$round": bson.A{
+								bson.M{"$multiply": bson.A{"$" + field, math.Pow10(models.CurrencyExponent(currency))}},
+								0,
+							},
+						},
+					},
+					"currency": currency,
+				},
+			}}},
+		}
+
+		_, err := client.Database(databaseName).Collection(collectionName).UpdateMany(ctx, filter, pipeline)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateAvailableBalances gives accounts opened before holds could be placed an available balance equal to their
+// ledger balance, no hold can be placed on them yet. Accounts that have one are left untouched so it is safe to run
+// on every start up.
+func MigrateAvailableBalances(ctx context.Context, client *mongo.Client, databaseName string) error {
+	filter := bson.M{"available": bson.M{"$exists": false}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"available": "$balance"}}},
+	}
+
+	_, err := client.Database(databaseName).Collection(AccountsCollectionName).UpdateMany(ctx, filter, pipeline)
+	return err
+}
+
+// openingEntryIDPrefix prefixes the account ID to make the ID of its opening balance entry
+const openingEntryIDPrefix = "opening:"
+
+// MigrateOpeningBalances posts an opening balance to the ledger for every account that holds money but has no
+// journal entries, i.e. accounts funded before the ledger was kept, so that their balances can be derived from
+// it. Accounts with entries are left untouched so it is safe to run on every start up. The opening entry of an
+// account has a fixed ID, so when several instances start together only one of them posts it.
+func MigrateOpeningBalances(ctx context.Context, client *mongo.Client, databaseName string) error {
+	accounts := client.Database(databaseName).Collection(AccountsCollectionName)
+	entries := client.Database(databaseName).Collection(JournalEntriesCollectionName)
+
+	cursor, err := accounts.Find(ctx, bson.M{"balance.minor": bson.M{"$ne": 0}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var account models.Account
+		if err := cursor.Decode(&account); err != nil {
+			return err
+		}
+
+		count, err := entries.CountDocuments(ctx, bson.M{"postings.account_id": account.AccountID})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		entry := models.JournalEntry{
+			EntryID:     openingEntryIDPrefix + account.AccountID,
+			Description: "opening balance",
+			Postings: []models.Posting{
+				{AccountID: account.AccountID, Amount: account.Balance},
+				{AccountID: models.OpeningBalancesAccount, Amount: account.Balance.Negate()},
+			},
+			CreatedAt: time.Now().Unix(),
+		}
+		// another instance posted it first
+		if _, err := entries.InsertOne(ctx, entry); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
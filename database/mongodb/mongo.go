@@ -4,32 +4,51 @@ import (
 	"consumer-payment-service/database"
 	"consumer-payment-service/models"
 	"context"
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 const (
-	AccountsCollectionName     = "accounts"
-	TransactionsCollectionName = "transactions"
-	UserCollection             = "users"
+	AccountsCollectionName       = "accounts"
+	TransactionsCollectionName   = "transactions"
+	UserCollection               = "users"
+	JournalEntriesCollectionName = "journal_entries"
 )
 
 type mongodbStore struct {
 	mongodbClient *mongo.Client
 	databaseName  string
+	// queryTimeout bounds every call on top of the deadline of the context it is given
+	queryTimeout time.Duration
+	// session is set on stores handed out by WithTx so that every call joins the transaction
+	session mongo.Session
 }
 
 func (m *mongodbStore) collection(collectionName string) *mongo.Collection {
 	return m.mongodbClient.Database(m.databaseName).Collection(collectionName)
 }
 
-// New returns a mongo instance that implements the mongodbstore
-func New(connectUri, databaseName string) (database.MongoDBStore, *mongo.Client, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// queryContext derives the context a single call runs with from the caller's context
+func (m *mongodbStore) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.session != nil {
+		ctx = mongo.NewSessionContext(ctx, m.session)
+	}
+
+	if m.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, m.queryTimeout)
+}
+
+// New returns a mongo instance that implements the mongodbstore, queryTimeout bounds each store call
+func New(ctx context.Context, connectUri, databaseName string, queryTimeout time.Duration) (database.MongoDBStore, *mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	opts := options.Client().ApplyURI(connectUri)
@@ -42,84 +61,948 @@ func New(connectUri, databaseName string) (database.MongoDBStore, *mongo.Client,
 		return nil, nil, err
 	}
 
-	return &mongodbStore{mongodbClient: client, databaseName: databaseName}, client, nil
+	store := &mongodbStore{mongodbClient: client, databaseName: databaseName, queryTimeout: queryTimeout}
+	if err := store.createIndexes(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	return store, client, nil
+}
+
+// createIndexes makes sure a payment reference or idempotency key can only be recorded once
+// and that pending transactions, expired holds and account histories can be found without a collection scan
+func (m *mongodbStore) createIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "reference", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "idempotency_key", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"idempotency_key": bson.M{"$gt": ""}}),
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "account_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}},
+		},
+	}
+
+	if _, err := m.collection(TransactionsCollectionName).Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	// generated user and account IDs must never be handed out twice, accounts are listed by user
+	accountIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "account_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	}
+	if _, err := m.collection(AccountsCollectionName).Indexes().CreateMany(ctx, accountIndexes); err != nil {
+		return err
+	}
+
+	if _, err := m.collection(UserCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		return err
+	}
+
+	// journal entries are found by the transaction that caused them and by the accounts they post to
+	journalIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "entry_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "reference", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "postings.account_id", Value: 1}},
+		},
+	}
+	_, err := m.collection(JournalEntriesCollectionName).Indexes().CreateMany(ctx, journalIndexes)
+	return err
+}
+
+// mapError translates driver errors into the errors declared by the database package,
+// notFound is returned in place of mongo.ErrNoDocuments.
+func mapError(err error, notFound error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments) && notFound != nil:
+		return notFound
+	case mongo.IsDuplicateKeyError(err):
+		return database.ErrDuplicateReference
+	}
+
+	return err
+}
+
+// WithTx runs fn inside a multi-document transaction, the store passed to fn commits or rolls back as a unit and
+// reads from a single snapshot of the data. Transactions require MongoDB to run as a replica set.
+func (m *mongodbStore) WithTx(ctx context.Context, fn func(store database.MongoDBStore) error) error {
+	// already inside a transaction, join it
+	if m.session != nil {
+		return fn(m)
+	}
+
+	session, err := m.mongodbClient.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	opts := options.Transaction().SetReadConcern(readconcern.Snapshot())
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(&mongodbStore{
+			mongodbClient: m.mongodbClient,
+			databaseName:  m.databaseName,
+			queryTimeout:  m.queryTimeout,
+			session:       sessionCtx,
+		})
+	}, opts)
+
+	return err
 }
 
-func (m *mongodbStore) GetAccountByID(accountId string) (*models.Account, error) {
+func (m *mongodbStore) GetAccountByID(ctx context.Context, accountId string) (*models.Account, error) {
 	filter := bson.M{"account_id": accountId}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	account := &models.Account{}
 
 	err := m.collection(AccountsCollectionName).FindOne(ctx, filter).Decode(account)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err, database.ErrAccountNotFound)
 	}
 
 	return account, nil
 }
 
-func (m *mongodbStore) UpdateAccountBalance(accountId string, amount float64) error {
-	filter := bson.M{"account_id": accountId}
-	update := bson.M{
-		"$set": bson.M{
-			"balance": amount,
-		},
+// GetUserAccount fetches an account only when it belongs to userId, database.ErrAccountNotOwned is returned
+// for accounts held by another user.
+func (m *mongodbStore) GetUserAccount(ctx context.Context, userId, accountId string) (*models.Account, error) {
+	filter := bson.M{"account_id": accountId, "user_id": userId}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	account := &models.Account{}
+
+	err := m.collection(AccountsCollectionName).FindOne(ctx, filter).Decode(account)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		count, err := m.collection(AccountsCollectionName).CountDocuments(ctx, bson.M{"account_id": accountId})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, database.ErrAccountNotOwned
+		}
+		return nil, database.ErrAccountNotFound
+	}
+
+	return account, nil
+}
+
+// AdjustAccountBalance atomically adds amount to the ledger and available balances of an open account, a negative
+// amount debits the account. Debits only apply when the available balance covers them, otherwise
+// database.ErrInsufficientFunds is returned.
+func (m *mongodbStore) AdjustAccountBalance(ctx context.Context, accountId string, amount models.Money) (*models.Account, error) {
+	return m.adjustBalances(ctx, accountId, amount, "balance.minor", "available.minor")
+}
+
+// AdjustAvailableBalance atomically adds amount to the available balance of an open account only, a negative amount
+// places a hold and a positive one releases it. Holds only apply when the available balance covers them, otherwise
+// database.ErrInsufficientFunds is returned.
+func (m *mongodbStore) AdjustAvailableBalance(ctx context.Context, accountId string, amount models.Money) (*models.Account, error) {
+	return m.adjustBalances(ctx, accountId, amount, "available.minor")
+}
+
+// adjustBalances adds amount to each of fields of an open account, guarding decreases on the available balance
+func (m *mongodbStore) adjustBalances(ctx context.Context, accountId string, amount models.Money, fields ...string) (*models.Account, error) {
+	filter := bson.M{
+		"account_id":       accountId,
+		"balance.currency": amount.Currency,
+		"status":           bson.M{"$ne": models.CLOSED},
+	}
+	if amount.Minor < 0 {
+		filter["available.minor"] = bson.M{"$gte": -amount.Minor}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	inc := bson.M{}
+	for _, field := range fields {
+		inc[field] = amount.Minor
+	}
+	update := bson.M{"$inc": inc}
+
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	_, err := m.collection(AccountsCollectionName).UpdateOne(ctx, filter, update)
+	account := &models.Account{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.collection(AccountsCollectionName).FindOneAndUpdate(ctx, filter, update, opts).Decode(account)
 	if err != nil {
-		return err
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		// work out which guard stopped the update
+		existing := &models.Account{}
+		if err := m.collection(AccountsCollectionName).FindOne(ctx, bson.M{"account_id": accountId}).Decode(existing); err != nil {
+			return nil, mapError(err, database.ErrAccountNotFound)
+		}
+		if existing.Closed() {
+			return nil, database.ErrAccountClosed
+		}
+		if existing.Balance.Currency != amount.Currency {
+			return nil, database.ErrCurrencyMismatch
+		}
+		return nil, database.ErrInsufficientFunds
 	}
 
-	return nil
+	return account, nil
 }
 
-func (m *mongodbStore) CreateTransaction(transaction *models.Transaction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// LockAccount writes to an open account so that the transaction it runs in conflicts with any other one writing the
+// account, closing it in particular. Reads alone do not conflict in MongoDB, so a payment recorded without changing
+// the balance must lock its account to keep it from being closed under it. database.ErrAccountClosed is returned
+// for a closed account.
+func (m *mongodbStore) LockAccount(ctx context.Context, accountId string) (*models.Account, error) {
+	filter := bson.M{
+		"account_id": accountId,
+		"status":     bson.M{"$ne": models.CLOSED},
+	}
+	update := bson.M{"$inc": bson.M{"lock_version": 1}}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	account := &models.Account{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.collection(AccountsCollectionName).FindOneAndUpdate(ctx, filter, update, opts).Decode(account)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		// work out which guard stopped the update
+		if _, err := m.GetAccountByID(ctx, accountId); err != nil {
+			return nil, err
+		}
+		return nil, database.ErrAccountClosed
+	}
+
+	return account, nil
+}
+
+func (m *mongodbStore) CreateTransaction(ctx context.Context, transaction *models.Transaction) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	_, err := m.collection(TransactionsCollectionName).InsertOne(ctx, transaction)
 	if err != nil {
-		return err
+		return mapError(err, nil)
 	}
 
 	return nil
 }
 
-func (m *mongodbStore) GetPaymentByReferenceId(reference string) (*models.Transaction, error) {
+func (m *mongodbStore) GetPaymentByReferenceId(ctx context.Context, reference string) (*models.Transaction, error) {
 	filter := bson.M{"reference": reference}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	transaction := &models.Transaction{}
 
 	err := m.collection(TransactionsCollectionName).FindOne(ctx, filter).Decode(transaction)
+	if err != nil {
+		return nil, mapError(err, database.ErrTransactionNotFound)
+	}
+
+	return transaction, nil
+}
+
+// UpdateTransactionStatus moves a PENDING transaction to status, a transaction is only ever finalized once
+func (m *mongodbStore) UpdateTransactionStatus(ctx context.Context, reference string, status models.TransactionStatus) error {
+	return m.finalizeTransaction(ctx, reference, bson.M{"status": status})
+}
+
+// FailTransaction marks a PENDING transaction FAILED and records why the payment provider rejected it and how its
+// answer was classified
+func (m *mongodbStore) FailTransaction(ctx context.Context, reference, reason string, providerStatusCode int, failureKind string) error {
+	return m.finalizeTransaction(ctx, reference, bson.M{
+		"status":               models.FAILED,
+		"failure_reason":       reason,
+		"provider_status_code": providerStatusCode,
+		"failure_kind":         failureKind,
+	})
+}
+
+func (m *mongodbStore) finalizeTransaction(ctx context.Context, reference string, set bson.M) error {
+	filter := bson.M{"reference": reference, "status": models.PENDING}
+	update := bson.M{"$set": set}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	result, err := m.collection(TransactionsCollectionName).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// nothing pending matched, tell a finalized transaction apart from a missing one
+	count, err := m.collection(TransactionsCollectionName).CountDocuments(ctx, bson.M{"reference": reference})
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return database.ErrTransactionNotPending
+	}
+	return database.ErrTransactionNotFound
+}
+
+// AdjustReversedAmount atomically adds amount to what has been reversed of a payment and moves it to
+// PARTIALLY_REVERSED or REVERSED accordingly, a negative amount releases a reversal that did not go through.
+// Reversals only apply while they add up to no more than the amount of the payment, otherwise
+// database.ErrReversalExceedsAmount is returned.
+func (m *mongodbStore) AdjustReversedAmount(ctx context.Context, reference string, amount models.Money) (*models.Transaction, error) {
+	reversed := bson.M{"$ifNull": bson.A{"$reversed_amount.minor", 0}}
+	total := bson.M{"$add": bson.A{reversed, amount.Minor}}
+
+	filter := bson.M{
+		"reference":       reference,
+		"amount.currency": amount.Currency,
+	}
+	if amount.Minor > 0 {
+		filter["status"] = bson.M{"$in": bson.A{models.SUCCESS, models.PARTIALLY_REVERSED}}
+		filter["$expr"] = bson.M{"$lte": bson.A{total, "$amount.minor"}}
+	} else {
+		filter["status"] = bson.M{"$in": bson.A{models.PARTIALLY_REVERSED, models.REVERSED}}
+		filter["$expr"] = bson.M{"$gte": bson.A{total, 0}}
+	}
+
+	// the status follows from the reversed amount, which is only known once it has been added to
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"reversed_amount": bson.M{"minor": total, "currency": amount.Currency},
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"status": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$eq": bson.A{"$reversed_amount.minor", 0}}, "then": models.SUCCESS},
+					bson.M{"case": bson.M{"$eq": bson.A{"$reversed_amount.minor", "$amount.minor"}}, "then": models.REVERSED},
+				},
+				"default": models.PARTIALLY_REVERSED,
+			}},
+		}}},
+	}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	transaction := &models.Transaction{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.collection(TransactionsCollectionName).FindOneAndUpdate(ctx, filter, update, opts).Decode(transaction)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		// work out which guard stopped the update
+		existing := &models.Transaction{}
+		if err := m.collection(TransactionsCollectionName).FindOne(ctx, bson.M{"reference": reference}).Decode(existing); err != nil {
+			return nil, mapError(err, database.ErrTransactionNotFound)
+		}
+		if existing.Amount.Currency != amount.Currency {
+			return nil, database.ErrCurrencyMismatch
+		}
+		if existing.Status == models.PENDING || existing.Status == models.FAILED {
+			return nil, database.ErrTransactionNotReversible
+		}
+		return nil, database.ErrReversalExceedsAmount
+	}
+
+	return transaction, nil
+}
+
+// CaptureHold moves an AUTHORIZED transaction that has not expired to PENDING for amount, which is at most the
+// authorized amount, and records the authorized amount. The hold itself is left for the caller to release.
+func (m *mongodbStore) CaptureHold(ctx context.Context, reference string, amount models.Money) (*models.Transaction, error) {
+	filter := bson.M{
+		"reference":       reference,
+		"status":          models.AUTHORIZED,
+		"expires_at":      bson.M{"$gt": time.Now().Unix()},
+		"amount.currency": amount.Currency,
+		"amount.minor":    bson.M{"$gte": amount.Minor},
+	}
+
+	// fields of a single $set stage read the document as it was, so authorized_amount gets the amount held
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"authorized_amount": "$amount",
+			"amount":            bson.M{"minor": amount.Minor, "currency": amount.Currency},
+			"status":            models.PENDING,
+		}}},
+	}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	transaction := &models.Transaction{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.collection(TransactionsCollectionName).FindOneAndUpdate(ctx, filter, update, opts).Decode(transaction)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		// work out which guard stopped the update
+		existing := &models.Transaction{}
+		if err := m.collection(TransactionsCollectionName).FindOne(ctx, bson.M{"reference": reference}).Decode(existing); err != nil {
+			return nil, mapError(err, database.ErrTransactionNotFound)
+		}
+		if !existing.Capturable(time.Now().Unix()) {
+			return nil, database.ErrHoldNotActive
+		}
+		if existing.Amount.Currency != amount.Currency {
+			return nil, database.ErrCurrencyMismatch
+		}
+		return nil, database.ErrCaptureExceedsHold
+	}
+
+	return transaction, nil
+}
+
+// ReleaseHold moves an AUTHORIZED transaction to status, VOIDED or EXPIRED, without capturing it. The hold itself is
+// left for the caller to release.
+func (m *mongodbStore) ReleaseHold(ctx context.Context, reference string, status models.TransactionStatus) (*models.Transaction, error) {
+	filter := bson.M{"reference": reference, "status": models.AUTHORIZED}
+	update := bson.M{"$set": bson.M{"status": status}}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	transaction := &models.Transaction{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.collection(TransactionsCollectionName).FindOneAndUpdate(ctx, filter, update, opts).Decode(transaction)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		// nothing authorized matched, tell a settled authorization apart from a missing one
+		count, err := m.collection(TransactionsCollectionName).CountDocuments(ctx, bson.M{"reference": reference})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, database.ErrHoldNotActive
+		}
+		return nil, database.ErrTransactionNotFound
+	}
+
+	return transaction, nil
+}
+
+// GetExpiredHolds returns up to limit AUTHORIZED transactions that expired by expiredBy created after the cursor,
+// oldest first
+func (m *mongodbStore) GetExpiredHolds(ctx context.Context, expiredBy int64, after *models.TransactionCursor, limit int64) ([]models.Transaction, error) {
+	filter := bson.M{
+		"status":     models.AUTHORIZED,
+		"expires_at": bson.M{"$lte": expiredBy},
+	}
+
+	// continue strictly after the cursor in (created_at, reference) ascending order
+	if after != nil {
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$gt": after.CreatedAt}},
+			bson.M{"created_at": after.CreatedAt, "reference": bson.M{"$gt": after.Reference}},
+		}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "reference", Value: 1}}).
+		SetLimit(limit)
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := m.collection(TransactionsCollectionName).Find(ctx, filter, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	transactions := []models.Transaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func (m *mongodbStore) GetTransactionByIdempotencyKey(ctx context.Context, key string) (*models.Transaction, error) {
+	filter := bson.M{"idempotency_key": key}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	transaction := &models.Transaction{}
+
+	err := m.collection(TransactionsCollectionName).FindOne(ctx, filter).Decode(transaction)
+	if err != nil {
+		return nil, mapError(err, database.ErrTransactionNotFound)
+	}
+
 	return transaction, nil
 }
 
-func (m *mongodbStore) GetUserById(userId string) (*models.User, error) {
+// GetPendingTransactions returns up to limit PENDING transactions created before createdBefore, oldest first,
+// continuing after the transaction after points at when it is set
+func (m *mongodbStore) GetPendingTransactions(ctx context.Context, createdBefore int64, after *models.TransactionCursor, limit int64) ([]models.Transaction, error) {
+	filter := bson.M{
+		"status":     models.PENDING,
+		"created_at": bson.M{"$lt": createdBefore},
+	}
+
+	// continue strictly after the cursor in (created_at, reference) ascending order
+	if after != nil {
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$gt": after.CreatedAt}},
+			bson.M{"created_at": after.CreatedAt, "reference": bson.M{"$gt": after.Reference}},
+		}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "reference", Value: 1}}).
+		SetLimit(limit)
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := m.collection(TransactionsCollectionName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := []models.Transaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// ListTransactions returns up to filter.Limit transactions of an account, newest first
+func (m *mongodbStore) ListTransactions(ctx context.Context, filter models.TransactionFilter) ([]models.Transaction, error) {
+	query := bson.M{"account_id": filter.AccountID}
+	if filter.Type != "" {
+		query["type"] = filter.Type
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	amount := bson.M{}
+	if filter.MinAmount != nil {
+		amount["$gte"] = *filter.MinAmount
+	}
+	if filter.MaxAmount != nil {
+		amount["$lte"] = *filter.MaxAmount
+	}
+	if len(amount) > 0 {
+		query["amount.minor"] = amount
+	}
+
+	createdAt := bson.M{}
+	if filter.CreatedFrom > 0 {
+		createdAt["$gte"] = filter.CreatedFrom
+	}
+	if filter.CreatedTo > 0 {
+		createdAt["$lt"] = filter.CreatedTo
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	// continue strictly after the cursor in (created_at, reference) descending order
+	if filter.After != nil {
+		query["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": filter.After.CreatedAt}},
+			bson.M{"created_at": filter.After.CreatedAt, "reference": bson.M{"$lt": filter.After.Reference}},
+		}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "reference", Value: -1}}).
+		SetLimit(filter.Limit)
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := m.collection(TransactionsCollectionName).Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions := []models.Transaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// GetDebitTotals sums the debits paid out through the payment provider from an account since dayStart and since
+// monthStart, in unix seconds, together with the holds still AUTHORIZED that may yet be captured. Failed debits, holds
+// that were voided or expired, transfers and reversals do not count. dayStart must not be before monthStart.
+func (m *mongodbStore) GetDebitTotals(ctx context.Context, accountId string, dayStart, monthStart int64) (*models.DebitTotals, error) {
+	return m.debitTotals(ctx, bson.M{"account_id": accountId}, dayStart, monthStart)
+}
+
+// GetUserDebitTotals sums the debits of all of the accounts of a user in currency as GetDebitTotals does for one
+func (m *mongodbStore) GetUserDebitTotals(ctx context.Context, userId, currency string, dayStart, monthStart int64) (*models.DebitTotals, error) {
+	return m.debitTotals(ctx, bson.M{"user_id": userId, "amount.currency": currency}, dayStart, monthStart)
+}
+
+func (m *mongodbStore) debitTotals(ctx context.Context, match bson.M, dayStart, monthStart int64) (*models.DebitTotals, error) {
+	match["type"] = models.DEBIT
+	match["status"] = bson.M{"$in": bson.A{models.AUTHORIZED, models.PENDING, models.SUCCESS, models.PARTIALLY_REVERSED, models.REVERSED}}
+	match["transfer_id"] = bson.M{"$exists": false}
+	match["original_reference"] = bson.M{"$exists": false}
+	match["created_at"] = bson.M{"$gte": monthStart}
+
+	today := bson.M{"$gte": bson.A{"$created_at", dayStart}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         nil,
+			"monthly":     bson.M{"$sum": "$amount.minor"},
+			"daily":       bson.M{"$sum": bson.M{"$cond": bson.A{today, "$amount.minor", 0}}},
+			"daily_count": bson.M{"$sum": bson.M{"$cond": bson.A{today, 1, 0}}},
+		}}},
+	}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := m.collection(TransactionsCollectionName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []models.DebitTotals{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	// nothing was debited this month
+	if len(results) == 0 {
+		return &models.DebitTotals{}, nil
+	}
+	return &results[0], nil
+}
+
+func (m *mongodbStore) GetUserById(ctx context.Context, userId string) (*models.User, error) {
 	filter := bson.M{"user_id": userId}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	user := &models.User{}
 
 	err := m.collection(UserCollection).FindOne(ctx, filter).Decode(user)
 	if err != nil {
-		return nil, err
+		return nil, mapError(err, database.ErrUserNotFound)
+	}
+
+	return user, nil
+}
+
+func (m *mongodbStore) CreateUser(ctx context.Context, user *models.User) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.collection(UserCollection).InsertOne(ctx, user)
+	return mapError(err, nil)
+}
+
+func (m *mongodbStore) CreateAccount(ctx context.Context, account *models.Account) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.collection(AccountsCollectionName).InsertOne(ctx, account)
+	return mapError(err, nil)
+}
+
+// LockUser writes to a user so that the transaction it runs in conflicts with any other one locking the user. Reads
+// alone do not conflict in MongoDB, so debits checked against the spending limits of a user across all of their
+// accounts lock the user to be checked one at a time.
+func (m *mongodbStore) LockUser(ctx context.Context, userId string) (*models.User, error) {
+	filter := bson.M{"user_id": userId}
+	update := bson.M{"$inc": bson.M{"lock_version": 1}}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	user := &models.User{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.collection(UserCollection).FindOneAndUpdate(ctx, filter, update, opts).Decode(user)
+	if err != nil {
+		return nil, mapError(err, database.ErrUserNotFound)
 	}
 
 	return user, nil
 }
+
+// SetUserTier moves a user to tier, the spending limits of the tier apply to their accounts from then on
+func (m *mongodbStore) SetUserTier(ctx context.Context, userId, tier string) (*models.User, error) {
+	filter := bson.M{"user_id": userId}
+	update := bson.M{"$set": bson.M{"tier": tier}}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	user := &models.User{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.collection(UserCollection).FindOneAndUpdate(ctx, filter, update, opts).Decode(user)
+	if err != nil {
+		return nil, mapError(err, database.ErrUserNotFound)
+	}
+
+	return user, nil
+}
+
+// GetUserAccounts returns every account of a user, oldest first
+func (m *mongodbStore) GetUserAccounts(ctx context.Context, userId string) ([]models.Account, error) {
+	filter := bson.M{"user_id": userId}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := m.collection(AccountsCollectionName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []models.Account{}
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// CloseAccount closes an open account that holds no money and has no payment in flight. It must run in a store handed
+// out by WithTx: the close then conflicts with payments recorded in the meantime, as those change the balance of the
+// account or lock it.
+func (m *mongodbStore) CloseAccount(ctx context.Context, accountId string) (*models.Account, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	pending, err := m.collection(TransactionsCollectionName).CountDocuments(ctx, bson.M{"account_id": accountId, "status": models.PENDING})
+	if err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, database.ErrAccountHasPendingPayments
+	}
+
+	filter := bson.M{
+		"account_id":    accountId,
+		"status":        bson.M{"$ne": models.CLOSED},
+		"balance.minor": 0,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":    models.CLOSED,
+			"closed_at": time.Now().Unix(),
+		},
+	}
+
+	account := &models.Account{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err = m.collection(AccountsCollectionName).FindOneAndUpdate(ctx, filter, update, opts).Decode(account)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		// work out which guard stopped the update
+		existing := &models.Account{}
+		if err := m.collection(AccountsCollectionName).FindOne(ctx, bson.M{"account_id": accountId}).Decode(existing); err != nil {
+			return nil, mapError(err, database.ErrAccountNotFound)
+		}
+		if existing.Closed() {
+			return nil, database.ErrAccountClosed
+		}
+		return nil, database.ErrAccountBalanceNotZero
+	}
+
+	return account, nil
+}
+
+// SetAccountLimits sets the spending limits of an account, nil removes them so that the limits of the tier of its
+// holder apply
+func (m *mongodbStore) SetAccountLimits(ctx context.Context, accountId string, limits *models.SpendingLimits) (*models.Account, error) {
+	filter := bson.M{"account_id": accountId}
+	update := bson.M{"$set": bson.M{"limits": limits}}
+	if limits == nil {
+		update = bson.M{"$unset": bson.M{"limits": ""}}
+	}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	account := &models.Account{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := m.collection(AccountsCollectionName).FindOneAndUpdate(ctx, filter, update, opts).Decode(account)
+	if err != nil {
+		return nil, mapError(err, database.ErrAccountNotFound)
+	}
+
+	return account, nil
+}
+
+// GetAccounts returns up to limit accounts whose ID sorts after the given one, in ID order. It is meant for jobs
+// that page through all of them such as the ledger verifier, an empty after starts from the first account.
+func (m *mongodbStore) GetAccounts(ctx context.Context, after string, limit int64) ([]models.Account, error) {
+	filter := bson.M{"account_id": bson.M{"$gt": after}}
+	opts := options.Find().SetSort(bson.D{{Key: "account_id", Value: 1}}).SetLimit(limit)
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := m.collection(AccountsCollectionName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := []models.Account{}
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+func (m *mongodbStore) CreateJournalEntry(ctx context.Context, entry *models.JournalEntry) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.collection(JournalEntriesCollectionName).InsertOne(ctx, entry)
+	return mapError(err, nil)
+}
+
+// GetJournalEntries returns up to limit journal entries whose ID sorts after the given one, in ID order, an empty
+// after starts from the first entry
+func (m *mongodbStore) GetJournalEntries(ctx context.Context, after string, limit int64) ([]models.JournalEntry, error) {
+	filter := bson.M{"entry_id": bson.M{"$gt": after}}
+	opts := options.Find().SetSort(bson.D{{Key: "entry_id", Value: 1}}).SetLimit(limit)
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := m.collection(JournalEntriesCollectionName).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []models.JournalEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetLedgerBalances sums the postings per currency of the accounts whose ID sorts after after and up to until,
+// an empty until leaves the range open ended
+func (m *mongodbStore) GetLedgerBalances(ctx context.Context, after, until string) ([]models.LedgerBalance, error) {
+	accountIds := bson.M{"$gt": after}
+	if until != "" {
+		accountIds["$lte"] = until
+	}
+
+	// the first match narrows the entries down on the postings index, the second drops the postings of the
+	// same entries that fall outside of the range
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"postings.account_id": accountIds}}},
+		{{Key: "$unwind", Value: "$postings"}},
+		{{Key: "$match", Value: bson.M{"postings.account_id": accountIds}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"account_id": "$postings.account_id",
+				"currency":   "$postings.amount.currency",
+			},
+			"minor": bson.M{"$sum": "$postings.amount.minor"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":        0,
+			"account_id": "$_id.account_id",
+			"balance": bson.M{
+				"minor":    "$minor",
+				"currency": "$_id.currency",
+			},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "account_id", Value: 1}, {Key: "balance.currency", Value: 1}}}},
+	}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	cursor, err := m.collection(JournalEntriesCollectionName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := []models.LedgerBalance{}
+	if err := cursor.All(ctx, &balances); err != nil {
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+// Ping checks that the primary of the deployment can be reached
+func (m *mongodbStore) Ping(ctx context.Context) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	return m.mongodbClient.Ping(ctx, readpref.Primary())
+}
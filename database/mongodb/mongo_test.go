@@ -1,11 +1,16 @@
 package mongodb
 
 import (
+	"consumer-payment-service/database"
 	"consumer-payment-service/models"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -13,13 +18,21 @@ import (
 
 	"github.com/ory/dockertest/v3"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	databaseName = "banking-app"
+	databaseName   = "banking-app"
+	replicaSetName = "rs0"
+	queryTimeout   = 5 * time.Second
 )
 
-var mongoDbPort = ""
+var (
+	mongoDbPort = ""
+	connectUri  = ""
+)
 
 // func makeRandomString() string {
 // 	rand.Seed(time.Now().Unix())
@@ -42,19 +55,27 @@ func TestMain(m *testing.M) {
 		log.Fatal(err)
 	}
 
-	resource, err := pool.Run("mongo", "6.0.6", []string{
-		"MONGO_INITDB_DATABASE=" + databaseName,
+	// transactions need a replica set, run a single node one
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "mongo",
+		Tag:        "6.0.6",
+		Env: []string{
+			"MONGO_INITDB_DATABASE=" + databaseName,
+		},
+		Cmd: []string{"--replSet", replicaSetName, "--bind_ip_all"},
 	})
 	if err != nil {
 		log.Fatalf("Could not start resource: %s", err)
 	}
 
 	mongoDbPort = resource.GetPort("27017/tcp")
+	connectUri = fmt.Sprintf("mongodb://localhost:%s/?directConnection=true", mongoDbPort)
 	if err := pool.Retry(func() error {
-		var err error
-		connectURL := fmt.Sprintf("mongodb://localhost:%s", mongoDbPort)
+		if err := initiateReplicaSet(connectUri); err != nil {
+			return err
+		}
 
-		_, _, err = New(connectURL, databaseName)
+		_, _, err := New(context.Background(), connectUri, databaseName, queryTimeout)
 		if err != nil {
 			return err
 		}
@@ -73,6 +94,33 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+// initiateReplicaSet turns the mongo container into a single member replica set
+func initiateReplicaSet(uri string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	config := bson.M{
+		"_id": replicaSetName,
+		"members": bson.A{
+			bson.M{"_id": 0, "host": "localhost:27017"},
+		},
+	}
+	err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetInitiate", Value: config}}).Err()
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Name == "AlreadyInitialized" {
+		return nil
+	}
+
+	return err
+}
+
 func TestMongoStore_GetAccountByID(t *testing.T) {
 	const (
 		success = iota
@@ -100,13 +148,12 @@ func TestMongoStore_GetAccountByID(t *testing.T) {
 
 		mockAccount := &models.Account{
 			AccountID: testCase.accountId,
-			Balance:   19.33,
+			Balance:   models.NewMoney(1933, "NGN"),
 			CreatedAt: time.Now().Unix(),
 		}
 
 		t.Run(testCase.name, func(t *testing.T) {
-			connectUri := "mongodb://localhost:" + mongoDbPort
-			dbStore, client, errRt := New(connectUri, databaseName)
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
 			if errRt != nil {
 				assert.Nil(t, errRt)
 				t.Fail()
@@ -122,40 +169,50 @@ func TestMongoStore_GetAccountByID(t *testing.T) {
 					t.Fail()
 				}
 
-				acc, err := dbStore.GetAccountByID(testCase.accountId)
+				acc, err := dbStore.GetAccountByID(ctx, testCase.accountId)
 				assert.NoError(t, err)
 				assert.NotNil(t, acc)
 				assert.Equal(t, mockAccount, acc)
 
 			case errorGetAccount:
-				acc, err := dbStore.GetAccountByID(testCase.accountId)
-				assert.Error(t, err)
+				acc, err := dbStore.GetAccountByID(ctx, testCase.accountId)
+				assert.ErrorIs(t, err, database.ErrAccountNotFound)
 				assert.Nil(t, acc)
 			}
 		})
 	}
 }
 
-func TestMongoStore_UpdateBalance(t *testing.T) {
+func TestMongoStore_GetUserAccount(t *testing.T) {
 	const (
 		success = iota
-		errorOccurred
+		errorNotOwned
+		errorNotFound
 	)
 
 	var tests = []struct {
 		name      string
+		userId    string
 		accountId string
 		testType  int
 	}{
 		{
-			name:      "Test update account balance successfully",
-			accountId: "accountId",
+			name:      "Test get account owned by user successfully",
+			userId:    "owner-usr-001",
+			accountId: "owned-acc-001",
 			testType:  success,
 		},
 		{
-			name:      "Test error updating balance",
+			name:      "Test error account owned by another user",
+			userId:    "other-usr-001",
+			accountId: "owned-acc-002",
+			testType:  errorNotOwned,
+		},
+		{
+			name:      "Test error account not found",
+			userId:    "owner-usr-001",
 			accountId: "invalid_id",
-			testType:  errorOccurred,
+			testType:  errorNotFound,
 		},
 	}
 
@@ -163,13 +220,13 @@ func TestMongoStore_UpdateBalance(t *testing.T) {
 
 		mockAccount := &models.Account{
 			AccountID: testCase.accountId,
-			Balance:   19.33,
+			Balance:   models.NewMoney(1933, "NGN"),
+			UserID:    "owner-usr-001",
 			CreatedAt: time.Now().Unix(),
 		}
 
 		t.Run(testCase.name, func(t *testing.T) {
-			connectUri := "mongodb://localhost:" + mongoDbPort
-			dbStore, client, errRt := New(connectUri, databaseName)
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
 			if errRt != nil {
 				assert.Nil(t, errRt)
 				t.Fail()
@@ -185,18 +242,314 @@ func TestMongoStore_UpdateBalance(t *testing.T) {
 					t.Fail()
 				}
 
-				updateErr := dbStore.UpdateAccountBalance(testCase.accountId, 20)
-				acc, accErr := dbStore.GetAccountByID(testCase.accountId)
+				acc, err := dbStore.GetUserAccount(ctx, testCase.userId, testCase.accountId)
+				assert.NoError(t, err)
+				assert.Equal(t, mockAccount, acc)
 
-				assert.NoError(t, updateErr)
-				assert.NoError(t, accErr)
-				assert.NotNil(t, acc)
-				assert.Equal(t, float64(20), acc.Balance)
+			case errorNotOwned:
+				_, err := client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, mockAccount)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
 
-			case errorOccurred:
-				_ = client.Disconnect(ctx)
-				err := dbStore.UpdateAccountBalance(testCase.accountId, 20)
-				assert.Error(t, err)
+				acc, err := dbStore.GetUserAccount(ctx, testCase.userId, testCase.accountId)
+				assert.ErrorIs(t, err, database.ErrAccountNotOwned)
+				assert.Nil(t, acc)
+
+			case errorNotFound:
+				acc, err := dbStore.GetUserAccount(ctx, testCase.userId, testCase.accountId)
+				assert.ErrorIs(t, err, database.ErrAccountNotFound)
+				assert.Nil(t, acc)
+			}
+		})
+	}
+}
+
+func TestMongoStore_AdjustAccountBalance(t *testing.T) {
+	const (
+		successCredit = iota
+		successDebit
+		errorInsufficientFunds
+		errorCurrencyMismatch
+		errorAccountClosed
+		errorAccountNotFound
+	)
+
+	var tests = []struct {
+		name      string
+		accountId string
+		amount    models.Money
+		testType  int
+	}{
+		{
+			name:      "Test credit account balance successfully",
+			accountId: "adjust-acc-001",
+			amount:    models.NewMoney(500, "NGN"),
+			testType:  successCredit,
+		},
+		{
+			name:      "Test debit account balance successfully",
+			accountId: "adjust-acc-002",
+			amount:    models.NewMoney(-500, "NGN"),
+			testType:  successDebit,
+		},
+		{
+			name:      "Test error debit exceeding balance",
+			accountId: "adjust-acc-003",
+			amount:    models.NewMoney(-2500, "NGN"),
+			testType:  errorInsufficientFunds,
+		},
+		{
+			name:      "Test error adjusting balance in another currency",
+			accountId: "adjust-acc-004",
+			amount:    models.NewMoney(500, "USD"),
+			testType:  errorCurrencyMismatch,
+		},
+		{
+			name:      "Test error adjusting closed account",
+			accountId: "adjust-acc-005",
+			amount:    models.NewMoney(500, "NGN"),
+			testType:  errorAccountClosed,
+		},
+		{
+			name:      "Test error adjusting unknown account",
+			accountId: "invalid_id",
+			amount:    models.NewMoney(-500, "NGN"),
+			testType:  errorAccountNotFound,
+		},
+	}
+
+	for _, testCase := range tests {
+
+		mockAccount := &models.Account{
+			AccountID: testCase.accountId,
+			Balance:   models.NewMoney(2000, "NGN"),
+			Available: models.NewMoney(2000, "NGN"),
+			CreatedAt: time.Now().Unix(),
+		}
+
+		t.Run(testCase.name, func(t *testing.T) {
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+			if errRt != nil {
+				assert.Nil(t, errRt)
+				t.Fail()
+			}
+			assert.NotNil(t, client)
+			ctx := context.Background()
+
+			switch testCase.testType {
+			case successCredit, successDebit:
+				_, err := client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, mockAccount)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
+
+				acc, err := dbStore.AdjustAccountBalance(ctx, testCase.accountId, testCase.amount)
+				assert.NoError(t, err)
+				assert.Equal(t, mockAccount.Balance.Minor+testCase.amount.Minor, acc.Balance.Minor)
+				assert.Equal(t, mockAccount.Available.Minor+testCase.amount.Minor, acc.Available.Minor)
+
+			case errorInsufficientFunds:
+				_, err := client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, mockAccount)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
+
+				acc, err := dbStore.AdjustAccountBalance(ctx, testCase.accountId, testCase.amount)
+				assert.ErrorIs(t, err, database.ErrInsufficientFunds)
+				assert.Nil(t, acc)
+
+				acc, err = dbStore.GetAccountByID(ctx, testCase.accountId)
+				assert.NoError(t, err)
+				assert.Equal(t, mockAccount.Balance, acc.Balance)
+
+			case errorCurrencyMismatch:
+				_, err := client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, mockAccount)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
+
+				acc, err := dbStore.AdjustAccountBalance(ctx, testCase.accountId, testCase.amount)
+				assert.ErrorIs(t, err, database.ErrCurrencyMismatch)
+				assert.Nil(t, acc)
+
+			case errorAccountClosed:
+				mockAccount.Status = models.CLOSED
+				_, err := client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, mockAccount)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
+
+				acc, err := dbStore.AdjustAccountBalance(ctx, testCase.accountId, testCase.amount)
+				assert.ErrorIs(t, err, database.ErrAccountClosed)
+				assert.Nil(t, acc)
+
+			case errorAccountNotFound:
+				acc, err := dbStore.AdjustAccountBalance(ctx, testCase.accountId, testCase.amount)
+				assert.ErrorIs(t, err, database.ErrAccountNotFound)
+				assert.Nil(t, acc)
+			}
+		})
+	}
+}
+
+func TestMongoStore_AdjustAccountBalance_ConcurrentDebits(t *testing.T) {
+	const (
+		accountId      = "concurrent-acc-001"
+		openingBalance = 300
+		debits         = 500
+	)
+
+	dbStore, client, err := New(context.Background(), connectUri, databaseName, queryTimeout)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, &models.Account{
+		AccountID: accountId,
+		Balance:   models.NewMoney(openingBalance, "NGN"),
+		Available: models.NewMoney(openingBalance, "NGN"),
+		CreatedAt: time.Now().Unix(),
+	})
+	assert.NoError(t, err)
+
+	var (
+		wg           sync.WaitGroup
+		succeeded    atomic.Int64
+		insufficient atomic.Int64
+	)
+
+	for i := 0; i < debits; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := dbStore.AdjustAccountBalance(ctx, accountId, models.NewMoney(-1, "NGN"))
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, database.ErrInsufficientFunds):
+				insufficient.Add(1)
+			default:
+				t.Errorf("unexpected error debiting account %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	acc, err := dbStore.GetAccountByID(ctx, accountId)
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(0, "NGN"), acc.Balance)
+	assert.Equal(t, int64(openingBalance), succeeded.Load())
+	assert.Equal(t, int64(debits-openingBalance), insufficient.Load())
+}
+
+func TestMongoStore_WithTx(t *testing.T) {
+	const (
+		success = iota
+		errorRollback
+	)
+
+	var tests = []struct {
+		name      string
+		accountId string
+		reference string
+		testType  int
+	}{
+		{
+			name:      "Test transaction record and balance change commit together",
+			accountId: "tx-acc-001",
+			reference: "tx-ref-001",
+			testType:  success,
+		},
+		{
+			name:      "Test transaction record and balance change roll back together",
+			accountId: "tx-acc-002",
+			reference: "tx-ref-002",
+			testType:  errorRollback,
+		},
+	}
+
+	for _, testCase := range tests {
+
+		mockAccount := &models.Account{
+			AccountID: testCase.accountId,
+			Balance:   models.NewMoney(2000, "NGN"),
+			Available: models.NewMoney(2000, "NGN"),
+			CreatedAt: time.Now().Unix(),
+		}
+
+		mockTransaction := &models.Transaction{
+			UserID:    "usr-0001",
+			AccountID: testCase.accountId,
+			Amount:    models.NewMoney(500, "NGN"),
+			Reference: testCase.reference,
+			Type:      models.CREDIT,
+			Status:    models.SUCCESS,
+			CreatedAt: time.Now().Unix(),
+		}
+
+		t.Run(testCase.name, func(t *testing.T) {
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+			if errRt != nil {
+				assert.Nil(t, errRt)
+				t.Fail()
+			}
+			assert.NotNil(t, client)
+			ctx := context.Background()
+
+			_, err := client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, mockAccount)
+			if err != nil {
+				assert.NoError(t, err)
+				t.Fail()
+			}
+
+			switch testCase.testType {
+			case success:
+				err := dbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+					if err := store.CreateTransaction(ctx, mockTransaction); err != nil {
+						return err
+					}
+
+					_, err := store.AdjustAccountBalance(ctx, testCase.accountId, mockTransaction.Amount)
+					return err
+				})
+				assert.NoError(t, err)
+
+				transaction, err := dbStore.GetPaymentByReferenceId(ctx, testCase.reference)
+				assert.NoError(t, err)
+				assert.Equal(t, mockTransaction, transaction)
+
+				acc, err := dbStore.GetAccountByID(ctx, testCase.accountId)
+				assert.NoError(t, err)
+				assert.Equal(t, models.NewMoney(2500, "NGN"), acc.Balance)
+
+			case errorRollback:
+				rollbackErr := errors.New("rollback")
+				err := dbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+					if err := store.CreateTransaction(ctx, mockTransaction); err != nil {
+						return err
+					}
+
+					if _, err := store.AdjustAccountBalance(ctx, testCase.accountId, mockTransaction.Amount); err != nil {
+						return err
+					}
+
+					return rollbackErr
+				})
+				assert.ErrorIs(t, err, rollbackErr)
+
+				transaction, err := dbStore.GetPaymentByReferenceId(ctx, testCase.reference)
+				assert.ErrorIs(t, err, database.ErrTransactionNotFound)
+				assert.Nil(t, transaction)
+
+				acc, err := dbStore.GetAccountByID(ctx, testCase.accountId)
+				assert.NoError(t, err)
+				assert.Equal(t, mockAccount.Balance, acc.Balance)
 			}
 		})
 	}
@@ -227,7 +580,7 @@ func TestMongoStore_CreateTransaction(t *testing.T) {
 		mockTransaction := &models.Transaction{
 			UserID:    "usr-0001",
 			AccountID: "acc-0001",
-			Amount:    2.5,
+			Amount:    models.NewMoney(250, "NGN"),
 			Reference: "rand-ref",
 			Type:      models.CREDIT,
 			Status:    models.SUCCESS,
@@ -235,8 +588,7 @@ func TestMongoStore_CreateTransaction(t *testing.T) {
 		}
 
 		t.Run(testCase.name, func(t *testing.T) {
-			connectUri := "mongodb://localhost:" + mongoDbPort
-			dbStore, client, errRt := New(connectUri, databaseName)
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
 			if errRt != nil {
 				assert.Nil(t, errRt)
 				t.Fail()
@@ -246,12 +598,15 @@ func TestMongoStore_CreateTransaction(t *testing.T) {
 
 			switch testCase.testType {
 			case success:
-				err := dbStore.CreateTransaction(mockTransaction)
+				err := dbStore.CreateTransaction(ctx, mockTransaction)
 				assert.NoError(t, err)
 
+				err = dbStore.CreateTransaction(ctx, mockTransaction)
+				assert.ErrorIs(t, err, database.ErrDuplicateReference)
+
 			case errorOccurred:
 				_ = client.Disconnect(ctx)
-				err := dbStore.CreateTransaction(mockTransaction)
+				err := dbStore.CreateTransaction(ctx, mockTransaction)
 				assert.Error(t, err)
 			}
 		})
@@ -284,8 +639,7 @@ func TestMongoStore_GetTransactionByReference(t *testing.T) {
 	for _, testCase := range tests {
 
 		t.Run(testCase.name, func(t *testing.T) {
-			connectUri := "mongodb://localhost:" + mongoDbPort
-			dbStore, client, errRt := New(connectUri, databaseName)
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
 			if errRt != nil {
 				assert.Nil(t, errRt)
 				t.Fail()
@@ -296,7 +650,7 @@ func TestMongoStore_GetTransactionByReference(t *testing.T) {
 			mockTransaction := &models.Transaction{
 				UserID:    "usr-0001",
 				AccountID: "acc-0001",
-				Amount:    2.5,
+				Amount:    models.NewMoney(250, "NGN"),
 				Reference: testCase.reference,
 				Type:      models.CREDIT,
 				Status:    models.SUCCESS,
@@ -311,48 +665,53 @@ func TestMongoStore_GetTransactionByReference(t *testing.T) {
 					t.Fail()
 				}
 
-				transaction, err := dbStore.GetPaymentByReferenceId(testCase.reference)
+				transaction, err := dbStore.GetPaymentByReferenceId(ctx, testCase.reference)
 				assert.NoError(t, err)
 				assert.NotNil(t, transaction)
 				assert.Equal(t, mockTransaction, transaction)
 
 			case errorNotFound:
-				transaction, err := dbStore.GetPaymentByReferenceId(testCase.reference)
-				assert.Error(t, err)
+				transaction, err := dbStore.GetPaymentByReferenceId(ctx, testCase.reference)
+				assert.ErrorIs(t, err, database.ErrTransactionNotFound)
 				assert.Nil(t, transaction)
 			}
 		})
 	}
 }
 
-func TestMongoStore_GetUserById(t *testing.T) {
+func TestMongoStore_UpdateTransactionStatus(t *testing.T) {
 	const (
 		success = iota
 		errorNotFound
+		errorNotPending
 	)
 
 	var tests = []struct {
-		name     string
-		userID   string
-		testType int
+		name      string
+		reference string
+		testType  int
 	}{
 		{
-			name:     "Test get user successfully",
-			userID:   "usr-001",
-			testType: success,
+			name:      "Test update transaction status successfully",
+			reference: "trans-ref-002",
+			testType:  success,
 		},
 		{
-			name:     "Test error get user",
-			userID:   "invalid-usr",
-			testType: errorNotFound,
+			name:      "Test error updating unknown transaction",
+			reference: "unknown-ref",
+			testType:  errorNotFound,
+		},
+		{
+			name:      "Test error updating transaction that is no longer pending",
+			reference: "trans-ref-003",
+			testType:  errorNotPending,
 		},
 	}
 
 	for _, testCase := range tests {
 
 		t.Run(testCase.name, func(t *testing.T) {
-			connectUri := "mongodb://localhost:" + mongoDbPort
-			dbStore, client, errRt := New(connectUri, databaseName)
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
 			if errRt != nil {
 				assert.Nil(t, errRt)
 				t.Fail()
@@ -360,30 +719,1070 @@ func TestMongoStore_GetUserById(t *testing.T) {
 			assert.NotNil(t, client)
 			ctx := context.Background()
 
-			mockUser := &models.User{
-				Id:        testCase.userID,
-				Name:      "name",
+			mockTransaction := &models.Transaction{
+				UserID:    "usr-0001",
+				AccountID: "acc-0001",
+				Amount:    models.NewMoney(250, "NGN"),
+				Reference: testCase.reference,
+				Type:      models.CREDIT,
+				Status:    models.PENDING,
 				CreatedAt: time.Now().Unix(),
 			}
 
 			switch testCase.testType {
 			case success:
-				_, err := client.Database(databaseName).Collection(UserCollection).InsertOne(ctx, mockUser)
+				_, err := client.Database(databaseName).Collection(TransactionsCollectionName).InsertOne(ctx, mockTransaction)
 				if err != nil {
 					assert.NoError(t, err)
 					t.Fail()
 				}
 
-				user, err := dbStore.GetUserById(testCase.userID)
+				err = dbStore.UpdateTransactionStatus(ctx, testCase.reference, models.FAILED)
 				assert.NoError(t, err)
-				assert.NotNil(t, user)
-				assert.Equal(t, mockUser, user)
+
+				transaction, err := dbStore.GetPaymentByReferenceId(ctx, testCase.reference)
+				assert.NoError(t, err)
+				assert.Equal(t, models.FAILED, transaction.Status)
 
 			case errorNotFound:
-				user, err := dbStore.GetUserById(testCase.userID)
-				assert.Error(t, err)
-				assert.Nil(t, user)
+				err := dbStore.UpdateTransactionStatus(ctx, testCase.reference, models.FAILED)
+				assert.ErrorIs(t, err, database.ErrTransactionNotFound)
+
+			case errorNotPending:
+				mockTransaction.Status = models.SUCCESS
+				_, err := client.Database(databaseName).Collection(TransactionsCollectionName).InsertOne(ctx, mockTransaction)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
+
+				err = dbStore.UpdateTransactionStatus(ctx, testCase.reference, models.FAILED)
+				assert.ErrorIs(t, err, database.ErrTransactionNotPending)
+
+				transaction, err := dbStore.GetPaymentByReferenceId(ctx, testCase.reference)
+				assert.NoError(t, err)
+				assert.Equal(t, models.SUCCESS, transaction.Status)
 			}
 		})
 	}
 }
+
+func TestMongoStore_FailTransaction(t *testing.T) {
+	const (
+		success = iota
+		errorNotFound
+	)
+
+	var tests = []struct {
+		name      string
+		reference string
+		testType  int
+	}{
+		{
+			name:      "Test fail transaction successfully",
+			reference: "trans-ref-fail-001",
+			testType:  success,
+		},
+		{
+			name:      "Test error failing unknown transaction",
+			reference: "unknown-ref",
+			testType:  errorNotFound,
+		},
+	}
+
+	for _, testCase := range tests {
+
+		t.Run(testCase.name, func(t *testing.T) {
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+			if errRt != nil {
+				assert.Nil(t, errRt)
+				t.Fail()
+			}
+			assert.NotNil(t, client)
+			ctx := context.Background()
+
+			mockTransaction := &models.Transaction{
+				UserID:    "usr-0001",
+				AccountID: "acc-0001",
+				Amount:    models.NewMoney(250, "NGN"),
+				Reference: testCase.reference,
+				Type:      models.CREDIT,
+				Status:    models.PENDING,
+				CreatedAt: time.Now().Unix(),
+			}
+
+			switch testCase.testType {
+			case success:
+				_, err := client.Database(databaseName).Collection(TransactionsCollectionName).InsertOne(ctx, mockTransaction)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
+
+				err = dbStore.FailTransaction(ctx, testCase.reference, "transaction failed", 422, "insufficient_funds")
+				assert.NoError(t, err)
+
+				transaction, err := dbStore.GetPaymentByReferenceId(ctx, testCase.reference)
+				assert.NoError(t, err)
+				assert.Equal(t, models.FAILED, transaction.Status)
+				assert.Equal(t, "transaction failed", transaction.FailureReason)
+				assert.Equal(t, 422, transaction.ProviderStatusCode)
+				assert.Equal(t, "insufficient_funds", transaction.FailureKind)
+
+			case errorNotFound:
+				err := dbStore.FailTransaction(ctx, testCase.reference, "transaction failed", 422, "insufficient_funds")
+				assert.ErrorIs(t, err, database.ErrTransactionNotFound)
+			}
+		})
+	}
+}
+
+func TestMongoStore_AdjustReversedAmount(t *testing.T) {
+	const (
+		successPartialThenFull = iota
+		successRelease
+		errorExceedsAmount
+		errorNotReversible
+		errorNotFound
+	)
+
+	var tests = []struct {
+		name      string
+		reference string
+		testType  int
+	}{
+		{
+			name:      "Test reverse part then the rest of a payment successfully",
+			reference: "reverse-ref-001",
+			testType:  successPartialThenFull,
+		},
+		{
+			name:      "Test release a reversal successfully",
+			reference: "reverse-ref-002",
+			testType:  successRelease,
+		},
+		{
+			name:      "Test error reversals exceeding the payment amount",
+			reference: "reverse-ref-003",
+			testType:  errorExceedsAmount,
+		},
+		{
+			name:      "Test error reversing pending payment",
+			reference: "reverse-ref-004",
+			testType:  errorNotReversible,
+		},
+		{
+			name:      "Test error reversing unknown payment",
+			reference: "unknown-ref",
+			testType:  errorNotFound,
+		},
+	}
+
+	for _, testCase := range tests {
+
+		t.Run(testCase.name, func(t *testing.T) {
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+			if errRt != nil {
+				assert.Nil(t, errRt)
+				t.Fail()
+			}
+			assert.NotNil(t, client)
+			ctx := context.Background()
+
+			mockTransaction := &models.Transaction{
+				UserID:    "usr-0001",
+				AccountID: "acc-0001",
+				Amount:    models.NewMoney(1000, "NGN"),
+				Reference: testCase.reference,
+				Type:      models.CREDIT,
+				Status:    models.SUCCESS,
+				CreatedAt: time.Now().Unix(),
+			}
+			if testCase.testType == errorNotReversible {
+				mockTransaction.Status = models.PENDING
+			}
+			if testCase.testType != errorNotFound {
+				_, err := client.Database(databaseName).Collection(TransactionsCollectionName).InsertOne(ctx, mockTransaction)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
+			}
+
+			switch testCase.testType {
+			case successPartialThenFull:
+				transaction, err := dbStore.AdjustReversedAmount(ctx, testCase.reference, models.NewMoney(400, "NGN"))
+				assert.NoError(t, err)
+				assert.Equal(t, models.PARTIALLY_REVERSED, transaction.Status)
+				assert.Equal(t, &models.Money{Minor: 400, Currency: "NGN"}, transaction.ReversedAmount)
+
+				transaction, err = dbStore.AdjustReversedAmount(ctx, testCase.reference, models.NewMoney(600, "NGN"))
+				assert.NoError(t, err)
+				assert.Equal(t, models.REVERSED, transaction.Status)
+				assert.Equal(t, &models.Money{Minor: 1000, Currency: "NGN"}, transaction.ReversedAmount)
+
+			case successRelease:
+				_, err := dbStore.AdjustReversedAmount(ctx, testCase.reference, models.NewMoney(1000, "NGN"))
+				assert.NoError(t, err)
+
+				transaction, err := dbStore.AdjustReversedAmount(ctx, testCase.reference, models.NewMoney(-1000, "NGN"))
+				assert.NoError(t, err)
+				assert.Equal(t, models.SUCCESS, transaction.Status)
+				assert.Equal(t, int64(0), transaction.ReversedAmount.Minor)
+
+			case errorExceedsAmount:
+				_, err := dbStore.AdjustReversedAmount(ctx, testCase.reference, models.NewMoney(700, "NGN"))
+				assert.NoError(t, err)
+
+				transaction, err := dbStore.AdjustReversedAmount(ctx, testCase.reference, models.NewMoney(301, "NGN"))
+				assert.ErrorIs(t, err, database.ErrReversalExceedsAmount)
+				assert.Nil(t, transaction)
+
+			case errorNotReversible:
+				transaction, err := dbStore.AdjustReversedAmount(ctx, testCase.reference, models.NewMoney(100, "NGN"))
+				assert.ErrorIs(t, err, database.ErrTransactionNotReversible)
+				assert.Nil(t, transaction)
+
+			case errorNotFound:
+				transaction, err := dbStore.AdjustReversedAmount(ctx, testCase.reference, models.NewMoney(100, "NGN"))
+				assert.ErrorIs(t, err, database.ErrTransactionNotFound)
+				assert.Nil(t, transaction)
+			}
+		})
+	}
+}
+
+func TestMongoStore_Holds(t *testing.T) {
+	dbStore, client, err := New(context.Background(), connectUri, databaseName, queryTimeout)
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	const accountId = "hold-acc-001"
+	_, err = client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, &models.Account{
+		AccountID: accountId,
+		Balance:   models.NewMoney(2000, "NGN"),
+		Available: models.NewMoney(2000, "NGN"),
+		CreatedAt: time.Now().Unix(),
+	})
+	assert.NoError(t, err)
+
+	// holds only move the available balance and cannot take it below zero
+	acc, err := dbStore.AdjustAvailableBalance(ctx, accountId, models.NewMoney(-1500, "NGN"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(2000, "NGN"), acc.Balance)
+	assert.Equal(t, models.NewMoney(500, "NGN"), acc.Available)
+
+	_, err = dbStore.AdjustAvailableBalance(ctx, accountId, models.NewMoney(-501, "NGN"))
+	assert.ErrorIs(t, err, database.ErrInsufficientFunds)
+
+	// debits are limited by the available balance rather than the ledger balance
+	_, err = dbStore.AdjustAccountBalance(ctx, accountId, models.NewMoney(-501, "NGN"))
+	assert.ErrorIs(t, err, database.ErrInsufficientFunds)
+
+	now := time.Now().Unix()
+	holds := []models.Transaction{
+		{Reference: "hold-ref-001", AccountID: accountId, Amount: models.NewMoney(1000, "NGN"), Type: models.DEBIT, Status: models.AUTHORIZED, ExpiresAt: now + 3600, CreatedAt: now},
+		{Reference: "hold-ref-002", AccountID: accountId, Amount: models.NewMoney(300, "NGN"), Type: models.DEBIT, Status: models.AUTHORIZED, ExpiresAt: now + 3600, CreatedAt: now},
+		{Reference: "hold-ref-003", AccountID: accountId, Amount: models.NewMoney(200, "NGN"), Type: models.DEBIT, Status: models.AUTHORIZED, ExpiresAt: now - 60, CreatedAt: now - 3600},
+	}
+	for i := range holds {
+		assert.NoError(t, dbStore.CreateTransaction(ctx, &holds[i]))
+	}
+
+	_, err = dbStore.CaptureHold(ctx, "hold-ref-001", models.NewMoney(1001, "NGN"))
+	assert.ErrorIs(t, err, database.ErrCaptureExceedsHold)
+
+	_, err = dbStore.CaptureHold(ctx, "hold-ref-001", models.NewMoney(400, "USD"))
+	assert.ErrorIs(t, err, database.ErrCurrencyMismatch)
+
+	_, err = dbStore.CaptureHold(ctx, "hold-ref-003", models.NewMoney(200, "NGN"))
+	assert.ErrorIs(t, err, database.ErrHoldNotActive)
+
+	_, err = dbStore.CaptureHold(ctx, "hold-ref-404", models.NewMoney(200, "NGN"))
+	assert.ErrorIs(t, err, database.ErrTransactionNotFound)
+
+	capture, err := dbStore.CaptureHold(ctx, "hold-ref-001", models.NewMoney(400, "NGN"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.PENDING, capture.Status)
+	assert.Equal(t, models.NewMoney(400, "NGN"), capture.Amount)
+	assert.Equal(t, models.NewMoney(1000, "NGN"), *capture.AuthorizedAmount)
+
+	// a captured authorization can be neither captured again nor voided
+	_, err = dbStore.CaptureHold(ctx, "hold-ref-001", models.NewMoney(400, "NGN"))
+	assert.ErrorIs(t, err, database.ErrHoldNotActive)
+
+	_, err = dbStore.ReleaseHold(ctx, "hold-ref-001", models.VOIDED)
+	assert.ErrorIs(t, err, database.ErrHoldNotActive)
+
+	voided, err := dbStore.ReleaseHold(ctx, "hold-ref-002", models.VOIDED)
+	assert.NoError(t, err)
+	assert.Equal(t, models.VOIDED, voided.Status)
+
+	_, err = dbStore.ReleaseHold(ctx, "hold-ref-404", models.VOIDED)
+	assert.ErrorIs(t, err, database.ErrTransactionNotFound)
+
+	expired, err := dbStore.GetExpiredHolds(ctx, now, nil, 10)
+	assert.NoError(t, err)
+	assert.Len(t, expired, 1)
+	assert.Equal(t, "hold-ref-003", expired[0].Reference)
+
+	expired, err = dbStore.GetExpiredHolds(ctx, now, &models.TransactionCursor{CreatedAt: now - 3600, Reference: "hold-ref-003"}, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, expired)
+}
+
+func TestMongoStore_GetTransactionByIdempotencyKey(t *testing.T) {
+	const (
+		success = iota
+		errorNotFound
+	)
+
+	var tests = []struct {
+		name     string
+		key      string
+		testType int
+	}{
+		{
+			name:     "Test get transaction by idempotency key successfully",
+			key:      "idem-key-001",
+			testType: success,
+		},
+		{
+			name:     "Test error get transaction by unknown idempotency key",
+			key:      "unknown-key",
+			testType: errorNotFound,
+		},
+	}
+
+	for _, testCase := range tests {
+
+		t.Run(testCase.name, func(t *testing.T) {
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+			if errRt != nil {
+				assert.Nil(t, errRt)
+				t.Fail()
+			}
+			assert.NotNil(t, client)
+			ctx := context.Background()
+
+			mockTransaction := &models.Transaction{
+				UserID:         "usr-0001",
+				AccountID:      "acc-0001",
+				Amount:         models.NewMoney(250, "NGN"),
+				Reference:      "idem-ref-001",
+				Type:           models.DEBIT,
+				Status:         models.SUCCESS,
+				IdempotencyKey: testCase.key,
+				RequestHash:    "hash",
+				CreatedAt:      time.Now().Unix(),
+			}
+
+			switch testCase.testType {
+			case success:
+				err := dbStore.CreateTransaction(ctx, mockTransaction)
+				assert.NoError(t, err)
+
+				transaction, err := dbStore.GetTransactionByIdempotencyKey(ctx, testCase.key)
+				assert.NoError(t, err)
+				assert.Equal(t, mockTransaction, transaction)
+
+			case errorNotFound:
+				transaction, err := dbStore.GetTransactionByIdempotencyKey(ctx, testCase.key)
+				assert.ErrorIs(t, err, database.ErrTransactionNotFound)
+				assert.Nil(t, transaction)
+			}
+		})
+	}
+}
+
+func TestMongoStore_GetPendingTransactions(t *testing.T) {
+	dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+	if errRt != nil {
+		assert.Nil(t, errRt)
+		t.Fail()
+	}
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	now := time.Now().Unix()
+	mockTransactions := []interface{}{
+		&models.Transaction{Reference: "pending-ref-001", Status: models.PENDING, Amount: models.NewMoney(100, "NGN"), CreatedAt: now - 600},
+		&models.Transaction{Reference: "pending-ref-002", Status: models.PENDING, Amount: models.NewMoney(100, "NGN"), CreatedAt: now - 900},
+		&models.Transaction{Reference: "pending-ref-003", Status: models.PENDING, Amount: models.NewMoney(100, "NGN"), CreatedAt: now},
+		&models.Transaction{Reference: "pending-ref-004", Status: models.SUCCESS, Amount: models.NewMoney(100, "NGN"), CreatedAt: now - 900},
+	}
+	_, err := client.Database(databaseName).Collection(TransactionsCollectionName).InsertMany(ctx, mockTransactions)
+	if err != nil {
+		assert.NoError(t, err)
+		t.Fail()
+	}
+
+	transactions, err := dbStore.GetPendingTransactions(ctx, now-60, nil, 10)
+	assert.NoError(t, err)
+
+	references := []string{}
+	for _, transaction := range transactions {
+		if strings.HasPrefix(transaction.Reference, "pending-ref-") {
+			references = append(references, transaction.Reference)
+		}
+	}
+	assert.Equal(t, []string{"pending-ref-002", "pending-ref-001"}, references)
+
+	transactions, err = dbStore.GetPendingTransactions(ctx, now-60, nil, 1)
+	assert.NoError(t, err)
+	assert.Len(t, transactions, 1)
+
+	// continue after pending-ref-002 which is the oldest
+	transactions, err = dbStore.GetPendingTransactions(ctx, now-60, &models.TransactionCursor{CreatedAt: now - 900, Reference: "pending-ref-002"}, 10)
+	assert.NoError(t, err)
+
+	references = []string{}
+	for _, transaction := range transactions {
+		if strings.HasPrefix(transaction.Reference, "pending-ref-") {
+			references = append(references, transaction.Reference)
+		}
+	}
+	assert.Equal(t, []string{"pending-ref-001"}, references)
+}
+
+func TestMongoStore_ListTransactions(t *testing.T) {
+	dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+	if errRt != nil {
+		assert.Nil(t, errRt)
+		t.Fail()
+	}
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	mockTransactions := []interface{}{
+		&models.Transaction{Reference: "history-ref-001", AccountID: "history-acc", Type: models.CREDIT, Status: models.SUCCESS, Amount: models.NewMoney(100, "NGN"), CreatedAt: 1700000100},
+		&models.Transaction{Reference: "history-ref-002", AccountID: "history-acc", Type: models.DEBIT, Status: models.SUCCESS, Amount: models.NewMoney(500, "NGN"), CreatedAt: 1700000200},
+		&models.Transaction{Reference: "history-ref-003", AccountID: "history-acc", Type: models.DEBIT, Status: models.FAILED, Amount: models.NewMoney(900, "NGN"), CreatedAt: 1700000200},
+		&models.Transaction{Reference: "history-ref-004", AccountID: "history-acc", Type: models.CREDIT, Status: models.PENDING, Amount: models.NewMoney(1000, "NGN"), CreatedAt: 1700000300},
+		&models.Transaction{Reference: "history-ref-005", AccountID: "other-acc", Type: models.CREDIT, Status: models.SUCCESS, Amount: models.NewMoney(100, "NGN"), CreatedAt: 1700000400},
+	}
+	_, err := client.Database(databaseName).Collection(TransactionsCollectionName).InsertMany(ctx, mockTransactions)
+	if err != nil {
+		assert.NoError(t, err)
+		t.Fail()
+	}
+
+	references := func(transactions []models.Transaction) []string {
+		result := []string{}
+		for _, transaction := range transactions {
+			result = append(result, transaction.Reference)
+		}
+		return result
+	}
+
+	minAmount, maxAmount := int64(200), int64(900)
+
+	testCases := []struct {
+		name               string
+		filter             models.TransactionFilter
+		expectedReferences []string
+	}{
+		{
+			name:               "Test newest first",
+			filter:             models.TransactionFilter{AccountID: "history-acc", Limit: 10},
+			expectedReferences: []string{"history-ref-004", "history-ref-003", "history-ref-002", "history-ref-001"},
+		},
+		{
+			name:               "Test limit",
+			filter:             models.TransactionFilter{AccountID: "history-acc", Limit: 2},
+			expectedReferences: []string{"history-ref-004", "history-ref-003"},
+		},
+		{
+			name: "Test after cursor in the same second",
+			filter: models.TransactionFilter{
+				AccountID: "history-acc",
+				After:     &models.TransactionCursor{CreatedAt: 1700000200, Reference: "history-ref-003"},
+				Limit:     10,
+			},
+			expectedReferences: []string{"history-ref-002", "history-ref-001"},
+		},
+		{
+			name:               "Test type and status",
+			filter:             models.TransactionFilter{AccountID: "history-acc", Type: models.DEBIT, Status: models.SUCCESS, Limit: 10},
+			expectedReferences: []string{"history-ref-002"},
+		},
+		{
+			name:               "Test amount range",
+			filter:             models.TransactionFilter{AccountID: "history-acc", MinAmount: &minAmount, MaxAmount: &maxAmount, Limit: 10},
+			expectedReferences: []string{"history-ref-003", "history-ref-002"},
+		},
+		{
+			name:               "Test created_at window",
+			filter:             models.TransactionFilter{AccountID: "history-acc", CreatedFrom: 1700000200, CreatedTo: 1700000300, Limit: 10},
+			expectedReferences: []string{"history-ref-003", "history-ref-002"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			transactions, err := dbStore.ListTransactions(ctx, testCase.filter)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedReferences, references(transactions))
+		})
+	}
+}
+
+func TestMongoStore_GetUserById(t *testing.T) {
+	const (
+		success = iota
+		errorNotFound
+	)
+
+	var tests = []struct {
+		name     string
+		userID   string
+		testType int
+	}{
+		{
+			name:     "Test get user successfully",
+			userID:   "usr-001",
+			testType: success,
+		},
+		{
+			name:     "Test error get user",
+			userID:   "invalid-usr",
+			testType: errorNotFound,
+		},
+	}
+
+	for _, testCase := range tests {
+
+		t.Run(testCase.name, func(t *testing.T) {
+			dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+			if errRt != nil {
+				assert.Nil(t, errRt)
+				t.Fail()
+			}
+			assert.NotNil(t, client)
+			ctx := context.Background()
+
+			mockUser := &models.User{
+				Id:        testCase.userID,
+				Name:      "name",
+				CreatedAt: time.Now().Unix(),
+			}
+
+			switch testCase.testType {
+			case success:
+				_, err := client.Database(databaseName).Collection(UserCollection).InsertOne(ctx, mockUser)
+				if err != nil {
+					assert.NoError(t, err)
+					t.Fail()
+				}
+
+				user, err := dbStore.GetUserById(ctx, testCase.userID)
+				assert.NoError(t, err)
+				assert.NotNil(t, user)
+				assert.Equal(t, mockUser, user)
+
+			case errorNotFound:
+				user, err := dbStore.GetUserById(ctx, testCase.userID)
+				assert.ErrorIs(t, err, database.ErrUserNotFound)
+				assert.Nil(t, user)
+			}
+		})
+	}
+}
+
+func TestMongoStore_CreateUserAndAccounts(t *testing.T) {
+	dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+	if errRt != nil {
+		assert.Nil(t, errRt)
+		t.Fail()
+	}
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	mockUser := &models.User{Id: "created-usr-001", Name: "Ada Lovelace", CreatedAt: time.Now().Unix()}
+	assert.NoError(t, dbStore.CreateUser(ctx, mockUser))
+	assert.ErrorIs(t, dbStore.CreateUser(ctx, mockUser), database.ErrDuplicateReference)
+
+	user, err := dbStore.GetUserById(ctx, mockUser.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, mockUser, user)
+
+	mockAccounts := []models.Account{
+		{AccountID: "created-acc-001", Balance: models.NewMoney(0, "NGN"), UserID: mockUser.Id, Status: models.ACTIVE, CreatedAt: 1700000100},
+		{AccountID: "created-acc-002", Balance: models.NewMoney(0, "USD"), UserID: mockUser.Id, Status: models.ACTIVE, CreatedAt: 1700000200},
+	}
+	for i := range mockAccounts {
+		assert.NoError(t, dbStore.CreateAccount(ctx, &mockAccounts[i]))
+	}
+
+	accounts, err := dbStore.GetUserAccounts(ctx, mockUser.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, mockAccounts, accounts)
+
+	accounts, err = dbStore.GetUserAccounts(ctx, "created-usr-002")
+	assert.NoError(t, err)
+	assert.Empty(t, accounts)
+}
+
+func TestMongoStore_CloseAccount(t *testing.T) {
+	const (
+		success = iota
+		errorBalanceNotZero
+		errorPendingPayments
+		errorAlreadyClosed
+		errorNotFound
+	)
+
+	var tests = []struct {
+		name      string
+		accountId string
+		balance   int64
+		testType  int
+	}{
+		{
+			name:      "Test close account successfully",
+			accountId: "close-acc-001",
+			testType:  success,
+		},
+		{
+			name:      "Test error account still holds money",
+			accountId: "close-acc-002",
+			balance:   100,
+			testType:  errorBalanceNotZero,
+		},
+		{
+			name:      "Test error account has pending payments",
+			accountId: "close-acc-003",
+			testType:  errorPendingPayments,
+		},
+		{
+			name:      "Test error account already closed",
+			accountId: "close-acc-004",
+			testType:  errorAlreadyClosed,
+		},
+		{
+			name:      "Test error account not found",
+			accountId: "invalid_id",
+			testType:  errorNotFound,
+		},
+	}
+
+	dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+	if errRt != nil {
+		assert.Nil(t, errRt)
+		t.Fail()
+	}
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.testType != errorNotFound {
+				err := dbStore.CreateAccount(ctx, &models.Account{
+					AccountID: testCase.accountId,
+					Balance:   models.NewMoney(testCase.balance, "NGN"),
+					Status:    models.ACTIVE,
+					CreatedAt: time.Now().Unix(),
+				})
+				assert.NoError(t, err)
+			}
+
+			switch testCase.testType {
+			case success:
+				account, err := dbStore.CloseAccount(ctx, testCase.accountId)
+				assert.NoError(t, err)
+				assert.Equal(t, models.CLOSED, account.Status)
+				assert.NotZero(t, account.ClosedAt)
+
+			case errorBalanceNotZero:
+				_, err := dbStore.CloseAccount(ctx, testCase.accountId)
+				assert.ErrorIs(t, err, database.ErrAccountBalanceNotZero)
+
+			case errorPendingPayments:
+				err := dbStore.CreateTransaction(ctx, &models.Transaction{
+					Reference: "close-ref-001",
+					AccountID: testCase.accountId,
+					Amount:    models.NewMoney(100, "NGN"),
+					Type:      models.CREDIT,
+					Status:    models.PENDING,
+					CreatedAt: time.Now().Unix(),
+				})
+				assert.NoError(t, err)
+
+				_, err = dbStore.CloseAccount(ctx, testCase.accountId)
+				assert.ErrorIs(t, err, database.ErrAccountHasPendingPayments)
+
+			case errorAlreadyClosed:
+				_, err := dbStore.CloseAccount(ctx, testCase.accountId)
+				assert.NoError(t, err)
+
+				_, err = dbStore.CloseAccount(ctx, testCase.accountId)
+				assert.ErrorIs(t, err, database.ErrAccountClosed)
+
+			case errorNotFound:
+				_, err := dbStore.CloseAccount(ctx, testCase.accountId)
+				assert.ErrorIs(t, err, database.ErrAccountNotFound)
+			}
+		})
+	}
+}
+
+func TestMongoStore_LockAccount(t *testing.T) {
+	dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+	if errRt != nil {
+		assert.Nil(t, errRt)
+		t.Fail()
+	}
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	mockAccount := &models.Account{
+		AccountID: "lock-acc-001",
+		Balance:   models.NewMoney(0, "NGN"),
+		Available: models.NewMoney(0, "NGN"),
+		Status:    models.ACTIVE,
+		CreatedAt: time.Now().Unix(),
+	}
+	assert.NoError(t, dbStore.CreateAccount(ctx, mockAccount))
+
+	// a pending credit recorded with the lock keeps the account open
+	err := dbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		account, err := store.LockAccount(ctx, mockAccount.AccountID)
+		assert.NoError(t, err)
+		assert.Equal(t, mockAccount, account)
+
+		return store.CreateTransaction(ctx, &models.Transaction{
+			Reference: "lock-ref-001",
+			AccountID: mockAccount.AccountID,
+			Amount:    models.NewMoney(100, "NGN"),
+			Type:      models.CREDIT,
+			Status:    models.PENDING,
+			CreatedAt: time.Now().Unix(),
+		})
+	})
+	assert.NoError(t, err)
+
+	err = dbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		_, err := store.CloseAccount(ctx, mockAccount.AccountID)
+		return err
+	})
+	assert.ErrorIs(t, err, database.ErrAccountHasPendingPayments)
+
+	assert.NoError(t, dbStore.UpdateTransactionStatus(ctx, "lock-ref-001", models.FAILED))
+
+	err = dbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		_, err := store.CloseAccount(ctx, mockAccount.AccountID)
+		return err
+	})
+	assert.NoError(t, err)
+
+	_, err = dbStore.LockAccount(ctx, mockAccount.AccountID)
+	assert.ErrorIs(t, err, database.ErrAccountClosed)
+
+	_, err = dbStore.LockAccount(ctx, "invalid_id")
+	assert.ErrorIs(t, err, database.ErrAccountNotFound)
+}
+
+func TestMongoStore_GetDebitTotals(t *testing.T) {
+	dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+	if errRt != nil {
+		assert.Nil(t, errRt)
+		t.Fail()
+	}
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	const (
+		monthStart = int64(1700000000)
+		dayStart   = int64(1700500000)
+	)
+
+	mockTransactions := []models.Transaction{
+		{Reference: "totals-ref-001", Amount: models.NewMoney(1000, "NGN"), Type: models.DEBIT, Status: models.SUCCESS, CreatedAt: dayStart + 10},
+		{Reference: "totals-ref-002", Amount: models.NewMoney(2000, "NGN"), Type: models.DEBIT, Status: models.PENDING, CreatedAt: dayStart + 20},
+		{Reference: "totals-ref-003", Amount: models.NewMoney(4000, "NGN"), Type: models.DEBIT, Status: models.REVERSED, CreatedAt: monthStart + 10},
+		{Reference: "totals-ref-005", Amount: models.NewMoney(500, "NGN"), Type: models.DEBIT, Status: models.AUTHORIZED, CreatedAt: dayStart + 40},
+		// none of these count towards the limits
+		{Reference: "totals-ref-004", Amount: models.NewMoney(8000, "NGN"), Type: models.DEBIT, Status: models.FAILED, CreatedAt: dayStart + 30},
+		{Reference: "totals-ref-009", Amount: models.NewMoney(8000, "NGN"), Type: models.DEBIT, Status: models.VOIDED, CreatedAt: dayStart + 70},
+		{Reference: "totals-ref-006", Amount: models.NewMoney(8000, "NGN"), Type: models.CREDIT, Status: models.SUCCESS, CreatedAt: dayStart + 50},
+		{Reference: "totals-ref-007", Amount: models.NewMoney(8000, "NGN"), Type: models.DEBIT, Status: models.SUCCESS, TransferID: "totals-trf-001", CreatedAt: dayStart + 60},
+		{Reference: "totals-ref-008", Amount: models.NewMoney(8000, "NGN"), Type: models.DEBIT, Status: models.SUCCESS, CreatedAt: monthStart - 10},
+	}
+	for i := range mockTransactions {
+		mockTransactions[i].UserID = "totals-usr-001"
+		mockTransactions[i].AccountID = "totals-acc-001"
+		assert.NoError(t, dbStore.CreateTransaction(ctx, &mockTransactions[i]))
+	}
+
+	// other accounts of the same user, only those in the same currency count towards the limits of the user
+	otherAccounts := []models.Transaction{
+		{Reference: "totals-ref-010", AccountID: "totals-acc-003", Amount: models.NewMoney(600, "NGN"), Type: models.DEBIT, Status: models.SUCCESS, CreatedAt: dayStart + 80},
+		{Reference: "totals-ref-011", AccountID: "totals-acc-004", Amount: models.NewMoney(8000, "USD"), Type: models.DEBIT, Status: models.SUCCESS, CreatedAt: dayStart + 90},
+	}
+	for i := range otherAccounts {
+		otherAccounts[i].UserID = "totals-usr-001"
+		assert.NoError(t, dbStore.CreateTransaction(ctx, &otherAccounts[i]))
+	}
+
+	totals, err := dbStore.GetDebitTotals(ctx, "totals-acc-001", dayStart, monthStart)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.DebitTotals{Daily: 3500, DailyCount: 3, Monthly: 7500}, totals)
+
+	totals, err = dbStore.GetDebitTotals(ctx, "totals-acc-002", dayStart, monthStart)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.DebitTotals{}, totals)
+
+	totals, err = dbStore.GetUserDebitTotals(ctx, "totals-usr-001", "NGN", dayStart, monthStart)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.DebitTotals{Daily: 4100, DailyCount: 4, Monthly: 8100}, totals)
+}
+
+func TestMongoStore_LockUser(t *testing.T) {
+	dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+	if errRt != nil {
+		assert.Nil(t, errRt)
+		t.Fail()
+	}
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	mockUser := &models.User{Id: "lock-usr-001", Tier: "standard"}
+	assert.NoError(t, dbStore.CreateUser(ctx, mockUser))
+
+	user, err := dbStore.LockUser(ctx, mockUser.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, mockUser.Tier, user.Tier)
+
+	_, err = dbStore.LockUser(ctx, "lock-usr-unknown")
+	assert.ErrorIs(t, err, database.ErrUserNotFound)
+}
+
+func TestMongoStore_SpendingLimits(t *testing.T) {
+	dbStore, client, errRt := New(context.Background(), connectUri, databaseName, queryTimeout)
+	if errRt != nil {
+		assert.Nil(t, errRt)
+		t.Fail()
+	}
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	assert.NoError(t, dbStore.CreateUser(ctx, &models.User{Id: "limits-usr-001", Name: "Ada Lovelace", CreatedAt: time.Now().Unix()}))
+
+	user, err := dbStore.SetUserTier(ctx, "limits-usr-001", "premium")
+	assert.NoError(t, err)
+	assert.Equal(t, "premium", user.Tier)
+
+	_, err = dbStore.SetUserTier(ctx, "invalid-usr", "premium")
+	assert.ErrorIs(t, err, database.ErrUserNotFound)
+
+	assert.NoError(t, dbStore.CreateAccount(ctx, &models.Account{
+		AccountID: "limits-acc-001",
+		Balance:   models.NewMoney(0, "NGN"),
+		UserID:    "limits-usr-001",
+		Status:    models.ACTIVE,
+		CreatedAt: time.Now().Unix(),
+	}))
+
+	daily := models.NewMoney(500000, "NGN")
+	dailyCount := int64(10)
+	limits := &models.SpendingLimits{Daily: &daily, DailyCount: &dailyCount}
+
+	account, err := dbStore.SetAccountLimits(ctx, "limits-acc-001", limits)
+	assert.NoError(t, err)
+	assert.Equal(t, limits, account.Limits)
+
+	account, err = dbStore.GetAccountByID(ctx, "limits-acc-001")
+	assert.NoError(t, err)
+	assert.Equal(t, limits, account.Limits)
+
+	account, err = dbStore.SetAccountLimits(ctx, "limits-acc-001", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, account.Limits)
+
+	_, err = dbStore.SetAccountLimits(ctx, "invalid_id", limits)
+	assert.ErrorIs(t, err, database.ErrAccountNotFound)
+}
+
+func TestMigrateFloatAmounts(t *testing.T) {
+	dbStore, client, err := New(context.Background(), connectUri, databaseName, queryTimeout)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, bson.M{
+		"account_id": "legacy-acc-001",
+		"balance":    19.33,
+		"user_id":    "usr-0001",
+		"created_at": time.Now().Unix(),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database(databaseName).Collection(TransactionsCollectionName).InsertOne(ctx, bson.M{
+		"reference":  "legacy-ref-001",
+		"user_id":    "usr-0001",
+		"account_id": "legacy-acc-001",
+		"amount":     0.1 + 0.2,
+		"type":       models.CREDIT,
+		"status":     models.SUCCESS,
+		"created_at": time.Now().Unix(),
+	})
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, MigrateFloatAmounts(ctx, client, databaseName, "naira"), models.ErrInvalidCurrency)
+
+	// running twice must leave migrated documents alone
+	assert.NoError(t, MigrateFloatAmounts(ctx, client, databaseName, "NGN"))
+	assert.NoError(t, MigrateFloatAmounts(ctx, client, databaseName, "NGN"))
+
+	acc, err := dbStore.GetAccountByID(ctx, "legacy-acc-001")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1933, "NGN"), acc.Balance)
+
+	transaction, err := dbStore.GetPaymentByReferenceId(ctx, "legacy-ref-001")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(30, "NGN"), transaction.Amount)
+}
+
+func TestMongoStore_CreateJournalEntry(t *testing.T) {
+	dbStore, client, err := New(context.Background(), connectUri, databaseName, queryTimeout)
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+	ctx := context.Background()
+
+	mockEntries := []models.JournalEntry{
+		{
+			EntryID:   "jrn-test-001",
+			Reference: "jrn-ref-001",
+			Postings: []models.Posting{
+				{AccountID: "jrn-acc-001", Amount: models.NewMoney(1000, "NGN")},
+				{AccountID: models.ProviderClearingAccount, Amount: models.NewMoney(-1000, "NGN")},
+			},
+			CreatedAt: time.Now().Unix(),
+		},
+		{
+			EntryID:   "jrn-test-002",
+			Reference: "jrn-ref-002",
+			Postings: []models.Posting{
+				{AccountID: "jrn-acc-001", Amount: models.NewMoney(-250, "NGN")},
+				{AccountID: "jrn-acc-002", Amount: models.NewMoney(250, "NGN")},
+			},
+			CreatedAt: time.Now().Unix(),
+		},
+	}
+	for i := range mockEntries {
+		assert.NoError(t, dbStore.CreateJournalEntry(ctx, &mockEntries[i]))
+	}
+	assert.ErrorIs(t, dbStore.CreateJournalEntry(ctx, &mockEntries[0]), database.ErrDuplicateReference)
+
+	balances, err := dbStore.GetLedgerBalances(ctx, "", "")
+	assert.NoError(t, err)
+
+	derived := make(map[string]models.Money)
+	for _, balance := range balances {
+		derived[balance.AccountID] = balance.Balance
+	}
+	assert.Equal(t, models.NewMoney(750, "NGN"), derived["jrn-acc-001"])
+	assert.Equal(t, models.NewMoney(250, "NGN"), derived["jrn-acc-002"])
+
+	// postings are summed only for the accounts in the range, the entries they share with others included
+	balances, err = dbStore.GetLedgerBalances(ctx, "jrn-acc-001", "jrn-acc-002")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.LedgerBalance{{AccountID: "jrn-acc-002", Balance: models.NewMoney(250, "NGN")}}, balances)
+
+	entries, err := dbStore.GetJournalEntries(ctx, "jrn-test-001", 1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "jrn-test-002", entries[0].EntryID)
+}
+
+func TestMigrateAvailableBalances(t *testing.T) {
+	dbStore, client, err := New(context.Background(), connectUri, databaseName, queryTimeout)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, bson.M{
+		"account_id": "available-acc-001",
+		"balance":    bson.M{"minor": 2500, "currency": "NGN"},
+		"user_id":    "usr-0001",
+		"created_at": time.Now().Unix(),
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Database(databaseName).Collection(AccountsCollectionName).InsertOne(ctx, &models.Account{
+		AccountID: "available-acc-002",
+		Balance:   models.NewMoney(2500, "NGN"),
+		Available: models.NewMoney(1000, "NGN"),
+		UserID:    "usr-0001",
+	})
+	assert.NoError(t, err)
+
+	// running twice must leave accounts that have an available balance alone
+	assert.NoError(t, MigrateAvailableBalances(ctx, client, databaseName))
+	assert.NoError(t, MigrateAvailableBalances(ctx, client, databaseName))
+
+	acc, err := dbStore.GetAccountByID(ctx, "available-acc-001")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(2500, "NGN"), acc.Available)
+
+	acc, err = dbStore.GetAccountByID(ctx, "available-acc-002")
+	assert.NoError(t, err)
+	assert.Equal(t, models.NewMoney(1000, "NGN"), acc.Available)
+}
+
+func TestMigrateOpeningBalances(t *testing.T) {
+	dbStore, client, err := New(context.Background(), connectUri, databaseName, queryTimeout)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	mockAccounts := []models.Account{
+		{AccountID: "opening-acc-001", Balance: models.NewMoney(5000, "NGN"), UserID: "usr-0001", Status: models.ACTIVE},
+		{AccountID: "opening-acc-002", Balance: models.NewMoney(0, "NGN"), UserID: "usr-0001", Status: models.ACTIVE},
+	}
+	for i := range mockAccounts {
+		assert.NoError(t, dbStore.CreateAccount(ctx, &mockAccounts[i]))
+	}
+
+	// running twice must not post the opening balance again
+	assert.NoError(t, MigrateOpeningBalances(ctx, client, databaseName))
+	assert.NoError(t, MigrateOpeningBalances(ctx, client, databaseName))
+
+	count, err := client.Database(databaseName).Collection(JournalEntriesCollectionName).
+		CountDocuments(ctx, bson.M{"postings.account_id": bson.M{"$in": bson.A{"opening-acc-001", "opening-acc-002"}}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	balances, err := dbStore.GetLedgerBalances(ctx, "", "")
+	assert.NoError(t, err)
+	assert.Contains(t, balances, models.LedgerBalance{AccountID: "opening-acc-001", Balance: models.NewMoney(5000, "NGN")})
+
+	// instances starting together post a single opening balance
+	assert.NoError(t, dbStore.CreateAccount(ctx, &models.Account{AccountID: "opening-acc-003", Balance: models.NewMoney(700, "NGN"), UserID: "usr-0001", Status: models.ACTIVE}))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = MigrateOpeningBalances(ctx, client, databaseName)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	count, err = client.Database(databaseName).Collection(JournalEntriesCollectionName).
+		CountDocuments(ctx, bson.M{"entry_id": "opening:opening-acc-003"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMongoStore_Ping(t *testing.T) {
+	dbStore, client, err := New(context.Background(), connectUri, databaseName, queryTimeout)
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+
+	assert.NoError(t, dbStore.Ping(context.Background()))
+}
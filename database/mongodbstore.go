@@ -1,12 +1,42 @@
 package database
 
-import "consumer-payment-service/models"
+import (
+	"consumer-payment-service/models"
+	"context"
+)
 
 //go:generate mockgen -source=mongodbstore.go -destination=../mocks/mongodbstore_mock.go -package=mocks
 type MongoDBStore interface {
-	GetAccountByID(accountId string) (*models.Account, error)
-	UpdateAccountBalance(accountId string, amount float64) error
-	CreateTransaction(transaction *models.Transaction) error
-	GetPaymentByReferenceId(referenceId string) (*models.Transaction, error)
-	GetUserById(userId string) (*models.User, error)
+	GetAccountByID(ctx context.Context, accountId string) (*models.Account, error)
+	GetUserAccount(ctx context.Context, userId, accountId string) (*models.Account, error)
+	AdjustAccountBalance(ctx context.Context, accountId string, amount models.Money) (*models.Account, error)
+	AdjustAvailableBalance(ctx context.Context, accountId string, amount models.Money) (*models.Account, error)
+	LockAccount(ctx context.Context, accountId string) (*models.Account, error)
+	CreateTransaction(ctx context.Context, transaction *models.Transaction) error
+	GetPaymentByReferenceId(ctx context.Context, referenceId string) (*models.Transaction, error)
+	UpdateTransactionStatus(ctx context.Context, referenceId string, status models.TransactionStatus) error
+	FailTransaction(ctx context.Context, referenceId, reason string, providerStatusCode int, failureKind string) error
+	AdjustReversedAmount(ctx context.Context, referenceId string, amount models.Money) (*models.Transaction, error)
+	CaptureHold(ctx context.Context, referenceId string, amount models.Money) (*models.Transaction, error)
+	ReleaseHold(ctx context.Context, referenceId string, status models.TransactionStatus) (*models.Transaction, error)
+	GetExpiredHolds(ctx context.Context, expiredBy int64, after *models.TransactionCursor, limit int64) ([]models.Transaction, error)
+	GetTransactionByIdempotencyKey(ctx context.Context, key string) (*models.Transaction, error)
+	GetPendingTransactions(ctx context.Context, createdBefore int64, after *models.TransactionCursor, limit int64) ([]models.Transaction, error)
+	ListTransactions(ctx context.Context, filter models.TransactionFilter) ([]models.Transaction, error)
+	GetDebitTotals(ctx context.Context, accountId string, dayStart, monthStart int64) (*models.DebitTotals, error)
+	GetUserDebitTotals(ctx context.Context, userId, currency string, dayStart, monthStart int64) (*models.DebitTotals, error)
+	GetUserById(ctx context.Context, userId string) (*models.User, error)
+	LockUser(ctx context.Context, userId string) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	SetUserTier(ctx context.Context, userId, tier string) (*models.User, error)
+	CreateAccount(ctx context.Context, account *models.Account) error
+	GetUserAccounts(ctx context.Context, userId string) ([]models.Account, error)
+	CloseAccount(ctx context.Context, accountId string) (*models.Account, error)
+	SetAccountLimits(ctx context.Context, accountId string, limits *models.SpendingLimits) (*models.Account, error)
+	GetAccounts(ctx context.Context, after string, limit int64) ([]models.Account, error)
+	CreateJournalEntry(ctx context.Context, entry *models.JournalEntry) error
+	GetJournalEntries(ctx context.Context, after string, limit int64) ([]models.JournalEntry, error)
+	GetLedgerBalances(ctx context.Context, after, until string) ([]models.LedgerBalance, error)
+	WithTx(ctx context.Context, fn func(store MongoDBStore) error) error
+	Ping(ctx context.Context) error
 }
@@ -1,19 +1,197 @@
 package environment
 
-import "os"
+import (
+	"consumer-payment-service/models"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
 
 type Config struct {
 	DatabaseURI                  string
 	DatabaseName                 string
 	PORT                         string
 	THIRD_PARTY_SERVICE_BASE_URL string
+	// DefaultCurrency is given to balances and amounts still stored as floats when they are migrated to minor units
+	DefaultCurrency string
+	// DatabaseTimeout bounds each database call
+	DatabaseTimeout time.Duration
+	// ProviderTimeout bounds each attempt at a call to the third party payment service
+	ProviderTimeout time.Duration
+	// ProviderRetries is how many times a call that is safe to repeat is retried, waiting between
+	// ProviderRetryWait and ProviderRetryMaxWait with jittered exponential backoff. Every attempt together with
+	// the waits between them is kept within HTTPWriteTimeout, see ProviderBudget.
+	ProviderRetries      int
+	ProviderRetryWait    time.Duration
+	ProviderRetryMaxWait time.Duration
+	// ProviderBreakerThreshold consecutive failed calls open the circuit to the third party payment service for
+	// ProviderBreakerCooldown, zero disables the breaker
+	ProviderBreakerThreshold int
+	ProviderBreakerCooldown  time.Duration
+	// ReconcileInterval is how often transactions stuck in PENDING are checked with the payment provider
+	ReconcileInterval time.Duration
+	// ReconcilePendingAge is how long a transaction has to be PENDING before it is reconciled
+	ReconcilePendingAge time.Duration
+	// HoldExpiry is how long an authorization holds its amount before it expires unless it is captured or voided
+	HoldExpiry time.Duration
+	// SpendingLimitTiers holds the spending limits of each user tier by account currency, DefaultSpendingTier applies
+	// to users without a tier. Debits are not limited when no tier is configured.
+	SpendingLimitTiers  map[string]map[string]models.SpendingLimits
+	DefaultSpendingTier string
+	// AdminToken is the bearer token the admin endpoints, such as those changing spending limits, require. They
+	// refuse every request when it is empty.
+	AdminToken string
+	// HTTPReadTimeout, HTTPWriteTimeout and HTTPIdleTimeout are applied to the HTTP server connections
+	HTTPReadTimeout  time.Duration
+	HTTPWriteTimeout time.Duration
+	HTTPIdleTimeout  time.Duration
+	// ShutdownTimeout is how long in-flight requests are given to finish once the service is asked to stop
+	ShutdownTimeout time.Duration
+	// ShutdownDrainDelay keeps serving after readiness starts failing so load balancers can stop routing first
+	ShutdownDrainDelay time.Duration
+	// ReadinessCheckProvider makes readiness depend on the third party payment service answering
+	ReadinessCheckProvider bool
+	// LogLevel is one of debug, info, warn or error and LogFormat is json or text
+	LogLevel  string
+	LogFormat string
+	// ProviderDebug logs calls to the third party payment service with account ids and amounts masked
+	ProviderDebug bool
+	// OTLPEndpoint is where traces are exported over OTLP/HTTP, tracing is disabled when it is empty
+	OTLPEndpoint string
+	// ServiceName identifies the service in exported traces
+	ServiceName string
 }
 
 func LoadConfig() *Config {
-	return &Config{
+	config := &Config{
 		DatabaseURI:                  os.Getenv("DB_URI"),
 		DatabaseName:                 os.Getenv("DB_NAME"),
 		PORT:                         os.Getenv("PORT"),
 		THIRD_PARTY_SERVICE_BASE_URL: os.Getenv("THIRD_PARTY_SERVICE_BASE_URL"),
+		DefaultCurrency:              os.Getenv("DEFAULT_CURRENCY"),
+		DatabaseTimeout:              durationEnv("DB_TIMEOUT", 5*time.Second),
+		ProviderTimeout:              durationEnv("THIRD_PARTY_SERVICE_TIMEOUT", 5*time.Second),
+		ProviderRetries:              intEnv("THIRD_PARTY_SERVICE_RETRIES", 2),
+		ProviderRetryWait:            durationEnv("THIRD_PARTY_SERVICE_RETRY_WAIT", 100*time.Millisecond),
+		ProviderRetryMaxWait:         durationEnv("THIRD_PARTY_SERVICE_RETRY_MAX_WAIT", time.Second),
+		ProviderBreakerThreshold:     intEnv("THIRD_PARTY_SERVICE_BREAKER_THRESHOLD", 5),
+		ProviderBreakerCooldown:      durationEnv("THIRD_PARTY_SERVICE_BREAKER_COOLDOWN", 30*time.Second),
+		ReconcileInterval:            durationEnv("RECONCILE_INTERVAL", time.Minute),
+		ReconcilePendingAge:          durationEnv("RECONCILE_PENDING_AGE", 5*time.Minute),
+		HoldExpiry:                   durationEnv("HOLD_EXPIRY", 7*24*time.Hour),
+		SpendingLimitTiers:           spendingLimitTiersEnv("SPENDING_LIMIT_TIERS"),
+		DefaultSpendingTier:          stringEnv("DEFAULT_SPENDING_TIER", "standard"),
+		AdminToken:                   os.Getenv("ADMIN_API_TOKEN"),
+		HTTPReadTimeout:              durationEnv("HTTP_READ_TIMEOUT", 10*time.Second),
+		HTTPWriteTimeout:             durationEnv("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		HTTPIdleTimeout:              durationEnv("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		ShutdownTimeout:              durationEnv("SHUTDOWN_TIMEOUT", 30*time.Second),
+		ShutdownDrainDelay:           durationEnv("SHUTDOWN_DRAIN_DELAY", 0),
+		ReadinessCheckProvider:       os.Getenv("READINESS_CHECK_PROVIDER") == "true",
+		LogLevel:                     stringEnv("LOG_LEVEL", "info"),
+		LogFormat:                    stringEnv("LOG_FORMAT", "json"),
+		ProviderDebug:                os.Getenv("THIRD_PARTY_SERVICE_DEBUG") == "true",
+		OTLPEndpoint:                 os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		ServiceName:                  stringEnv("OTEL_SERVICE_NAME", "consumer-payment-service"),
 	}
+
+	config.fitProviderBudget()
+	return config
+}
+
+// ProviderBudget is the longest a call to the third party payment service can take, every attempt timing out
+// and every wait between them at its longest
+func (c *Config) ProviderBudget() time.Duration {
+	return time.Duration(c.ProviderRetries+1)*c.ProviderTimeout + time.Duration(c.ProviderRetries)*c.ProviderRetryMaxWait
+}
+
+// fitProviderBudget keeps the provider budget below the HTTP write timeout with a database call to spare, so
+// that the outcome of a payment can still be recorded and written back before the connection is cut. Retries
+// are given up first, then the single attempt left is given a shorter timeout.
+func (c *Config) fitProviderBudget() {
+	limit := c.HTTPWriteTimeout - c.DatabaseTimeout
+	if limit <= 0 {
+		limit = c.HTTPWriteTimeout / 2
+	}
+
+	if c.ProviderBudget() <= limit {
+		return
+	}
+
+	budget := c.ProviderBudget()
+	for c.ProviderRetries > 0 && c.ProviderBudget() > limit {
+		c.ProviderRetries--
+	}
+	if c.ProviderTimeout > limit {
+		c.ProviderTimeout = limit
+	}
+
+	slog.Warn("third party service timeouts exceed the HTTP write timeout, lowering them",
+		"budget", budget, "write_timeout", c.HTTPWriteTimeout,
+		"retries", c.ProviderRetries, "timeout", c.ProviderTimeout)
+}
+
+// durationEnv reads a duration such as "30s" from the environment, fallback is used when it is unset or invalid
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		slog.Warn("invalid duration in environment, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return duration
+}
+
+// intEnv reads a non-negative integer from the environment, fallback is used when it is unset or invalid
+func intEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		slog.Warn("invalid integer in environment, using default", "key", key, "value", value, "default", fallback)
+		return fallback
+	}
+	return number
+}
+
+// spendingLimitTiersEnv reads the spending limits of user tiers from a JSON object in the environment keyed by tier
+// and currency, e.g. {"standard": {"NGN": {"daily": {"amount": "50000.00", "currency": "NGN"}, "daily_count": 20}}}.
+// Limits that cannot be applied to accounts in the currency they are listed under are left out.
+func spendingLimitTiersEnv(key string) map[string]map[string]models.SpendingLimits {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	var tiers map[string]map[string]models.SpendingLimits
+	if err := json.Unmarshal([]byte(value), &tiers); err != nil {
+		slog.Warn("invalid spending limits in environment, debits are not limited", "key", key, "error", err)
+		return nil
+	}
+
+	for tier, currencies := range tiers {
+		for currency, limits := range currencies {
+			if len(limits.Validate()) > 0 || (limits.Currency() != "" && limits.Currency() != currency) {
+				slog.Warn("invalid spending limits in environment, leaving them out", "key", key, "tier", tier, "currency", currency)
+				delete(currencies, currency)
+			}
+		}
+	}
+	return tiers
+}
+
+func stringEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
@@ -0,0 +1,81 @@
+package environment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Config_FitProviderBudget(t *testing.T) {
+	testCases := []struct {
+		name            string
+		config          Config
+		expectedRetries int
+		expectedTimeout time.Duration
+	}{
+		{
+			name: "Test budget within the write timeout is left alone",
+			config: Config{
+				DatabaseTimeout: 5 * time.Second, HTTPWriteTimeout: 30 * time.Second,
+				ProviderTimeout: 5 * time.Second, ProviderRetries: 2, ProviderRetryMaxWait: time.Second,
+			},
+			expectedRetries: 2,
+			expectedTimeout: 5 * time.Second,
+		},
+
+		{
+			name: "Test retries are given up until the budget fits",
+			config: Config{
+				DatabaseTimeout: 5 * time.Second, HTTPWriteTimeout: 30 * time.Second,
+				ProviderTimeout: 10 * time.Second, ProviderRetries: 2, ProviderRetryMaxWait: 2 * time.Second,
+			},
+			expectedRetries: 1,
+			expectedTimeout: 10 * time.Second,
+		},
+
+		{
+			name: "Test timeout is shortened when a single attempt does not fit",
+			config: Config{
+				DatabaseTimeout: 5 * time.Second, HTTPWriteTimeout: 30 * time.Second,
+				ProviderTimeout: time.Minute, ProviderRetries: 2, ProviderRetryMaxWait: time.Second,
+			},
+			expectedRetries: 0,
+			expectedTimeout: 25 * time.Second,
+		},
+
+		{
+			name: "Test half of the write timeout is kept when it is shorter than a database call",
+			config: Config{
+				DatabaseTimeout: 5 * time.Second, HTTPWriteTimeout: 4 * time.Second,
+				ProviderTimeout: 5 * time.Second, ProviderRetries: 2, ProviderRetryMaxWait: time.Second,
+			},
+			expectedRetries: 0,
+			expectedTimeout: 2 * time.Second,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := testCase.config
+			config.fitProviderBudget()
+
+			assert.Equal(t, testCase.expectedRetries, config.ProviderRetries)
+			assert.Equal(t, testCase.expectedTimeout, config.ProviderTimeout)
+			assert.Less(t, config.ProviderBudget(), config.HTTPWriteTimeout)
+		})
+	}
+}
+
+func Test_LoadConfig_ProviderBudget(t *testing.T) {
+	for _, key := range []string{"DB_TIMEOUT", "HTTP_WRITE_TIMEOUT", "THIRD_PARTY_SERVICE_TIMEOUT", "THIRD_PARTY_SERVICE_RETRIES", "THIRD_PARTY_SERVICE_RETRY_MAX_WAIT"} {
+		t.Setenv(key, "")
+	}
+
+	// the defaults fit without being lowered
+	config := LoadConfig()
+
+	assert.Equal(t, 2, config.ProviderRetries)
+	assert.Equal(t, 5*time.Second, config.ProviderTimeout)
+	assert.Less(t, config.ProviderBudget(), config.HTTPWriteTimeout)
+}
@@ -0,0 +1,88 @@
+package ledger
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrUnbalancedEntry is returned when the postings of a journal entry do not add up to zero
+var ErrUnbalancedEntry = errors.New("journal entry is not balanced")
+
+// Post records entry and applies its postings to the balances of the accounts held by users, which are kept as
+// a projection of the ledger. store must be handed out by WithTx so that the entry and the balances it moves
+// commit together. A posting that takes money out of an account fails with database.ErrInsufficientFunds when
+// the balance does not cover it.
+func Post(ctx context.Context, store database.MongoDBStore, entry *models.JournalEntry) error {
+	if !entry.Balanced() {
+		return ErrUnbalancedEntry
+	}
+
+	if entry.EntryID == "" {
+		id, err := models.NewID(models.JournalEntryIDPrefix)
+		if err != nil {
+			return err
+		}
+		entry.EntryID = id
+	}
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = time.Now().Unix()
+	}
+
+	for _, posting := range entry.Postings {
+		if models.SystemAccount(posting.AccountID) {
+			continue
+		}
+
+		if _, err := store.AdjustAccountBalance(ctx, posting.AccountID, posting.Amount); err != nil {
+			return err
+		}
+	}
+
+	return store.CreateJournalEntry(ctx, entry)
+}
+
+// Deposit records money the payment provider paid into the account of transaction
+func Deposit(transaction *models.Transaction) *models.JournalEntry {
+	return &models.JournalEntry{
+		Reference:   transaction.Reference,
+		Description: "deposit",
+		Postings: []models.Posting{
+			{AccountID: transaction.AccountID, Amount: transaction.Amount},
+			{AccountID: models.ProviderClearingAccount, Amount: transaction.Amount.Negate()},
+		},
+	}
+}
+
+// Withdrawal records money taken out of the account of transaction to be paid out by the payment provider
+func Withdrawal(transaction *models.Transaction) *models.JournalEntry {
+	return &models.JournalEntry{
+		Reference:   transaction.Reference,
+		Description: "withdrawal",
+		Postings: []models.Posting{
+			{AccountID: transaction.AccountID, Amount: transaction.Amount.Negate()},
+			{AccountID: models.ProviderClearingAccount, Amount: transaction.Amount},
+		},
+	}
+}
+
+// Release gives back the money withdrawn for transaction when the payment provider did not pay it out
+func Release(transaction *models.Transaction) *models.JournalEntry {
+	entry := Deposit(transaction)
+	entry.Description = "withdrawal released"
+	return entry
+}
+
+// Transfer records the money moved by the DEBIT leg of a transfer to its counterparty account
+func Transfer(debit *models.Transaction) *models.JournalEntry {
+	return &models.JournalEntry{
+		Reference:   debit.Reference,
+		Description: "transfer",
+		Postings: []models.Posting{
+			{AccountID: debit.AccountID, Amount: debit.Amount.Negate()},
+			{AccountID: debit.CounterpartyAccountID, Amount: debit.Amount},
+		},
+	}
+}
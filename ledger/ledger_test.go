@@ -0,0 +1,351 @@
+package ledger
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/database/databasetest"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_Post(t *testing.T) {
+	const (
+		success = iota
+		errorUnbalanced
+		errorInsufficientFunds
+	)
+
+	mockTransaction := &models.Transaction{
+		Reference: "ref-001",
+		AccountID: "acc_001",
+		Amount:    models.NewMoney(1000, "NGN"),
+	}
+
+	testCases := []struct {
+		name     string
+		entry    *models.JournalEntry
+		testType int
+	}{
+		{
+			name:     "Test success posting a deposit",
+			entry:    Deposit(mockTransaction),
+			testType: success,
+		},
+
+		{
+			name: "Test error entry does not balance",
+			entry: &models.JournalEntry{
+				Reference: "ref-001",
+				Postings: []models.Posting{
+					{AccountID: "acc_001", Amount: models.NewMoney(1000, "NGN")},
+					{AccountID: models.ProviderClearingAccount, Amount: models.NewMoney(-999, "NGN")},
+				},
+			},
+			testType: errorUnbalanced,
+		},
+
+		{
+			name:     "Test error withdrawal exceeding balance",
+			entry:    Withdrawal(mockTransaction),
+			testType: errorInsufficientFunds,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			switch testCase.testType {
+			case success:
+				// only the account held by the user has a balance to move, the clearing account is derived
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc_001", models.NewMoney(1000, "NGN")).
+					Return(&models.Account{AccountID: "acc_001"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), testCase.entry).
+					Return(nil)
+
+				assert.NoError(t, Post(ctx, mockDataStore, testCase.entry))
+				assert.Regexp(t, "^jrn_[0-9a-f]{24}$", testCase.entry.EntryID)
+				assert.NotZero(t, testCase.entry.CreatedAt)
+
+			case errorUnbalanced:
+				assert.ErrorIs(t, Post(ctx, mockDataStore, testCase.entry), ErrUnbalancedEntry)
+
+			case errorInsufficientFunds:
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc_001", models.NewMoney(-1000, "NGN")).
+					Return(nil, database.ErrInsufficientFunds)
+
+				assert.ErrorIs(t, Post(ctx, mockDataStore, testCase.entry), database.ErrInsufficientFunds)
+			}
+		})
+	}
+}
+
+func Test_Entries(t *testing.T) {
+	mockTransaction := &models.Transaction{
+		Reference:             "ref-001",
+		AccountID:             "acc_001",
+		Amount:                models.NewMoney(1000, "NGN"),
+		CounterpartyAccountID: "acc_002",
+	}
+
+	testCases := []struct {
+		name     string
+		entry    *models.JournalEntry
+		expected []models.Posting
+	}{
+		{
+			name:  "Test deposit moves money from provider clearing",
+			entry: Deposit(mockTransaction),
+			expected: []models.Posting{
+				{AccountID: "acc_001", Amount: models.NewMoney(1000, "NGN")},
+				{AccountID: models.ProviderClearingAccount, Amount: models.NewMoney(-1000, "NGN")},
+			},
+		},
+		{
+			name:  "Test withdrawal moves money to provider clearing",
+			entry: Withdrawal(mockTransaction),
+			expected: []models.Posting{
+				{AccountID: "acc_001", Amount: models.NewMoney(-1000, "NGN")},
+				{AccountID: models.ProviderClearingAccount, Amount: models.NewMoney(1000, "NGN")},
+			},
+		},
+		{
+			name:  "Test release undoes a withdrawal",
+			entry: Release(mockTransaction),
+			expected: []models.Posting{
+				{AccountID: "acc_001", Amount: models.NewMoney(1000, "NGN")},
+				{AccountID: models.ProviderClearingAccount, Amount: models.NewMoney(-1000, "NGN")},
+			},
+		},
+		{
+			name:  "Test transfer moves money to the counterparty",
+			entry: Transfer(mockTransaction),
+			expected: []models.Posting{
+				{AccountID: "acc_001", Amount: models.NewMoney(-1000, "NGN")},
+				{AccountID: "acc_002", Amount: models.NewMoney(1000, "NGN")},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.True(t, testCase.entry.Balanced())
+			assert.Equal(t, "ref-001", testCase.entry.Reference)
+			assert.Equal(t, testCase.expected, testCase.entry.Postings)
+		})
+	}
+}
+
+func Test_Verify(t *testing.T) {
+	const (
+		success = iota
+		balanceDrifted
+		postingsToUnknownAccount
+		ledgerUnbalanced
+		successOverSeveralPages
+		errorGettingBalances
+		errorGettingJournalEntries
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test balances match the ledger",
+			testType: success,
+		},
+
+		{
+			name:     "Test balance drifted from the ledger",
+			testType: balanceDrifted,
+		},
+
+		{
+			name:     "Test postings to an account that does not exist",
+			testType: postingsToUnknownAccount,
+		},
+
+		{
+			name:     "Test postings do not add up to zero",
+			testType: ledgerUnbalanced,
+		},
+
+		{
+			name:     "Test accounts and journal entries are read a page at a time",
+			testType: successOverSeveralPages,
+		},
+
+		{
+			name:     "Test error getting ledger balances",
+			testType: errorGettingBalances,
+		},
+
+		{
+			name:     "Test error getting journal entries",
+			testType: errorGettingJournalEntries,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+
+	mockAccounts := []models.Account{
+		{AccountID: "acc_001", Balance: models.NewMoney(700, "NGN")},
+		{AccountID: "acc_002", Balance: models.NewMoney(300, "NGN")},
+		{AccountID: "acc_003", Balance: models.NewMoney(0, "USD")},
+	}
+	mockBalances := []models.LedgerBalance{
+		{AccountID: "acc_001", Balance: models.NewMoney(700, "NGN")},
+		{AccountID: "acc_002", Balance: models.NewMoney(300, "NGN")},
+		{AccountID: models.ProviderClearingAccount, Balance: models.NewMoney(-1000, "NGN")},
+	}
+	mockEntries := []models.JournalEntry{
+		{
+			EntryID: "jrn_001",
+			Postings: []models.Posting{
+				{AccountID: "acc_001", Amount: models.NewMoney(700, "NGN")},
+				{AccountID: models.ProviderClearingAccount, Amount: models.NewMoney(-700, "NGN")},
+			},
+		},
+		{
+			EntryID: "jrn_002",
+			Postings: []models.Posting{
+				{AccountID: "acc_002", Amount: models.NewMoney(300, "NGN")},
+				{AccountID: models.ProviderClearingAccount, Amount: models.NewMoney(-300, "NGN")},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			switch testCase.testType {
+			case success:
+				databasetest.ExpectWithTx(mockDataStore)
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "", int64(pageSize)).Return(mockAccounts, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(mockBalances, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "", int64(pageSize)).Return(mockEntries, nil)
+
+				report, err := Verify(ctx, mockDataStore)
+				assert.NoError(t, err)
+				assert.Equal(t, &models.LedgerReport{OK: true, CheckedAccounts: 3, Drift: []models.BalanceDrift{}}, report)
+
+			case balanceDrifted:
+				accounts := append([]models.Account{}, mockAccounts...)
+				accounts[1].Balance = models.NewMoney(5300, "NGN")
+
+				databasetest.ExpectWithTx(mockDataStore)
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "", int64(pageSize)).Return(accounts, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(mockBalances, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "", int64(pageSize)).Return(mockEntries, nil)
+
+				report, err := Verify(ctx, mockDataStore)
+				assert.NoError(t, err)
+				assert.False(t, report.OK)
+				assert.Equal(t, []models.BalanceDrift{
+					{AccountID: "acc_002", Cached: models.NewMoney(5300, "NGN"), Derived: models.NewMoney(300, "NGN")},
+				}, report.Drift)
+				assert.Empty(t, report.Unbalanced)
+
+			case postingsToUnknownAccount:
+				balances := append([]models.LedgerBalance{}, mockBalances...)
+				balances = append(balances, models.LedgerBalance{AccountID: "acc_404", Balance: models.NewMoney(250, "NGN")})
+
+				databasetest.ExpectWithTx(mockDataStore)
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "", int64(pageSize)).Return(mockAccounts, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(balances, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "", int64(pageSize)).Return(mockEntries, nil)
+
+				report, err := Verify(ctx, mockDataStore)
+				assert.NoError(t, err)
+				assert.False(t, report.OK)
+				assert.Equal(t, []models.BalanceDrift{
+					{AccountID: "acc_404", Cached: models.NewMoney(0, "NGN"), Derived: models.NewMoney(250, "NGN")},
+				}, report.Drift)
+
+			case ledgerUnbalanced:
+				entries := append([]models.JournalEntry{}, mockEntries...)
+				entries = append(entries, models.JournalEntry{
+					EntryID:  "jrn_003",
+					Postings: []models.Posting{{AccountID: "acc_003", Amount: models.NewMoney(100, "NGN")}},
+				})
+
+				databasetest.ExpectWithTx(mockDataStore)
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "", int64(pageSize)).Return(mockAccounts, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(mockBalances, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "", int64(pageSize)).Return(entries, nil)
+
+				report, err := Verify(ctx, mockDataStore)
+				assert.NoError(t, err)
+				assert.False(t, report.OK)
+				assert.Empty(t, report.Drift)
+				assert.Equal(t, []models.Money{models.NewMoney(100, "NGN")}, report.Unbalanced)
+
+			case successOverSeveralPages:
+				firstAccounts := make([]models.Account, pageSize)
+				for i := range firstAccounts {
+					firstAccounts[i] = models.Account{AccountID: fmt.Sprintf("acc_%04d", i), Balance: models.NewMoney(0, "NGN")}
+				}
+				firstEntries := make([]models.JournalEntry, pageSize)
+				for i := range firstEntries {
+					firstEntries[i] = models.JournalEntry{EntryID: fmt.Sprintf("jrn_%04d", i)}
+				}
+
+				// the first page of balances stops at the last account of the page, the last one is open ended
+				databasetest.ExpectWithTx(mockDataStore)
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "", int64(pageSize)).Return(firstAccounts, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "acc_0499").Return([]models.LedgerBalance{}, nil)
+				databasetest.ExpectWithTx(mockDataStore)
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "acc_0499", int64(pageSize)).Return(mockAccounts, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "acc_0499", "").Return(mockBalances, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "", int64(pageSize)).Return(firstEntries, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "jrn_0499", int64(pageSize)).Return(mockEntries, nil)
+
+				report, err := Verify(ctx, mockDataStore)
+				assert.NoError(t, err)
+				assert.Equal(t, &models.LedgerReport{OK: true, CheckedAccounts: pageSize + 3, Drift: []models.BalanceDrift{}}, report)
+
+			case errorGettingBalances:
+				databasetest.ExpectWithTx(mockDataStore)
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "", int64(pageSize)).Return(mockAccounts, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(nil, errors.New("connection reset"))
+
+				report, err := Verify(ctx, mockDataStore)
+				assert.Error(t, err)
+				assert.Nil(t, report)
+
+			case errorGettingJournalEntries:
+				databasetest.ExpectWithTx(mockDataStore)
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "", int64(pageSize)).Return(mockAccounts, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(mockBalances, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "", int64(pageSize)).Return(nil, errors.New("connection reset"))
+
+				report, err := Verify(ctx, mockDataStore)
+				assert.Error(t, err)
+				assert.Nil(t, report)
+			}
+		})
+	}
+}
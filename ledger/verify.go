@@ -0,0 +1,163 @@
+package ledger
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/models"
+	"context"
+	"sort"
+)
+
+// pageSize caps how many accounts or journal entries Verify reads from the store at a time
+const pageSize = 500
+
+// Verify recomputes the balance of every account from the ledger and reports the accounts whose balance in
+// the accounts collection has drifted from it, including accounts the ledger posts to that do not exist.
+// Accounts are checked a page at a time, each page against the postings to its range of account IDs read from
+// the same snapshot. Entries are posted together with the balances they move, so a healthy ledger reports no
+// drift even while payments are being made.
+func Verify(ctx context.Context, store database.MongoDBStore) (*models.LedgerReport, error) {
+	report := &models.LedgerReport{Drift: []models.BalanceDrift{}}
+
+	after := ""
+	for {
+		var balances []models.LedgerBalance
+		var accounts []models.Account
+		err := store.WithTx(ctx, func(store database.MongoDBStore) error {
+			var err error
+			if accounts, err = store.GetAccounts(ctx, after, pageSize); err != nil {
+				return err
+			}
+
+			// the last page also takes the postings to accounts sorting after every account there is
+			until := ""
+			if len(accounts) == pageSize {
+				until = accounts[len(accounts)-1].AccountID
+			}
+
+			balances, err = store.GetLedgerBalances(ctx, after, until)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		report.CheckedAccounts += len(accounts)
+		report.Drift = append(report.Drift, drift(accounts, balances)...)
+
+		if len(accounts) < pageSize {
+			break
+		}
+		after = accounts[len(accounts)-1].AccountID
+	}
+
+	unbalanced, err := unbalanced(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	report.Unbalanced = unbalanced
+
+	report.OK = len(report.Drift) == 0 && len(report.Unbalanced) == 0
+	return report, nil
+}
+
+// drift compares a page of accounts with the ledger balances of their range of account IDs
+func drift(accounts []models.Account, balances []models.LedgerBalance) []models.BalanceDrift {
+	// derived balances of the accounts held by users by currency, what is left of it once matched against the
+	// accounts collection was posted to accounts that do not exist
+	derived := make(map[string]map[string]int64)
+	for _, balance := range balances {
+		if models.SystemAccount(balance.AccountID) {
+			continue
+		}
+
+		if derived[balance.AccountID] == nil {
+			derived[balance.AccountID] = make(map[string]int64)
+		}
+		derived[balance.AccountID][balance.Balance.Currency] = balance.Balance.Minor
+	}
+
+	drift := []models.BalanceDrift{}
+	for _, account := range accounts {
+		postings := derived[account.AccountID]
+		delete(derived, account.AccountID)
+
+		currency := account.Balance.Currency
+		if minor := postings[currency]; minor != account.Balance.Minor {
+			drift = append(drift, models.BalanceDrift{
+				AccountID: account.AccountID,
+				Cached:    account.Balance,
+				Derived:   models.NewMoney(minor, currency),
+			})
+		}
+
+		// postings in any other currency never reached the balance
+		for otherCurrency, minor := range postings {
+			if otherCurrency != currency && minor != 0 {
+				drift = append(drift, models.BalanceDrift{
+					AccountID: account.AccountID,
+					Cached:    models.NewMoney(0, otherCurrency),
+					Derived:   models.NewMoney(minor, otherCurrency),
+				})
+			}
+		}
+	}
+
+	for accountId, postings := range derived {
+		for currency, minor := range postings {
+			if minor != 0 {
+				drift = append(drift, models.BalanceDrift{
+					AccountID: accountId,
+					Cached:    models.NewMoney(0, currency),
+					Derived:   models.NewMoney(minor, currency),
+				})
+			}
+		}
+	}
+
+	// map iteration order is random, keep reports comparable between runs
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].AccountID != drift[j].AccountID {
+			return drift[i].AccountID < drift[j].AccountID
+		}
+		return drift[i].Cached.Currency < drift[j].Cached.Currency
+	})
+
+	return drift
+}
+
+// unbalanced pages through the journal and returns the currencies in which its postings do not add up to zero.
+// Entries are never changed once written, so an entry posted while paging is either counted whole or not at all.
+func unbalanced(ctx context.Context, store database.MongoDBStore) ([]models.Money, error) {
+	totals := make(map[string]int64)
+
+	after := ""
+	for {
+		entries, err := store.GetJournalEntries(ctx, after, pageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			for _, posting := range entry.Postings {
+				totals[posting.Amount.Currency] += posting.Amount.Minor
+			}
+		}
+
+		if len(entries) < pageSize {
+			break
+		}
+		after = entries[len(entries)-1].EntryID
+	}
+
+	var unbalanced []models.Money
+	for currency, minor := range totals {
+		if minor != 0 {
+			unbalanced = append(unbalanced, models.NewMoney(minor, currency))
+		}
+	}
+	sort.Slice(unbalanced, func(i, j int) bool {
+		return unbalanced[i].Currency < unbalanced[j].Currency
+	})
+
+	return unbalanced, nil
+}
@@ -0,0 +1,136 @@
+package limits
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLimitExceeded is matched by the errors returned when a debit would exceed a spending limit
+var ErrLimitExceeded = errors.New("spending limit exceeded")
+
+// ExceededError names the spending limit a debit would exceed and what is left of it
+type ExceededError struct {
+	models.LimitExceeded
+}
+
+func (e *ExceededError) Error() string {
+	if e.RemainingCount != nil {
+		return fmt.Sprintf("%s spending limit exceeded, %d debits remaining", e.Limit, *e.RemainingCount)
+	}
+	return fmt.Sprintf("%s spending limit exceeded, %s remaining", e.Limit, e.RemainingAmount)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Tiers holds the spending limits of each user tier by account currency
+type Tiers map[string]map[string]models.SpendingLimits
+
+// Resolve returns the spending limits that apply to account: those of the tier of user, or of defaultTier when the
+// user has none, with the limits set on the account taking precedence
+func Resolve(tiers Tiers, defaultTier string, user *models.User, account *models.Account) models.SpendingLimits {
+	tier := user.Tier
+	if tier == "" {
+		tier = defaultTier
+	}
+
+	return tiers[tier][account.Balance.Currency].Override(account.Limits)
+}
+
+// Check returns an *ExceededError when debiting amount from account would exceed limits. A limit set on the account
+// itself caps the debits of the account alone, one from the tier caps the debits of all of the accounts of its holder
+// in the account currency. The debits already made are read through store, which must be handed out by WithTx so
+// that they cannot change before the debit is recorded, the holder is locked before their debits are read.
+func Check(ctx context.Context, store database.MongoDBStore, account *models.Account, limits models.SpendingLimits, amount models.Money) error {
+	if limits.PerTransaction != nil && amount.Minor > limits.PerTransaction.Minor {
+		return exceededAmount(models.LimitPerTransaction, *limits.PerTransaction, 0)
+	}
+
+	if limits.Daily == nil && limits.Monthly == nil && limits.DailyCount == nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	totals := &debitTotals{store: store, account: account, dayStart: dayStart.Unix(), monthStart: monthStart.Unix()}
+	var overrides models.SpendingLimits
+	if account.Limits != nil {
+		overrides = *account.Limits
+	}
+
+	if limits.DailyCount != nil {
+		spent, err := totals.get(ctx, overrides.DailyCount != nil)
+		if err != nil {
+			return err
+		}
+		if spent.DailyCount >= *limits.DailyCount {
+			remaining := max(*limits.DailyCount-spent.DailyCount, 0)
+			return &ExceededError{models.LimitExceeded{Limit: models.LimitDailyCount, RemainingCount: &remaining}}
+		}
+	}
+
+	if limits.Daily != nil {
+		spent, err := totals.get(ctx, overrides.Daily != nil)
+		if err != nil {
+			return err
+		}
+		if spent.Daily+amount.Minor > limits.Daily.Minor {
+			return exceededAmount(models.LimitDaily, *limits.Daily, spent.Daily)
+		}
+	}
+
+	if limits.Monthly != nil {
+		spent, err := totals.get(ctx, overrides.Monthly != nil)
+		if err != nil {
+			return err
+		}
+		if spent.Monthly+amount.Minor > limits.Monthly.Minor {
+			return exceededAmount(models.LimitMonthly, *limits.Monthly, spent.Monthly)
+		}
+	}
+
+	return nil
+}
+
+// debitTotals reads the debits made so far from an account and from all of the accounts of its holder, each at most
+// once however many limits need them
+type debitTotals struct {
+	store      database.MongoDBStore
+	account    *models.Account
+	dayStart   int64
+	monthStart int64
+	ofAccount  *models.DebitTotals
+	ofUser     *models.DebitTotals
+}
+
+// get returns the debits of the account alone for a limit set on the account, otherwise those of its holder
+func (t *debitTotals) get(ctx context.Context, accountLimit bool) (*models.DebitTotals, error) {
+	var err error
+	if accountLimit {
+		if t.ofAccount == nil {
+			t.ofAccount, err = t.store.GetDebitTotals(ctx, t.account.AccountID, t.dayStart, t.monthStart)
+		}
+		return t.ofAccount, err
+	}
+
+	if t.ofUser == nil {
+		if _, err := t.store.LockUser(ctx, t.account.UserID); err != nil {
+			return nil, err
+		}
+		t.ofUser, err = t.store.GetUserDebitTotals(ctx, t.account.UserID, t.account.Balance.Currency, t.dayStart, t.monthStart)
+	}
+	return t.ofUser, err
+}
+
+// exceededAmount reports a limit on amounts of which spent has been used up already
+func exceededAmount(name string, limit models.Money, spent int64) *ExceededError {
+	remaining := models.NewMoney(max(limit.Minor-spent, 0), limit.Currency)
+	return &ExceededError{models.LimitExceeded{Limit: name, RemainingAmount: &remaining}}
+}
@@ -0,0 +1,211 @@
+package limits
+
+import (
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// ngn returns a pointer to an amount of minor units in NGN
+func ngn(minor int64) *models.Money {
+	money := models.NewMoney(minor, "NGN")
+	return &money
+}
+
+func count(n int64) *int64 {
+	return &n
+}
+
+func Test_Check(t *testing.T) {
+	testCases := []struct {
+		name          string
+		limits        models.SpendingLimits
+		accountLimits *models.SpendingLimits
+		amount        int64
+		totals        *models.DebitTotals
+		accountTotals *models.DebitTotals
+		err           error
+		expected      *models.LimitExceeded
+	}{
+		{
+			name:   "Test debit without limits does not read the totals",
+			amount: 1_000_000,
+		},
+		{
+			name:   "Test debit within every limit",
+			limits: models.SpendingLimits{PerTransaction: ngn(5000), Daily: ngn(10000), Monthly: ngn(50000), DailyCount: count(5)},
+			amount: 5000,
+			totals: &models.DebitTotals{Daily: 5000, DailyCount: 4, Monthly: 45000},
+		},
+		{
+			name:     "Test debit over the per transaction limit",
+			limits:   models.SpendingLimits{PerTransaction: ngn(5000), Daily: ngn(10000)},
+			amount:   5001,
+			expected: &models.LimitExceeded{Limit: models.LimitPerTransaction, RemainingAmount: ngn(5000)},
+		},
+		{
+			name:     "Test debit over the daily count",
+			limits:   models.SpendingLimits{Daily: ngn(10000), DailyCount: count(5)},
+			amount:   100,
+			totals:   &models.DebitTotals{Daily: 500, DailyCount: 5, Monthly: 500},
+			expected: &models.LimitExceeded{Limit: models.LimitDailyCount, RemainingCount: count(0)},
+		},
+		{
+			name:     "Test debit over the daily total",
+			limits:   models.SpendingLimits{Daily: ngn(10000), Monthly: ngn(50000)},
+			amount:   2000,
+			totals:   &models.DebitTotals{Daily: 8500, DailyCount: 3, Monthly: 8500},
+			expected: &models.LimitExceeded{Limit: models.LimitDaily, RemainingAmount: ngn(1500)},
+		},
+		{
+			name:     "Test debit over the monthly total",
+			limits:   models.SpendingLimits{Daily: ngn(10000), Monthly: ngn(50000)},
+			amount:   2000,
+			totals:   &models.DebitTotals{Daily: 0, DailyCount: 0, Monthly: 49000},
+			expected: &models.LimitExceeded{Limit: models.LimitMonthly, RemainingAmount: ngn(1000)},
+		},
+		{
+			name:          "Test limit set on the account is checked against the debits of the account alone",
+			limits:        models.SpendingLimits{Daily: ngn(10000), Monthly: ngn(50000)},
+			accountLimits: &models.SpendingLimits{Daily: ngn(10000)},
+			amount:        2000,
+			totals:        &models.DebitTotals{Daily: 9000, DailyCount: 4, Monthly: 9000},
+			accountTotals: &models.DebitTotals{Daily: 1000, DailyCount: 1, Monthly: 1000},
+		},
+		{
+			name:          "Test limit of the tier is checked against the debits of every account of the user",
+			limits:        models.SpendingLimits{Daily: ngn(10000), Monthly: ngn(10000)},
+			accountLimits: &models.SpendingLimits{Daily: ngn(10000)},
+			amount:        2000,
+			totals:        &models.DebitTotals{Daily: 9000, DailyCount: 4, Monthly: 9000},
+			accountTotals: &models.DebitTotals{Daily: 1000, DailyCount: 1, Monthly: 1000},
+			expected:      &models.LimitExceeded{Limit: models.LimitMonthly, RemainingAmount: ngn(1000)},
+		},
+		{
+			name:   "Test error reading the totals",
+			limits: models.SpendingLimits{Monthly: ngn(50000)},
+			amount: 2000,
+			err:    errors.New("connection reset"),
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+
+	// assertPeriods checks that the totals are read since the start of the current day and month in UTC
+	assertPeriods := func(dayStart, monthStart int64) {
+		now := time.Now().UTC()
+		assert.Equal(t, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Unix(), dayStart)
+		assert.Equal(t, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Unix(), monthStart)
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mockAccount := &models.Account{
+				AccountID: "acc_001",
+				UserID:    "usr-001",
+				Balance:   models.NewMoney(100000, "NGN"),
+				Limits:    testCase.accountLimits,
+			}
+
+			if testCase.totals != nil || testCase.err != nil {
+				mockDataStore.
+					EXPECT().
+					LockUser(gomock.Any(), "usr-001").
+					Return(&models.User{Id: "usr-001"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserDebitTotals(gomock.Any(), "usr-001", "NGN", gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _, _ string, dayStart, monthStart int64) (*models.DebitTotals, error) {
+						assertPeriods(dayStart, monthStart)
+						return testCase.totals, testCase.err
+					})
+			}
+
+			if testCase.accountTotals != nil {
+				mockDataStore.
+					EXPECT().
+					GetDebitTotals(gomock.Any(), "acc_001", gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ context.Context, _ string, dayStart, monthStart int64) (*models.DebitTotals, error) {
+						assertPeriods(dayStart, monthStart)
+						return testCase.accountTotals, nil
+					})
+			}
+
+			err := Check(context.Background(), mockDataStore, mockAccount, testCase.limits, models.NewMoney(testCase.amount, "NGN"))
+
+			switch {
+			case testCase.err != nil:
+				assert.ErrorIs(t, err, testCase.err)
+			case testCase.expected != nil:
+				assert.ErrorIs(t, err, ErrLimitExceeded)
+
+				var exceeded *ExceededError
+				assert.ErrorAs(t, err, &exceeded)
+				assert.Equal(t, *testCase.expected, exceeded.LimitExceeded)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	tiers := Tiers{
+		"standard": {
+			"NGN": {PerTransaction: ngn(5000), Daily: ngn(10000), DailyCount: count(10)},
+		},
+		"premium": {
+			"NGN": {PerTransaction: ngn(50000), Daily: ngn(100000)},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		user     *models.User
+		account  *models.Account
+		expected models.SpendingLimits
+	}{
+		{
+			name:     "Test user without a tier gets the default tier",
+			user:     &models.User{Id: "usr-001"},
+			account:  &models.Account{Balance: models.NewMoney(0, "NGN")},
+			expected: models.SpendingLimits{PerTransaction: ngn(5000), Daily: ngn(10000), DailyCount: count(10)},
+		},
+		{
+			name:     "Test user gets the limits of their tier",
+			user:     &models.User{Id: "usr-001", Tier: "premium"},
+			account:  &models.Account{Balance: models.NewMoney(0, "NGN")},
+			expected: models.SpendingLimits{PerTransaction: ngn(50000), Daily: ngn(100000)},
+		},
+		{
+			name: "Test limits set on the account take precedence",
+			user: &models.User{Id: "usr-001"},
+			account: &models.Account{
+				Balance: models.NewMoney(0, "NGN"),
+				Limits:  &models.SpendingLimits{Daily: ngn(2000), Monthly: ngn(20000)},
+			},
+			expected: models.SpendingLimits{PerTransaction: ngn(5000), Daily: ngn(2000), Monthly: ngn(20000), DailyCount: count(10)},
+		},
+		{
+			name:    "Test tier without limits in the account currency",
+			user:    &models.User{Id: "usr-001", Tier: "premium"},
+			account: &models.Account{Balance: models.NewMoney(0, "USD")},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, Resolve(tiers, "standard", testCase.user, testCase.account))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_New(t *testing.T) {
+	testCases := []struct {
+		name          string
+		level         string
+		format        string
+		expectDebug   bool
+		expectedStart string
+	}{
+		{
+			name:          "Test json at info level",
+			level:         "info",
+			format:        "json",
+			expectedStart: "{",
+		},
+		{
+			name:          "Test text at debug level",
+			level:         "debug",
+			format:        "text",
+			expectDebug:   true,
+			expectedStart: "time=",
+		},
+		{
+			name:          "Test unknown values fall back to json at info level",
+			level:         "verbose",
+			format:        "xml",
+			expectedStart: "{",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			logger := New(&buffer, testCase.level, testCase.format)
+
+			logger.Debug("debug message")
+			assert.Equal(t, testCase.expectDebug, strings.Contains(buffer.String(), "debug message"))
+
+			buffer.Reset()
+			logger.Info("info message")
+			assert.True(t, strings.HasPrefix(buffer.String(), testCase.expectedStart))
+		})
+	}
+}
+
+func Test_RequestIDMiddleware(t *testing.T) {
+	testCases := []struct {
+		name       string
+		requestID  string
+		expectSame bool
+	}{
+		{
+			name:       "Test request ID sent by client is kept",
+			requestID:  "req-0001",
+			expectSame: true,
+		},
+		{
+			name: "Test request ID is generated when missing",
+		},
+		{
+			name:      "Test malformed request ID is replaced",
+			requestID: "bad id\nwith newline",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var seen string
+			handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+			}))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if testCase.requestID != "" {
+				r.Header.Set(RequestIDHeader, testCase.requestID)
+			}
+
+			handler.ServeHTTP(w, r)
+
+			assert.NotEmpty(t, seen)
+			assert.Equal(t, seen, w.Header().Get(RequestIDHeader))
+			assert.Equal(t, testCase.expectSame, seen == testCase.requestID)
+		})
+	}
+}
+
+func Test_FromContext(t *testing.T) {
+	var buffer bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(New(&buffer, "info", "json"))
+	defer slog.SetDefault(defaultLogger)
+
+	FromContext(WithRequestID(context.Background(), "req-0001")).Info("payment received")
+
+	var entry map[string]any
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &entry))
+	assert.Equal(t, "req-0001", entry["request_id"])
+	assert.Equal(t, "payment received", entry["msg"])
+}
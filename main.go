@@ -4,13 +4,27 @@ import (
 	"consumer-payment-service/client"
 	"consumer-payment-service/database/mongodb"
 	"consumer-payment-service/environment"
+	"consumer-payment-service/logging"
+	"consumer-payment-service/metrics"
+	"consumer-payment-service/reconciler"
+	"consumer-payment-service/tracing"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	srv "consumer-payment-service/server"
 
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
@@ -20,22 +34,157 @@ func main() {
 		log.Fatal("Error loading env ")
 	}
 
+	// stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	cfg := environment.LoadConfig()
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat))
+
+	if err := Run(ctx, cfg); err != nil {
+		slog.Error("service stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// Run starts the service and blocks until ctx is cancelled or the HTTP server fails. On the way out in-flight
+// requests are drained, background workers are stopped and the MongoDB connection is closed.
+func Run(ctx context.Context, cfg *environment.Config) error {
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Error("error flushing traces", "error", err)
+		}
+	}()
 
 	// Get mongodb instance
-	store, _, err := mongodb.New(cfg.DatabaseURI, cfg.DatabaseName)
+	store, mongoClient, err := mongodb.New(ctx, cfg.DatabaseURI, cfg.DatabaseName, cfg.DatabaseTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to establish MongoDB connection: %w", err)
+	}
+
+	defer func() {
+		disconnectCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+
+		if err := mongoClient.Disconnect(disconnectCtx); err != nil {
+			slog.Error("error disconnecting from MongoDB", "error", err)
+		}
+	}()
+
+	// convert amounts written before money was stored in minor units
+	if cfg.DefaultCurrency != "" {
+		if err := mongodb.MigrateFloatAmounts(ctx, mongoClient, cfg.DatabaseName, cfg.DefaultCurrency); err != nil {
+			return fmt.Errorf("failed to migrate float amounts: %w", err)
+		}
+	}
+
+	// accounts opened before holds could be placed have all of their balance available
+	if err := mongodb.MigrateAvailableBalances(ctx, mongoClient, cfg.DatabaseName); err != nil {
+		return fmt.Errorf("failed to migrate available balances: %w", err)
+	}
+
+	// give balances funded before the ledger was kept an opening entry so that the ledger accounts for them
+	if err := mongodb.MigrateOpeningBalances(ctx, mongoClient, cfg.DatabaseName); err != nil {
+		return fmt.Errorf("failed to migrate opening balances: %w", err)
+	}
+
+	tracerProvider := otel.GetTracerProvider()
+
+	// Get instance of third party payment service client, its requests carry the trace context to the provider
+	paymentClient := client.NewPaymentAPIClientWithHTTPClient(cfg, &http.Client{
+		Transport: tracing.Transport(http.DefaultTransport, tracerProvider),
+	})
+
+	// record store and provider latency for /metrics
+	serviceMetrics := metrics.New()
+	store = metrics.InstrumentStore(store, serviceMetrics)
+	paymentClient = metrics.InstrumentClient(paymentClient, serviceMetrics)
+
+	// trace store and provider calls under the span of the request or job that made them
+	store = tracing.TraceStore(store, tracerProvider)
+	paymentClient = tracing.TraceClient(paymentClient, tracerProvider)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.PORT))
 	if err != nil {
-		log.Fatal("failed to establish MongoDB connection ", cfg.DatabaseURI)
+		return fmt.Errorf("failed to listen on port %s: %w", cfg.PORT, err)
+	}
+
+	healthHandler := srv.NewHealthHandler(cfg, store, paymentClient)
+	httpServer := &http.Server{
+		Handler:      srv.MountServer(cfg, store, paymentClient, healthHandler, serviceMetrics, tracerProvider),
+		ReadTimeout:  cfg.HTTPReadTimeout,
+		WriteTimeout: cfg.HTTPWriteTimeout,
+		IdleTimeout:  cfg.HTTPIdleTimeout,
+	}
+
+	// fail readiness first and keep serving for a while so that load balancers stop routing new requests
+	drain := func() {
+		healthHandler.SetDraining()
+		time.Sleep(cfg.ShutdownDrainDelay)
+	}
+
+	return serve(ctx, httpServer, listener, cfg.ShutdownTimeout, drain,
+		// finalize payments left pending when the outcome of the provider call was not recorded
+		reconciler.New(cfg, store, paymentClient).Run,
+	)
+}
+
+// worker is a background job that runs until its context is cancelled
+type worker func(ctx context.Context)
+
+// serve runs httpServer on listener together with workers until ctx is cancelled. It then calls drain and gives
+// in-flight requests up to shutdownTimeout to finish before stopping the workers.
+func serve(ctx context.Context, httpServer *http.Server, listener net.Listener, shutdownTimeout time.Duration, drain func(), workers ...worker) error {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer func() {
+		stopWorkers()
+		wg.Wait()
+	}()
+
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w worker) {
+			defer wg.Done()
+			w(workerCtx)
+		}(w)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		// start HTTP server
+		slog.Info("starting HTTP service", "address", listener.Addr().String())
+		serverErr <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serverErr:
+		return fmt.Errorf("error running http server: %w", err)
+	case <-ctx.Done():
 	}
 
-	// Get instance of third party payment service client
-	paymentClient := client.NewPaymentAPIClient(cfg)
+	slog.Info("shutting down HTTP service, draining in-flight requests")
+	drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		// drop the connections still open so that the workers and database can be stopped
+		httpServer.Close()
+		return fmt.Errorf("error draining http server: %w", err)
+	}
 
-	addr := fmt.Sprintf(":%s", cfg.PORT)
-	router := srv.MountServer(cfg, store, paymentClient)
-	// start HTTP server
-	fmt.Println(fmt.Sprintf("starting HTTP service running on port %v", addr))
-	if err := http.ListenAndServe(addr, router); err != nil {
-		log.Fatal("error starting http server")
+	if err := <-serverErr; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("error running http server: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"consumer-payment-service/environment"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_serve(t *testing.T) {
+	const (
+		drainsInFlightRequests = iota
+		errorShutdownDeadlineExceeded
+	)
+
+	testCases := []struct {
+		name            string
+		shutdownTimeout time.Duration
+		requestDuration time.Duration
+		testType        int
+	}{
+		{
+			name:            "Test in-flight requests finish before shutdown",
+			shutdownTimeout: 5 * time.Second,
+			requestDuration: 200 * time.Millisecond,
+			testType:        drainsInFlightRequests,
+		},
+
+		{
+			name:            "Test error when in-flight requests outlive the shutdown timeout",
+			shutdownTimeout: 50 * time.Millisecond,
+			requestDuration: 2 * time.Second,
+			testType:        errorShutdownDeadlineExceeded,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+
+			started := make(chan struct{})
+			httpServer := &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					close(started)
+					time.Sleep(testCase.requestDuration)
+					w.WriteHeader(http.StatusOK)
+				}),
+			}
+
+			var drained, workerStopped atomic.Bool
+			drain := func() {
+				drained.Store(true)
+			}
+
+			worker := func(ctx context.Context) {
+				<-ctx.Done()
+				workerStopped.Store(true)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			serveErr := make(chan error, 1)
+			go func() {
+				serveErr <- serve(ctx, httpServer, listener, testCase.shutdownTimeout, drain, worker)
+			}()
+
+			responseStatus := make(chan int, 1)
+			go func() {
+				resp, err := http.Get(fmt.Sprintf("http://%s/", listener.Addr()))
+				if err != nil {
+					responseStatus <- 0
+					return
+				}
+				defer resp.Body.Close()
+				responseStatus <- resp.StatusCode
+			}()
+
+			<-started
+			cancel()
+
+			switch testCase.testType {
+			case drainsInFlightRequests:
+				assert.NoError(t, <-serveErr)
+				assert.Equal(t, http.StatusOK, <-responseStatus)
+				assert.True(t, drained.Load())
+				assert.True(t, workerStopped.Load())
+
+			case errorShutdownDeadlineExceeded:
+				err := <-serveErr
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.True(t, workerStopped.Load())
+			}
+		})
+	}
+}
+
+func Test_Run_DatabaseUnavailable(t *testing.T) {
+	cfg := &environment.Config{
+		DatabaseURI:     "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=200",
+		DatabaseName:    "banking-app",
+		PORT:            "0",
+		ShutdownTimeout: time.Second,
+	}
+
+	err := Run(context.Background(), cfg)
+	assert.ErrorContains(t, err, "failed to establish MongoDB connection")
+}
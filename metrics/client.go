@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+type instrumentedClient struct {
+	next    client.ThirdPartyAPIClient
+	metrics *Metrics
+}
+
+// InstrumentClient returns a ThirdPartyAPIClient that records the latency and status code of every provider call
+func InstrumentClient(paymentClient client.ThirdPartyAPIClient, metrics *Metrics) client.ThirdPartyAPIClient {
+	return &instrumentedClient{next: paymentClient, metrics: metrics}
+}
+
+func (c *instrumentedClient) observe(method string, start time.Time, err error) {
+	c.metrics.providerDuration.WithLabelValues(method, providerStatusCode(err)).Observe(time.Since(start).Seconds())
+}
+
+// providerStatusCode labels a call with the status the provider answered with, calls that never got an answer
+// are labelled "none". Successful calls only tell us the status was below 400.
+func providerStatusCode(err error) string {
+	var providerErr *client.ProviderError
+	switch {
+	case err == nil:
+		return "2xx"
+	case errors.As(err, &providerErr):
+		return strconv.Itoa(providerErr.StatusCode)
+	}
+	return "none"
+}
+
+func (c *instrumentedClient) MakeDeposit(ctx context.Context, accountId, reference string, amount models.Money) (resp *client.PaymentResponse, err error) {
+	defer func(start time.Time) { c.observe("MakeDeposit", start, err) }(time.Now())
+	return c.next.MakeDeposit(ctx, accountId, reference, amount)
+}
+
+func (c *instrumentedClient) MakeWithdrawal(ctx context.Context, accountId, reference string, amount models.Money) (resp *client.PaymentResponse, err error) {
+	defer func(start time.Time) { c.observe("MakeWithdrawal", start, err) }(time.Now())
+	return c.next.MakeWithdrawal(ctx, accountId, reference, amount)
+}
+
+func (c *instrumentedClient) RetrieveTransaction(ctx context.Context, reference string) (resp *client.PaymentResponse, err error) {
+	defer func(start time.Time) { c.observe("RetrieveTransaction", start, err) }(time.Now())
+	return c.next.RetrieveTransaction(ctx, reference)
+}
+
+func (c *instrumentedClient) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { c.observe("Ping", start, err) }(time.Now())
+	return c.next.Ping(ctx)
+}
+
+func (c *instrumentedClient) CircuitState() client.CircuitState {
+	return c.next.CircuitState()
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "payment_service"
+
+// Payment outcomes recorded by the payments counter
+const (
+	OutcomeSuccess       = "success"
+	OutcomeReplayed      = "replayed"
+	OutcomeRejected      = "rejected"
+	OutcomeProviderError = "provider_error"
+	OutcomeError         = "error"
+)
+
+// Metrics holds the collectors exposed on /metrics, it is registered on its own registry so tests can create
+// as many as they need.
+type Metrics struct {
+	registry         *prometheus.Registry
+	payments         *prometheus.CounterVec
+	storeDuration    *prometheus.HistogramVec
+	providerDuration *prometheus.HistogramVec
+	inFlight         prometheus.Gauge
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		payments: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payments_total",
+			Help:      "Credit, debit, transfer, reversal, authorization and capture attempts by outcome.",
+		}, []string{"type", "outcome"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_duration_seconds",
+			Help:      "Latency of MongoDBStore calls by method and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "outcome"}),
+		providerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "provider_request_duration_seconds",
+			Help:      "Latency of payment provider calls by method and HTTP status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "status_code"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.payments,
+		m.storeDuration,
+		m.providerDuration,
+		m.inFlight,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler serves the collected metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// InFlight tracks the number of requests being served by next
+func (m *Metrics) InFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CountPayments counts the payment attempts served by next by the outcome of their response
+func (m *Metrics) CountPayments(paymentType string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(recorder, r)
+
+			m.payments.WithLabelValues(paymentType, paymentOutcome(recorder)).Inc()
+		})
+	}
+}
+
+func paymentOutcome(recorder middleware.WrapResponseWriter) string {
+	// a handler that writes nothing is answered with 200 by net/http
+	statusCode := recorder.Status()
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	switch {
+	case recorder.Header().Get("Idempotent-Replayed") == "true":
+		return OutcomeReplayed
+	case statusCode < http.StatusBadRequest:
+		return OutcomeSuccess
+	case statusCode < http.StatusInternalServerError:
+		return OutcomeRejected
+	case statusCode == http.StatusBadGateway, statusCode == http.StatusServiceUnavailable:
+		return OutcomeProviderError
+	}
+	return OutcomeError
+}
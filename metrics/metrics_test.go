@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/limits"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+// sampleCount returns how many observations a histogram has recorded for labels
+func sampleCount(t *testing.T, histogram *prometheus.HistogramVec, labels ...string) uint64 {
+	metric := &dto.Metric{}
+	assert.NoError(t, histogram.WithLabelValues(labels...).(prometheus.Histogram).Write(metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func Test_Metrics_CountPayments(t *testing.T) {
+	testCases := []struct {
+		name            string
+		statusCode      int
+		replayed        bool
+		expectedOutcome string
+	}{
+		{
+			name:            "Test successful payment",
+			statusCode:      http.StatusOK,
+			expectedOutcome: OutcomeSuccess,
+		},
+		{
+			name:            "Test replayed payment",
+			statusCode:      http.StatusOK,
+			replayed:        true,
+			expectedOutcome: OutcomeReplayed,
+		},
+		{
+			name:            "Test rejected payment",
+			statusCode:      http.StatusUnprocessableEntity,
+			expectedOutcome: OutcomeRejected,
+		},
+		{
+			name:            "Test payment failed at provider",
+			statusCode:      http.StatusBadGateway,
+			expectedOutcome: OutcomeProviderError,
+		},
+		{
+			name:            "Test payment provider unavailable",
+			statusCode:      http.StatusServiceUnavailable,
+			expectedOutcome: OutcomeProviderError,
+		},
+		{
+			name:            "Test payment failed with internal error",
+			statusCode:      http.StatusInternalServerError,
+			expectedOutcome: OutcomeError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			m := New()
+			handler := m.CountPayments(string(models.CREDIT))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if testCase.replayed {
+					w.Header().Set("Idempotent-Replayed", "true")
+				}
+				w.WriteHeader(testCase.statusCode)
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/payments/credit", nil))
+
+			assert.Equal(t, float64(1), testutil.ToFloat64(m.payments.WithLabelValues(string(models.CREDIT), testCase.expectedOutcome)))
+			assert.Equal(t, 1, testutil.CollectAndCount(m.payments))
+		})
+	}
+}
+
+func Test_Metrics_InFlight(t *testing.T) {
+	m := New()
+
+	handler := m.InFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.inFlight))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.inFlight))
+}
+
+func Test_Metrics_Handler(t *testing.T) {
+	m := New()
+	m.payments.WithLabelValues(string(models.DEBIT), OutcomeSuccess).Inc()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `payment_service_payments_total{outcome="success",type="DEBIT"} 1`)
+	assert.Contains(t, w.Body.String(), "payment_service_http_requests_in_flight")
+}
+
+func Test_InstrumentStore(t *testing.T) {
+	testCases := []struct {
+		name            string
+		err             error
+		expectedOutcome string
+	}{
+		{
+			name:            "Test successful call",
+			expectedOutcome: "ok",
+		},
+		{
+			name:            "Test call rejected by the store",
+			err:             database.ErrAccountNotFound,
+			expectedOutcome: "rejected",
+		},
+		{
+			name:            "Test call rejected by the spending limits",
+			err:             &limits.ExceededError{LimitExceeded: models.LimitExceeded{Limit: models.LimitDaily}},
+			expectedOutcome: "rejected",
+		},
+		{
+			name:            "Test failed call",
+			err:             errors.New("connection reset"),
+			expectedOutcome: "error",
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			m := New()
+			store := InstrumentStore(mockDataStore, m)
+
+			mockDataStore.
+				EXPECT().
+				GetAccountByID(gomock.Any(), "acc_001").
+				Return(nil, testCase.err)
+
+			_, err := store.GetAccountByID(context.Background(), "acc_001")
+			assert.Equal(t, testCase.err, err)
+			assert.Equal(t, uint64(1), sampleCount(t, m.storeDuration, "GetAccountByID", testCase.expectedOutcome))
+		})
+	}
+
+	t.Run("Test calls inside a transaction are recorded", func(t *testing.T) {
+		m := New()
+		store := InstrumentStore(mockDataStore, m)
+
+		mockDataStore.
+			EXPECT().
+			WithTx(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, fn func(database.MongoDBStore) error) error {
+				return fn(mockDataStore)
+			})
+
+		mockDataStore.
+			EXPECT().
+			UpdateTransactionStatus(gomock.Any(), "ref-001", models.SUCCESS).
+			Return(nil)
+
+		err := store.WithTx(context.Background(), func(store database.MongoDBStore) error {
+			return store.UpdateTransactionStatus(context.Background(), "ref-001", models.SUCCESS)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), sampleCount(t, m.storeDuration, "WithTx", "ok"))
+		assert.Equal(t, uint64(1), sampleCount(t, m.storeDuration, "UpdateTransactionStatus", "ok"))
+	})
+}
+
+func Test_InstrumentClient(t *testing.T) {
+	testCases := []struct {
+		name               string
+		err                error
+		expectedStatusCode string
+	}{
+		{
+			name:               "Test successful call",
+			expectedStatusCode: "2xx",
+		},
+		{
+			name:               "Test error response from provider",
+			err:                &client.ProviderError{StatusCode: http.StatusServiceUnavailable, Message: "unavailable"},
+			expectedStatusCode: "503",
+		},
+		{
+			name:               "Test provider unreachable",
+			err:                errors.New("connection refused"),
+			expectedStatusCode: "none",
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			m := New()
+			paymentClient := InstrumentClient(mockThirdPartyClient, m)
+
+			mockThirdPartyClient.
+				EXPECT().
+				RetrieveTransaction(gomock.Any(), "ref-001").
+				Return(nil, testCase.err)
+
+			_, err := paymentClient.RetrieveTransaction(context.Background(), "ref-001")
+			assert.Equal(t, testCase.err, err)
+			assert.Equal(t, uint64(1), sampleCount(t, m.providerDuration, "RetrieveTransaction", testCase.expectedStatusCode))
+		})
+	}
+}
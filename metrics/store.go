@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/limits"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"time"
+)
+
+type instrumentedStore struct {
+	next    database.MongoDBStore
+	metrics *Metrics
+}
+
+// InstrumentStore returns a MongoDBStore that records the latency of every call made to store
+func InstrumentStore(store database.MongoDBStore, metrics *Metrics) database.MongoDBStore {
+	return &instrumentedStore{next: store, metrics: metrics}
+}
+
+func (s *instrumentedStore) observe(method string, start time.Time, err error) {
+	s.metrics.storeDuration.WithLabelValues(method, storeOutcome(err)).Observe(time.Since(start).Seconds())
+}
+
+// storeOutcome separates the expected domain errors of the database and limits packages from failures of the store
+// itself
+func storeOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, database.ErrUserNotFound),
+		errors.Is(err, database.ErrAccountNotFound),
+		errors.Is(err, database.ErrAccountNotOwned),
+		errors.Is(err, database.ErrTransactionNotFound),
+		errors.Is(err, database.ErrTransactionNotPending),
+		errors.Is(err, database.ErrDuplicateReference),
+		errors.Is(err, database.ErrInsufficientFunds),
+		errors.Is(err, database.ErrCurrencyMismatch),
+		errors.Is(err, database.ErrTransactionNotReversible),
+		errors.Is(err, database.ErrReversalExceedsAmount),
+		errors.Is(err, database.ErrHoldNotActive),
+		errors.Is(err, database.ErrCaptureExceedsHold),
+		errors.Is(err, database.ErrAccountClosed),
+		errors.Is(err, database.ErrAccountBalanceNotZero),
+		errors.Is(err, database.ErrAccountHasPendingPayments),
+		errors.Is(err, limits.ErrLimitExceeded):
+		return "rejected"
+	}
+	return "error"
+}
+
+func (s *instrumentedStore) GetAccountByID(ctx context.Context, accountId string) (account *models.Account, err error) {
+	defer func(start time.Time) { s.observe("GetAccountByID", start, err) }(time.Now())
+	return s.next.GetAccountByID(ctx, accountId)
+}
+
+func (s *instrumentedStore) GetUserAccount(ctx context.Context, userId, accountId string) (account *models.Account, err error) {
+	defer func(start time.Time) { s.observe("GetUserAccount", start, err) }(time.Now())
+	return s.next.GetUserAccount(ctx, userId, accountId)
+}
+
+func (s *instrumentedStore) AdjustAccountBalance(ctx context.Context, accountId string, amount models.Money) (account *models.Account, err error) {
+	defer func(start time.Time) { s.observe("AdjustAccountBalance", start, err) }(time.Now())
+	return s.next.AdjustAccountBalance(ctx, accountId, amount)
+}
+
+func (s *instrumentedStore) AdjustAvailableBalance(ctx context.Context, accountId string, amount models.Money) (account *models.Account, err error) {
+	defer func(start time.Time) { s.observe("AdjustAvailableBalance", start, err) }(time.Now())
+	return s.next.AdjustAvailableBalance(ctx, accountId, amount)
+}
+
+func (s *instrumentedStore) LockAccount(ctx context.Context, accountId string) (account *models.Account, err error) {
+	defer func(start time.Time) { s.observe("LockAccount", start, err) }(time.Now())
+	return s.next.LockAccount(ctx, accountId)
+}
+
+func (s *instrumentedStore) CreateTransaction(ctx context.Context, transaction *models.Transaction) (err error) {
+	defer func(start time.Time) { s.observe("CreateTransaction", start, err) }(time.Now())
+	return s.next.CreateTransaction(ctx, transaction)
+}
+
+func (s *instrumentedStore) GetPaymentByReferenceId(ctx context.Context, referenceId string) (transaction *models.Transaction, err error) {
+	defer func(start time.Time) { s.observe("GetPaymentByReferenceId", start, err) }(time.Now())
+	return s.next.GetPaymentByReferenceId(ctx, referenceId)
+}
+
+func (s *instrumentedStore) UpdateTransactionStatus(ctx context.Context, referenceId string, status models.TransactionStatus) (err error) {
+	defer func(start time.Time) { s.observe("UpdateTransactionStatus", start, err) }(time.Now())
+	return s.next.UpdateTransactionStatus(ctx, referenceId, status)
+}
+
+func (s *instrumentedStore) FailTransaction(ctx context.Context, referenceId, reason string, providerStatusCode int, failureKind string) (err error) {
+	defer func(start time.Time) { s.observe("FailTransaction", start, err) }(time.Now())
+	return s.next.FailTransaction(ctx, referenceId, reason, providerStatusCode, failureKind)
+}
+
+func (s *instrumentedStore) AdjustReversedAmount(ctx context.Context, referenceId string, amount models.Money) (transaction *models.Transaction, err error) {
+	defer func(start time.Time) { s.observe("AdjustReversedAmount", start, err) }(time.Now())
+	return s.next.AdjustReversedAmount(ctx, referenceId, amount)
+}
+
+func (s *instrumentedStore) CaptureHold(ctx context.Context, referenceId string, amount models.Money) (transaction *models.Transaction, err error) {
+	defer func(start time.Time) { s.observe("CaptureHold", start, err) }(time.Now())
+	return s.next.CaptureHold(ctx, referenceId, amount)
+}
+
+func (s *instrumentedStore) ReleaseHold(ctx context.Context, referenceId string, status models.TransactionStatus) (transaction *models.Transaction, err error) {
+	defer func(start time.Time) { s.observe("ReleaseHold", start, err) }(time.Now())
+	return s.next.ReleaseHold(ctx, referenceId, status)
+}
+
+func (s *instrumentedStore) GetExpiredHolds(ctx context.Context, expiredBy int64, after *models.TransactionCursor, limit int64) (transactions []models.Transaction, err error) {
+	defer func(start time.Time) { s.observe("GetExpiredHolds", start, err) }(time.Now())
+	return s.next.GetExpiredHolds(ctx, expiredBy, after, limit)
+}
+
+func (s *instrumentedStore) GetTransactionByIdempotencyKey(ctx context.Context, key string) (transaction *models.Transaction, err error) {
+	defer func(start time.Time) { s.observe("GetTransactionByIdempotencyKey", start, err) }(time.Now())
+	return s.next.GetTransactionByIdempotencyKey(ctx, key)
+}
+
+func (s *instrumentedStore) GetPendingTransactions(ctx context.Context, createdBefore int64, after *models.TransactionCursor, limit int64) (transactions []models.Transaction, err error) {
+	defer func(start time.Time) { s.observe("GetPendingTransactions", start, err) }(time.Now())
+	return s.next.GetPendingTransactions(ctx, createdBefore, after, limit)
+}
+
+func (s *instrumentedStore) ListTransactions(ctx context.Context, filter models.TransactionFilter) (transactions []models.Transaction, err error) {
+	defer func(start time.Time) { s.observe("ListTransactions", start, err) }(time.Now())
+	return s.next.ListTransactions(ctx, filter)
+}
+
+func (s *instrumentedStore) GetDebitTotals(ctx context.Context, accountId string, dayStart, monthStart int64) (totals *models.DebitTotals, err error) {
+	defer func(start time.Time) { s.observe("GetDebitTotals", start, err) }(time.Now())
+	return s.next.GetDebitTotals(ctx, accountId, dayStart, monthStart)
+}
+
+func (s *instrumentedStore) GetUserDebitTotals(ctx context.Context, userId, currency string, dayStart, monthStart int64) (totals *models.DebitTotals, err error) {
+	defer func(start time.Time) { s.observe("GetUserDebitTotals", start, err) }(time.Now())
+	return s.next.GetUserDebitTotals(ctx, userId, currency, dayStart, monthStart)
+}
+
+func (s *instrumentedStore) GetUserById(ctx context.Context, userId string) (user *models.User, err error) {
+	defer func(start time.Time) { s.observe("GetUserById", start, err) }(time.Now())
+	return s.next.GetUserById(ctx, userId)
+}
+
+func (s *instrumentedStore) LockUser(ctx context.Context, userId string) (user *models.User, err error) {
+	defer func(start time.Time) { s.observe("LockUser", start, err) }(time.Now())
+	return s.next.LockUser(ctx, userId)
+}
+
+func (s *instrumentedStore) CreateUser(ctx context.Context, user *models.User) (err error) {
+	defer func(start time.Time) { s.observe("CreateUser", start, err) }(time.Now())
+	return s.next.CreateUser(ctx, user)
+}
+
+func (s *instrumentedStore) CreateAccount(ctx context.Context, account *models.Account) (err error) {
+	defer func(start time.Time) { s.observe("CreateAccount", start, err) }(time.Now())
+	return s.next.CreateAccount(ctx, account)
+}
+
+func (s *instrumentedStore) SetUserTier(ctx context.Context, userId, tier string) (user *models.User, err error) {
+	defer func(start time.Time) { s.observe("SetUserTier", start, err) }(time.Now())
+	return s.next.SetUserTier(ctx, userId, tier)
+}
+
+func (s *instrumentedStore) GetUserAccounts(ctx context.Context, userId string) (accounts []models.Account, err error) {
+	defer func(start time.Time) { s.observe("GetUserAccounts", start, err) }(time.Now())
+	return s.next.GetUserAccounts(ctx, userId)
+}
+
+func (s *instrumentedStore) CloseAccount(ctx context.Context, accountId string) (account *models.Account, err error) {
+	defer func(start time.Time) { s.observe("CloseAccount", start, err) }(time.Now())
+	return s.next.CloseAccount(ctx, accountId)
+}
+
+func (s *instrumentedStore) SetAccountLimits(ctx context.Context, accountId string, limits *models.SpendingLimits) (account *models.Account, err error) {
+	defer func(start time.Time) { s.observe("SetAccountLimits", start, err) }(time.Now())
+	return s.next.SetAccountLimits(ctx, accountId, limits)
+}
+
+func (s *instrumentedStore) GetAccounts(ctx context.Context, after string, limit int64) (accounts []models.Account, err error) {
+	defer func(start time.Time) { s.observe("GetAccounts", start, err) }(time.Now())
+	return s.next.GetAccounts(ctx, after, limit)
+}
+
+func (s *instrumentedStore) CreateJournalEntry(ctx context.Context, entry *models.JournalEntry) (err error) {
+	defer func(start time.Time) { s.observe("CreateJournalEntry", start, err) }(time.Now())
+	return s.next.CreateJournalEntry(ctx, entry)
+}
+
+func (s *instrumentedStore) GetJournalEntries(ctx context.Context, after string, limit int64) (entries []models.JournalEntry, err error) {
+	defer func(start time.Time) { s.observe("GetJournalEntries", start, err) }(time.Now())
+	return s.next.GetJournalEntries(ctx, after, limit)
+}
+
+func (s *instrumentedStore) GetLedgerBalances(ctx context.Context, after, until string) (balances []models.LedgerBalance, err error) {
+	defer func(start time.Time) { s.observe("GetLedgerBalances", start, err) }(time.Now())
+	return s.next.GetLedgerBalances(ctx, after, until)
+}
+
+// WithTx times the whole unit of work and keeps timing the calls made inside it
+func (s *instrumentedStore) WithTx(ctx context.Context, fn func(store database.MongoDBStore) error) (err error) {
+	defer func(start time.Time) { s.observe("WithTx", start, err) }(time.Now())
+	return s.next.WithTx(ctx, func(store database.MongoDBStore) error {
+		return fn(InstrumentStore(store, s.metrics))
+	})
+}
+
+func (s *instrumentedStore) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { s.observe("Ping", start, err) }(time.Now())
+	return s.next.Ping(ctx)
+}
@@ -1,16 +1,39 @@
 package models
 
+// User holds accounts, Tier picks the spending limits that apply to their accounts
 type User struct {
-	Id        string `bson:"user_id"`
-	Name      string `bson:"account"`
-	CreatedAt int64  `bson:"created_at"`
+	Id        string `bson:"user_id" json:"user_id"`
+	Name      string `bson:"account" json:"name"`
+	Tier      string `bson:"tier,omitempty" json:"tier,omitempty"`
+	CreatedAt int64  `bson:"created_at" json:"created_at"`
 }
 
+type AccountStatus string
+
+// Accounts written before accounts could be closed have no status and are open
+const (
+	ACTIVE AccountStatus = "ACTIVE"
+	CLOSED AccountStatus = "CLOSED"
+)
+
+// Account holds money in a single currency. Balance is the ledger balance, the money the account holds according
+// to the ledger, and Available is what is left of it once the holds placed on the account are taken out. Money can
+// only leave an account while its available balance covers it. Limits set on the account take precedence over the
+// spending limits of the tier of its holder.
 type Account struct {
-	AccountID string  `bson:"account_id"`
-	Balance   float64 `bson:"balance"`
-	UserID    string  `bson:"user_id"`
-	CreatedAt int64   `bson:"created_at"`
+	AccountID string          `bson:"account_id" json:"account_id"`
+	Balance   Money           `bson:"balance" json:"balance"`
+	Available Money           `bson:"available" json:"available"`
+	UserID    string          `bson:"user_id" json:"user_id"`
+	Status    AccountStatus   `bson:"status,omitempty" json:"status,omitempty"`
+	Limits    *SpendingLimits `bson:"limits,omitempty" json:"limits,omitempty"`
+	CreatedAt int64           `bson:"created_at" json:"created_at"`
+	ClosedAt  int64           `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+}
+
+// Closed reports whether the account can no longer take payments
+func (a Account) Closed() bool {
+	return a.Status == CLOSED
 }
 
 type TransactionType string
@@ -22,17 +45,85 @@ const (
 
 type TransactionStatus string
 
+// A SUCCESS payment becomes PARTIALLY_REVERSED or REVERSED as reversals of it are made. An AUTHORIZED debit holds
+// its amount on the account until it is captured, which makes it PENDING like any other debit, or VOIDED or EXPIRED.
 const (
-	SUCCESS TransactionStatus = "SUCCESS"
-	FAILED  TransactionStatus = "FAILED"
+	PENDING            TransactionStatus = "PENDING"
+	SUCCESS            TransactionStatus = "SUCCESS"
+	FAILED             TransactionStatus = "FAILED"
+	PARTIALLY_REVERSED TransactionStatus = "PARTIALLY_REVERSED"
+	REVERSED           TransactionStatus = "REVERSED"
+	AUTHORIZED         TransactionStatus = "AUTHORIZED"
+	VOIDED             TransactionStatus = "VOIDED"
+	EXPIRED            TransactionStatus = "EXPIRED"
 )
 
+// Transaction is a payment attempt, FailureReason and ProviderStatusCode record why the payment provider
+// rejected a FAILED one and FailureKind how that answer was classified. The DEBIT and CREDIT legs of a transfer between two accounts share a TransferID and
+// name the other account as CounterpartyAccountID. A reversal names the payment it undoes as OriginalReference,
+// ReversedAmount on that payment sums its reversals, including those still in flight. An authorization can be
+// captured until ExpiresAt, AuthorizedAmount records what it held once a capture has set Amount to what is paid out.
 type Transaction struct {
-	Reference string            `bson:"reference"`
-	UserID    string            `bson:"user_id"`
-	AccountID string            `bson:"account_id"`
-	Amount    float64           `bson:"amount"`
-	Type      TransactionType   `bson:"type"`
-	Status    TransactionStatus `bson:"status"`
-	CreatedAt int64             `bson:"created_at"`
+	Reference             string            `bson:"reference" json:"reference"`
+	UserID                string            `bson:"user_id" json:"user_id"`
+	AccountID             string            `bson:"account_id" json:"account_id"`
+	Amount                Money             `bson:"amount" json:"amount"`
+	Type                  TransactionType   `bson:"type" json:"type"`
+	Status                TransactionStatus `bson:"status" json:"status"`
+	FailureReason         string            `bson:"failure_reason,omitempty" json:"failure_reason,omitempty"`
+	ProviderStatusCode    int               `bson:"provider_status_code,omitempty" json:"provider_status_code,omitempty"`
+	FailureKind           string            `bson:"failure_kind,omitempty" json:"failure_kind,omitempty"`
+	TransferID            string            `bson:"transfer_id,omitempty" json:"transfer_id,omitempty"`
+	CounterpartyAccountID string            `bson:"counterparty_account_id,omitempty" json:"counterparty_account_id,omitempty"`
+	OriginalReference     string            `bson:"original_reference,omitempty" json:"original_reference,omitempty"`
+	ReversedAmount        *Money            `bson:"reversed_amount,omitempty" json:"reversed_amount,omitempty"`
+	ExpiresAt             int64             `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	AuthorizedAmount      *Money            `bson:"authorized_amount,omitempty" json:"authorized_amount,omitempty"`
+	IdempotencyKey        string            `bson:"idempotency_key" json:"-"`
+	RequestHash           string            `bson:"request_hash" json:"-"`
+	CreatedAt             int64             `bson:"created_at" json:"created_at"`
+}
+
+// Reversible reports whether the transaction is a completed payment made through the payment provider,
+// transfers and reversals cannot be reversed
+func (t Transaction) Reversible() bool {
+	if t.TransferID != "" || t.OriginalReference != "" {
+		return false
+	}
+	return t.Status == SUCCESS || t.Status == PARTIALLY_REVERSED
+}
+
+// Capturable reports whether the transaction is an authorization still holding its amount at now, in unix seconds
+func (t Transaction) Capturable(now int64) bool {
+	return t.Status == AUTHORIZED && now < t.ExpiresAt
+}
+
+// Unreversed returns the part of the amount that has not been reversed yet
+func (t Transaction) Unreversed() Money {
+	if t.ReversedAmount == nil {
+		return t.Amount
+	}
+	return NewMoney(t.Amount.Minor-t.ReversedAmount.Minor, t.Amount.Currency)
+}
+
+// TransactionFilter selects the transactions of an account, zero values do not filter. Amounts are in minor units
+// and CreatedFrom (inclusive) and CreatedTo (exclusive) in unix seconds like CreatedAt.
+type TransactionFilter struct {
+	AccountID   string
+	Type        TransactionType
+	Status      TransactionStatus
+	MinAmount   *int64
+	MaxAmount   *int64
+	CreatedFrom int64
+	CreatedTo   int64
+	// After resumes a listing after the transaction it points at
+	After *TransactionCursor
+	Limit int64
+}
+
+// TransactionCursor is the position of a transaction in a listing sorted by creation time, Reference orders
+// transactions created in the same second
+type TransactionCursor struct {
+	CreatedAt int64  `json:"created_at"`
+	Reference string `json:"reference"`
 }
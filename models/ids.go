@@ -0,0 +1,23 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Prefixes of the IDs generated for users, accounts, transfers and journal entries
+const (
+	UserIDPrefix         = "usr_"
+	AccountIDPrefix      = "acc_"
+	TransferIDPrefix     = "trf_"
+	JournalEntryIDPrefix = "jrn_"
+)
+
+// NewID returns prefix followed by 24 random hex characters, e.g. "usr_5f1c0a9e3b7d4e2a8c6b0f13"
+func NewID(prefix string) (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
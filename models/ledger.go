@@ -0,0 +1,77 @@
+package models
+
+import "strings"
+
+// Ledger accounts that are not held by users, their balances only exist as the sum of their postings
+const (
+	// ProviderClearingAccount is the other side of every movement of money to or from the payment provider
+	ProviderClearingAccount = "ledger:provider_clearing"
+	// OpeningBalancesAccount is the other side of the balances accounts held before the ledger was kept
+	OpeningBalancesAccount = "ledger:opening_balances"
+)
+
+// SystemAccount reports whether accountId is a ledger account rather than an account held by a user
+func SystemAccount(accountId string) bool {
+	return strings.HasPrefix(accountId, "ledger:")
+}
+
+// JournalEntry records a single movement of money as postings that add up to zero in every currency,
+// Reference is the transaction that caused it
+type JournalEntry struct {
+	EntryID     string    `bson:"entry_id" json:"entry_id"`
+	Reference   string    `bson:"reference" json:"reference"`
+	Description string    `bson:"description" json:"description"`
+	Postings    []Posting `bson:"postings" json:"postings"`
+	CreatedAt   int64     `bson:"created_at" json:"created_at"`
+}
+
+// Posting moves Amount into an account, a negative amount takes money out of it
+type Posting struct {
+	AccountID string `bson:"account_id" json:"account_id"`
+	Amount    Money  `bson:"amount" json:"amount"`
+}
+
+// Balanced reports whether the entry moves money between at least two postings without creating or
+// destroying any of it
+func (e JournalEntry) Balanced() bool {
+	if len(e.Postings) < 2 {
+		return false
+	}
+
+	totals := make(map[string]int64)
+	for _, posting := range e.Postings {
+		if posting.Amount.Minor == 0 || !ValidCurrency(posting.Amount.Currency) {
+			return false
+		}
+		totals[posting.Amount.Currency] += posting.Amount.Minor
+	}
+
+	for _, total := range totals {
+		if total != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// LedgerBalance is the balance of an account in one currency as derived from its postings
+type LedgerBalance struct {
+	AccountID string `bson:"account_id"`
+	Balance   Money  `bson:"balance"`
+}
+
+// BalanceDrift is an account whose balance in the accounts collection differs from the one derived from the ledger
+type BalanceDrift struct {
+	AccountID string `json:"account_id"`
+	Cached    Money  `json:"cached"`
+	Derived   Money  `json:"derived"`
+}
+
+// LedgerReport is the outcome of recomputing every balance from the ledger, Unbalanced holds the currencies
+// in which the postings of all accounts do not add up to zero
+type LedgerReport struct {
+	OK              bool           `json:"ok"`
+	CheckedAccounts int            `json:"checked_accounts"`
+	Drift           []BalanceDrift `json:"drift"`
+	Unbalanced      []Money        `json:"unbalanced,omitempty"`
+}
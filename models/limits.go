@@ -0,0 +1,111 @@
+package models
+
+// Names of the spending limits, as reported when a debit would exceed one
+const (
+	LimitPerTransaction = "per_transaction"
+	LimitDaily          = "daily"
+	LimitMonthly        = "monthly"
+	LimitDailyCount     = "daily_count"
+)
+
+// SpendingLimits caps the debits made from an account, limits that are not set do not apply. Daily and monthly
+// totals and the daily count are over calendar days and months in UTC.
+type SpendingLimits struct {
+	PerTransaction *Money `bson:"per_transaction,omitempty" json:"per_transaction,omitempty"`
+	Daily          *Money `bson:"daily,omitempty" json:"daily,omitempty"`
+	Monthly        *Money `bson:"monthly,omitempty" json:"monthly,omitempty"`
+	DailyCount     *int64 `bson:"daily_count,omitempty" json:"daily_count,omitempty"`
+}
+
+// amounts returns the limits on amounts by name
+func (l SpendingLimits) amounts() []struct {
+	name  string
+	limit *Money
+} {
+	return []struct {
+		name  string
+		limit *Money
+	}{
+		{name: LimitPerTransaction, limit: l.PerTransaction},
+		{name: LimitDaily, limit: l.Daily},
+		{name: LimitMonthly, limit: l.Monthly},
+	}
+}
+
+// Validate returns every limit that cannot be applied, the limits on amounts must all be in the same currency
+func (l SpendingLimits) Validate() []FieldError {
+	var fieldErrors []FieldError
+
+	currency := ""
+	for _, amount := range l.amounts() {
+		if amount.limit == nil {
+			continue
+		}
+
+		switch {
+		case !ValidCurrency(amount.limit.Currency):
+			fieldErrors = append(fieldErrors, FieldError{Field: amount.name + ".currency", Reason: ErrInvalidCurrency.Error()})
+		case currency != "" && amount.limit.Currency != currency:
+			fieldErrors = append(fieldErrors, FieldError{Field: amount.name + ".currency", Reason: "must match the currency of the other limits"})
+		default:
+			currency = amount.limit.Currency
+		}
+
+		if amount.limit.Minor <= 0 {
+			fieldErrors = append(fieldErrors, FieldError{Field: amount.name, Reason: "must be greater than zero"})
+		}
+	}
+
+	if l.DailyCount != nil && *l.DailyCount < 0 {
+		fieldErrors = append(fieldErrors, FieldError{Field: LimitDailyCount, Reason: "must not be negative"})
+	}
+
+	return fieldErrors
+}
+
+// Currency returns the currency of the limits on amounts, it is empty when none is set
+func (l SpendingLimits) Currency() string {
+	for _, amount := range l.amounts() {
+		if amount.limit != nil {
+			return amount.limit.Currency
+		}
+	}
+	return ""
+}
+
+// Override returns the limits with those set in override taking precedence
+func (l SpendingLimits) Override(override *SpendingLimits) SpendingLimits {
+	if override == nil {
+		return l
+	}
+
+	if override.PerTransaction != nil {
+		l.PerTransaction = override.PerTransaction
+	}
+	if override.Daily != nil {
+		l.Daily = override.Daily
+	}
+	if override.Monthly != nil {
+		l.Monthly = override.Monthly
+	}
+	if override.DailyCount != nil {
+		l.DailyCount = override.DailyCount
+	}
+	return l
+}
+
+// DebitTotals sums the debits made and the amounts still held on an account, or on all of the accounts of a user in
+// one currency, in minor units since the start of the day and of the month
+type DebitTotals struct {
+	Daily      int64 `bson:"daily"`
+	DailyCount int64 `bson:"daily_count"`
+	Monthly    int64 `bson:"monthly"`
+}
+
+// LimitExceeded names the spending limit a debit would exceed and what is left of it, an amount for the limits on
+// amounts and a number of debits for the daily count
+type LimitExceeded struct {
+	Limit           string `json:"limit"`
+	RemainingAmount *Money `json:"remaining_amount,omitempty"`
+	RemainingCount  *int64 `json:"remaining_count,omitempty"`
+}
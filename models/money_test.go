@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	testCases := []struct {
+		name     string
+		amount   string
+		currency string
+		expected Money
+		err      error
+	}{
+		{
+			name:     "Test parse amount with two decimal places",
+			amount:   "10.50",
+			currency: "NGN",
+			expected: NewMoney(1050, "NGN"),
+		},
+		{
+			name:     "Test parse amount without decimal places",
+			amount:   "7",
+			currency: "USD",
+			expected: NewMoney(700, "USD"),
+		},
+		{
+			name:     "Test parse negative amount",
+			amount:   "-0.05",
+			currency: "USD",
+			expected: NewMoney(-5, "USD"),
+		},
+		{
+			name:     "Test parse amount in zero decimal currency",
+			amount:   "1500",
+			currency: "JPY",
+			expected: NewMoney(1500, "JPY"),
+		},
+		{
+			name:     "Test parse amount in three decimal currency",
+			amount:   "1.234",
+			currency: "KWD",
+			expected: NewMoney(1234, "KWD"),
+		},
+		{
+			name:     "Test error too many decimal places",
+			amount:   "10.505",
+			currency: "NGN",
+			err:      ErrInvalidAmount,
+		},
+		{
+			name:     "Test error malformed amount",
+			amount:   "1e3",
+			currency: "NGN",
+			err:      ErrInvalidAmount,
+		},
+		{
+			name:     "Test error invalid currency",
+			amount:   "10.50",
+			currency: "naira",
+			err:      ErrInvalidCurrency,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			money, err := ParseMoney(testCase.amount, testCase.currency)
+			if testCase.err != nil {
+				assert.ErrorIs(t, err, testCase.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expected, money)
+		})
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	data, err := json.Marshal(NewMoney(-1005, "NGN"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount":"-10.05","currency":"NGN"}`, string(data))
+
+	var money Money
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount":"0.30","currency":"USD"}`), &money))
+	assert.Equal(t, NewMoney(30, "USD"), money)
+
+	// bare numbers are read from their decimal text, never through a float
+	assert.NoError(t, json.Unmarshal([]byte(`{"amount":0.30,"currency":"USD"}`), &money))
+	assert.Equal(t, NewMoney(30, "USD"), money)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":"0.301","currency":"USD"}`), &money))
+}
@@ -1,8 +1,177 @@
 package models
 
+import (
+	"strings"
+	"unicode/utf8"
+)
+
 type PaymentRequestPayload struct {
-	UserId    string  `json:"user_id"`
-	AccountId string  `json:"account_id"`
-	Reference string  `json:"reference"`
-	Amount    float64 `json:"amount"`
+	UserId    string `json:"user_id"`
+	AccountId string `json:"account_id"`
+	Reference string `json:"reference"`
+	Amount    Money  `json:"amount"`
+}
+
+// Validate returns every field of the payload that cannot be used to make a payment
+func (p PaymentRequestPayload) Validate() []FieldError {
+	var fieldErrors []FieldError
+
+	required := []struct {
+		field string
+		value string
+	}{
+		{field: "user_id", value: p.UserId},
+		{field: "account_id", value: p.AccountId},
+		{field: "reference", value: p.Reference},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: r.field, Reason: "is required"})
+		}
+	}
+
+	if p.Amount.Minor <= 0 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "amount", Reason: "must be greater than zero"})
+	}
+
+	if !ValidCurrency(p.Amount.Currency) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "amount.currency", Reason: ErrInvalidCurrency.Error()})
+	}
+
+	return fieldErrors
+}
+
+type TransferRequestPayload struct {
+	UserId        string `json:"user_id"`
+	FromAccountId string `json:"from_account_id"`
+	ToAccountId   string `json:"to_account_id"`
+	Reference     string `json:"reference"`
+	Amount        Money  `json:"amount"`
+}
+
+// Validate returns every field of the payload that cannot be used to make a transfer
+func (p TransferRequestPayload) Validate() []FieldError {
+	var fieldErrors []FieldError
+
+	required := []struct {
+		field string
+		value string
+	}{
+		{field: "user_id", value: p.UserId},
+		{field: "from_account_id", value: p.FromAccountId},
+		{field: "to_account_id", value: p.ToAccountId},
+		{field: "reference", value: p.Reference},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			fieldErrors = append(fieldErrors, FieldError{Field: r.field, Reason: "is required"})
+		}
+	}
+
+	if p.ToAccountId != "" && p.ToAccountId == p.FromAccountId {
+		fieldErrors = append(fieldErrors, FieldError{Field: "to_account_id", Reason: "must differ from from_account_id"})
+	}
+
+	if p.Amount.Minor <= 0 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "amount", Reason: "must be greater than zero"})
+	}
+
+	if !ValidCurrency(p.Amount.Currency) {
+		fieldErrors = append(fieldErrors, FieldError{Field: "amount.currency", Reason: ErrInvalidCurrency.Error()})
+	}
+
+	return fieldErrors
+}
+
+// ReversalRequestPayload reverses a payment, the whole unreversed amount is reversed when Amount is not given
+type ReversalRequestPayload struct {
+	Reference string `json:"reference"`
+	Amount    *Money `json:"amount,omitempty"`
+}
+
+// Validate returns every field of the payload that cannot be used to reverse a payment
+func (p ReversalRequestPayload) Validate() []FieldError {
+	var fieldErrors []FieldError
+
+	if strings.TrimSpace(p.Reference) == "" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "reference", Reason: "is required"})
+	}
+
+	if p.Amount != nil {
+		if p.Amount.Minor <= 0 {
+			fieldErrors = append(fieldErrors, FieldError{Field: "amount", Reason: "must be greater than zero"})
+		}
+
+		if !ValidCurrency(p.Amount.Currency) {
+			fieldErrors = append(fieldErrors, FieldError{Field: "amount.currency", Reason: ErrInvalidCurrency.Error()})
+		}
+	}
+
+	return fieldErrors
+}
+
+// CaptureRequestPayload captures an authorization, the whole authorized amount is captured when Amount is not given
+type CaptureRequestPayload struct {
+	Amount *Money `json:"amount,omitempty"`
+}
+
+// Validate returns every field of the payload that cannot be used to capture an authorization
+func (p CaptureRequestPayload) Validate() []FieldError {
+	var fieldErrors []FieldError
+
+	if p.Amount != nil {
+		if p.Amount.Minor <= 0 {
+			fieldErrors = append(fieldErrors, FieldError{Field: "amount", Reason: "must be greater than zero"})
+		}
+
+		if !ValidCurrency(p.Amount.Currency) {
+			fieldErrors = append(fieldErrors, FieldError{Field: "amount.currency", Reason: ErrInvalidCurrency.Error()})
+		}
+	}
+
+	return fieldErrors
+}
+
+// maxUserNameLength bounds the names given to users
+const maxUserNameLength = 100
+
+type CreateUserPayload struct {
+	Name string `json:"name"`
+}
+
+// Validate returns every field of the payload that cannot be used to create a user
+func (p CreateUserPayload) Validate() []FieldError {
+	name := strings.TrimSpace(p.Name)
+	switch {
+	case name == "":
+		return []FieldError{{Field: "name", Reason: "is required"}}
+	case utf8.RuneCountInString(name) > maxUserNameLength:
+		return []FieldError{{Field: "name", Reason: "must be at most 100 characters"}}
+	}
+	return nil
+}
+
+// SetTierPayload moves a user to another tier of spending limits
+type SetTierPayload struct {
+	Tier string `json:"tier"`
+}
+
+// Validate returns every field of the payload that cannot be used to set the tier of a user
+func (p SetTierPayload) Validate() []FieldError {
+	if strings.TrimSpace(p.Tier) == "" {
+		return []FieldError{{Field: "tier", Reason: "is required"}}
+	}
+	return nil
+}
+
+type OpenAccountPayload struct {
+	Currency string `json:"currency"`
+}
+
+// Validate returns every field of the payload that cannot be used to open an account
+func (p OpenAccountPayload) Validate() []FieldError {
+	if !ValidCurrency(p.Currency) {
+		return []FieldError{{Field: "currency", Reason: ErrInvalidCurrency.Error()}}
+	}
+	return nil
 }
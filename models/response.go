@@ -1,5 +1,92 @@
 package models
 
+// Error codes are stable, machine readable identifiers for an ErrorResponse, clients should branch on these
+// rather than on the message.
+const (
+	ErrorCodeInvalidRequest        = "invalid_request"
+	ErrorCodeUnauthorized          = "unauthorized"
+	ErrorCodeValidationFailed      = "validation_failed"
+	ErrorCodeUserNotFound          = "user_not_found"
+	ErrorCodeAccountNotFound       = "account_not_found"
+	ErrorCodeAccountForbidden      = "account_forbidden"
+	ErrorCodeAccountClosed         = "account_closed"
+	ErrorCodeAccountBalanceNotZero = "account_balance_not_zero"
+	ErrorCodePaymentsPending       = "payments_pending"
+	ErrorCodePaymentNotFound       = "payment_not_found"
+	ErrorCodeDuplicateReference    = "duplicate_reference"
+	ErrorCodeCurrencyMismatch      = "currency_mismatch"
+	ErrorCodeInsufficientFunds     = "insufficient_funds"
+	ErrorCodeIdempotencyConflict   = "idempotency_conflict"
+	ErrorCodePaymentInProgress     = "payment_in_progress"
+	ErrorCodePaymentFailed         = "payment_failed"
+	ErrorCodePaymentFinalized      = "payment_finalized"
+	ErrorCodePaymentNotReversible  = "payment_not_reversible"
+	ErrorCodeReversalExceedsAmount = "reversal_exceeds_amount"
+	ErrorCodeAuthorizationInactive = "authorization_not_active"
+	ErrorCodeCaptureExceedsAmount  = "capture_exceeds_authorization"
+	ErrorCodeLimitExceeded         = "limit_exceeded"
+	ErrorCodePaymentDeclined       = "payment_declined"
+	ErrorCodeInvalidAccount        = "invalid_account"
+	ErrorCodeProviderError         = "provider_error"
+	ErrorCodeProviderUnavailable   = "provider_unavailable"
+	ErrorCodeInternalError         = "internal_error"
+)
+
+// ErrorResponse is the body of every error response, Limit describes the spending limit a rejected debit would exceed
 type ErrorResponse struct {
-	ErrorMessage string `json:"errorMessage"`
+	Code         string         `json:"code,omitempty"`
+	ErrorMessage string         `json:"errorMessage"`
+	Fields       []FieldError   `json:"fields,omitempty"`
+	Limit        *LimitExceeded `json:"limit,omitempty"`
+}
+
+// Health statuses reported by the liveness and readiness endpoints
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDraining = "draining"
+	HealthStatusDown     = "down"
+	HealthStatusUp       = "up"
+)
+
+// HealthResponse is returned by the readiness endpoint, Checks is keyed by dependency name and ProviderCircuit
+// is the state of the circuit breaker guarding calls to the payment provider
+type HealthResponse struct {
+	Status          string                      `json:"status"`
+	Checks          map[string]DependencyStatus `json:"checks,omitempty"`
+	ProviderCircuit string                      `json:"provider_circuit,omitempty"`
+}
+
+// DependencyStatus is the outcome of checking a single dependency
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// TransactionPage is a page of an account's transactions sorted newest first, NextCursor is empty on the last page
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"`
+}
+
+// TransferResponse describes a completed transfer, Reference is the client reference it was made with
+type TransferResponse struct {
+	TransferID    string `json:"transfer_id"`
+	Reference     string `json:"reference"`
+	FromAccountID string `json:"from_account_id"`
+	ToAccountID   string `json:"to_account_id"`
+	Amount        Money  `json:"amount"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+// UserResponse is a user together with the accounts they hold
+type UserResponse struct {
+	User
+	Accounts []Account `json:"accounts"`
 }
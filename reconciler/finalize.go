@@ -0,0 +1,74 @@
+package reconciler
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/ledger"
+	"consumer-payment-service/models"
+	"context"
+)
+
+// defaultFailureReason is recorded when the payment provider reports a payment FAILED without saying why
+const defaultFailureReason = "payment provider reported the payment as failed"
+
+// Finalize moves a PENDING transaction to the outcome reported by the payment provider together with its balance
+// change: a successful credit is added to the account and a failed debit releases the amount reserved for it.
+// A failed reversal also gives back the amount it reserved on the payment it reverses. Any status other than
+// SUCCESS or FAILED leaves the transaction pending. A FAILED transaction records reason, providerStatusCode and
+// failureKind as its failure. On success transaction is updated in place.
+func Finalize(ctx context.Context, store database.MongoDBStore, transaction *models.Transaction, status models.TransactionStatus, reason string, providerStatusCode int, failureKind string) error {
+	if status == models.FAILED && reason == "" {
+		reason = defaultFailureReason
+	}
+
+	var err error
+	switch {
+	case status == models.SUCCESS && transaction.Type == models.CREDIT:
+		err = store.WithTx(ctx, func(store database.MongoDBStore) error {
+			if err := store.UpdateTransactionStatus(ctx, transaction.Reference, models.SUCCESS); err != nil {
+				return err
+			}
+
+			return ledger.Post(ctx, store, ledger.Deposit(transaction))
+		})
+	case status == models.SUCCESS:
+		err = store.UpdateTransactionStatus(ctx, transaction.Reference, models.SUCCESS)
+	case status == models.FAILED && transaction.OriginalReference != "":
+		err = store.WithTx(ctx, func(store database.MongoDBStore) error {
+			if transaction.Type == models.DEBIT {
+				if err := ledger.Post(ctx, store, ledger.Release(transaction)); err != nil {
+					return err
+				}
+			}
+
+			if _, err := store.AdjustReversedAmount(ctx, transaction.OriginalReference, transaction.Amount.Negate()); err != nil {
+				return err
+			}
+
+			return store.FailTransaction(ctx, transaction.Reference, reason, providerStatusCode, failureKind)
+		})
+	case status == models.FAILED && transaction.Type == models.DEBIT:
+		err = store.WithTx(ctx, func(store database.MongoDBStore) error {
+			if err := ledger.Post(ctx, store, ledger.Release(transaction)); err != nil {
+				return err
+			}
+
+			return store.FailTransaction(ctx, transaction.Reference, reason, providerStatusCode, failureKind)
+		})
+	case status == models.FAILED:
+		err = store.FailTransaction(ctx, transaction.Reference, reason, providerStatusCode, failureKind)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	transaction.Status = status
+	if status == models.FAILED {
+		transaction.FailureReason = reason
+		transaction.ProviderStatusCode = providerStatusCode
+		transaction.FailureKind = failureKind
+	}
+	return nil
+}
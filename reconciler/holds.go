@@ -0,0 +1,64 @@
+package reconciler
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// EndHold ends an AUTHORIZED transaction without capturing it, status is VOIDED or EXPIRED, and gives the amount it
+// held back to the available balance of its account.
+func EndHold(ctx context.Context, store database.MongoDBStore, reference string, status models.TransactionStatus) (*models.Transaction, error) {
+	var hold *models.Transaction
+	err := store.WithTx(ctx, func(store database.MongoDBStore) error {
+		var err error
+		if hold, err = store.ReleaseHold(ctx, reference, status); err != nil {
+			return err
+		}
+
+		_, err = store.AdjustAvailableBalance(ctx, hold.AccountID, hold.Amount)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hold, nil
+}
+
+// ExpireHolds releases the holds of authorizations that were neither captured nor voided before they expired. A hold
+// that cannot be released is logged and retried on the next run. Each run pages through all of them so that no funds
+// stay held past expiry for want of a larger batch.
+func (r *Reconciler) ExpireHolds(ctx context.Context) error {
+	expiredBy := time.Now().Unix()
+
+	var after *models.TransactionCursor
+	for {
+		holds, err := r.store.GetExpiredHolds(ctx, expiredBy, after, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range holds {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			// the authorization was captured or voided in the meantime
+			_, err := EndHold(ctx, r.store, holds[i].Reference, models.EXPIRED)
+			if err != nil && !errors.Is(err, database.ErrHoldNotActive) {
+				slog.Warn("error expiring hold", "reference", holds[i].Reference, "error", err)
+			}
+		}
+
+		if len(holds) < batchSize {
+			return nil
+		}
+
+		last := holds[len(holds)-1]
+		after = &models.TransactionCursor{CreatedAt: last.CreatedAt, Reference: last.Reference}
+	}
+}
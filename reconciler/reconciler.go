@@ -0,0 +1,108 @@
+package reconciler
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// batchSize caps how many pending transactions are read from the store at a time
+const batchSize = 100
+
+// Reconciler finalizes transactions left PENDING because the outcome of the provider call was never recorded,
+// e.g. the call timed out or the service stopped before it returned. It also expires stale authorization holds.
+type Reconciler struct {
+	store         database.MongoDBStore
+	paymentClient client.ThirdPartyAPIClient
+	interval      time.Duration
+	pendingAge    time.Duration
+}
+
+func New(config *environment.Config, store database.MongoDBStore, paymentClient client.ThirdPartyAPIClient) *Reconciler {
+	return &Reconciler{
+		store:         store,
+		paymentClient: paymentClient,
+		interval:      config.ReconcileInterval,
+		pendingAge:    config.ReconcilePendingAge,
+	}
+}
+
+// Run reconciles pending transactions and expires holds every interval until ctx is cancelled
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.ReconcilePending(ctx); err != nil {
+				slog.Error("error reconciling pending transactions", "error", err)
+			}
+
+			if err := r.ExpireHolds(ctx); err != nil {
+				slog.Error("error expiring holds", "error", err)
+			}
+		}
+	}
+}
+
+// ReconcilePending checks the transactions that have been PENDING for longer than the pending age with the
+// payment provider and finalizes those it has an outcome for. A transaction that cannot be reconciled is logged
+// and retried on the next run. Each run pages through all of them so that transactions which stay pending never
+// keep newer ones from being reconciled.
+func (r *Reconciler) ReconcilePending(ctx context.Context) error {
+	createdBefore := time.Now().Add(-r.pendingAge).Unix()
+
+	var after *models.TransactionCursor
+	for {
+		transactions, err := r.store.GetPendingTransactions(ctx, createdBefore, after, batchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range transactions {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := r.reconcile(ctx, &transactions[i]); err != nil {
+				slog.Warn("error reconciling transaction", "reference", transactions[i].Reference, "error", err)
+			}
+		}
+
+		if len(transactions) < batchSize {
+			return nil
+		}
+
+		last := transactions[len(transactions)-1]
+		after = &models.TransactionCursor{CreatedAt: last.CreatedAt, Reference: last.Reference}
+	}
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, transaction *models.Transaction) error {
+	resp, err := r.paymentClient.RetrieveTransaction(ctx, transaction.Reference)
+
+	var providerErr *client.ProviderError
+	switch {
+	case errors.As(err, &providerErr) && providerErr.Kind == client.ProviderErrorPaymentNotFound:
+		// the provider never received the payment so no money moved
+		err = Finalize(ctx, r.store, transaction, models.FAILED, providerErr.Message, providerErr.StatusCode, "")
+	case err != nil:
+		return err
+	default:
+		err = Finalize(ctx, r.store, transaction, models.TransactionStatus(resp.Status), "", 0, "")
+	}
+
+	// the request that created the transaction finalized it in the meantime
+	if errors.Is(err, database.ErrTransactionNotPending) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,532 @@
+package reconciler
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/database/databasetest"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_Reconciler_ReconcilePending(t *testing.T) {
+	const (
+		creditSucceeded = iota
+		creditFailed
+		debitSucceeded
+		debitFailed
+		reversalFailed
+		unknownAtProvider
+		stillPending
+		errorRetrievingTransaction
+		alreadyFinalized
+		errorGettingPendingTransactions
+	)
+
+	testCases := []struct {
+		name            string
+		transactionType models.TransactionType
+		testType        int
+	}{
+		{
+			name:            "Test credit completed at provider is applied to the balance",
+			transactionType: models.CREDIT,
+			testType:        creditSucceeded,
+		},
+
+		{
+			name:            "Test credit failed at provider is marked failed",
+			transactionType: models.CREDIT,
+			testType:        creditFailed,
+		},
+
+		{
+			name:            "Test debit completed at provider is marked successful",
+			transactionType: models.DEBIT,
+			testType:        debitSucceeded,
+		},
+
+		{
+			name:            "Test debit failed at provider releases the reserved amount",
+			transactionType: models.DEBIT,
+			testType:        debitFailed,
+		},
+
+		{
+			name:            "Test reversal failed at provider gives back the reserved amounts",
+			transactionType: models.DEBIT,
+			testType:        reversalFailed,
+		},
+
+		{
+			name:            "Test payment unknown to the provider is marked failed",
+			transactionType: models.DEBIT,
+			testType:        unknownAtProvider,
+		},
+
+		{
+			name:            "Test payment still pending at provider is left pending",
+			transactionType: models.CREDIT,
+			testType:        stillPending,
+		},
+
+		{
+			name:            "Test error retrieving payment from provider leaves it pending",
+			transactionType: models.CREDIT,
+			testType:        errorRetrievingTransaction,
+		},
+
+		{
+			name:            "Test payment finalized while reconciling is skipped",
+			transactionType: models.CREDIT,
+			testType:        alreadyFinalized,
+		},
+
+		{
+			name:            "Test error fetching pending transactions",
+			transactionType: models.CREDIT,
+			testType:        errorGettingPendingTransactions,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+		ReconcileInterval:            time.Minute,
+		ReconcilePendingAge:          5 * time.Minute,
+	}
+
+	httpClient := &http.Client{}
+	httpmock.ActivateNonDefault(httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	paymentClient := client.NewPaymentAPIClientWithHTTPClient(cfg, httpClient)
+
+	reconciler := New(cfg, mockDataStore, paymentClient)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			httpmock.Reset()
+
+			mockTransaction := models.Transaction{
+				Reference: "ref-001",
+				UserID:    "usr-001",
+				AccountID: "acc_001",
+				Amount:    models.NewMoney(1000, "NGN"),
+				Type:      testCase.transactionType,
+				Status:    models.PENDING,
+				CreatedAt: time.Now().Add(-10 * time.Minute).Unix(),
+			}
+			if testCase.testType == reversalFailed {
+				mockTransaction.OriginalReference = "ref-000"
+			}
+			mockUrl := fmt.Sprintf("%s/payments/%s", cfg.THIRD_PARTY_SERVICE_BASE_URL, mockTransaction.Reference)
+
+			providerResponder := func(status models.TransactionStatus) httpmock.Responder {
+				return httpmock.NewJsonResponderOrPanic(http.StatusOK, client.PaymentResponse{
+					AccountId: mockTransaction.AccountID,
+					Reference: mockTransaction.Reference,
+					Status:    string(status),
+				})
+			}
+
+			if testCase.testType != errorGettingPendingTransactions {
+				mockDataStore.
+					EXPECT().
+					GetPendingTransactions(gomock.Any(), gomock.Any(), nil, gomock.Any()).
+					DoAndReturn(func(ctx context.Context, createdBefore int64, after *models.TransactionCursor, limit int64) ([]models.Transaction, error) {
+						assert.LessOrEqual(t, createdBefore, time.Now().Add(-cfg.ReconcilePendingAge).Unix())
+						return []models.Transaction{mockTransaction}, nil
+					})
+			}
+
+			switch testCase.testType {
+			case creditSucceeded:
+				httpmock.RegisterResponder("GET", mockUrl, providerResponder(models.SUCCESS))
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					UpdateTransactionStatus(gomock.Any(), mockTransaction.Reference, models.SUCCESS).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockTransaction.AccountID, mockTransaction.Amount).
+					Return(&models.Account{AccountID: mockTransaction.AccountID}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case creditFailed:
+				httpmock.RegisterResponder("GET", mockUrl, providerResponder(models.FAILED))
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), mockTransaction.Reference, defaultFailureReason, 0, "").
+					Return(nil)
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case debitSucceeded:
+				httpmock.RegisterResponder("GET", mockUrl, providerResponder(models.SUCCESS))
+
+				mockDataStore.
+					EXPECT().
+					UpdateTransactionStatus(gomock.Any(), mockTransaction.Reference, models.SUCCESS).
+					Return(nil)
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case debitFailed:
+				httpmock.RegisterResponder("GET", mockUrl, providerResponder(models.FAILED))
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockTransaction.AccountID, mockTransaction.Amount).
+					Return(&models.Account{AccountID: mockTransaction.AccountID}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), mockTransaction.Reference, defaultFailureReason, 0, "").
+					Return(nil)
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case reversalFailed:
+				httpmock.RegisterResponder("GET", mockUrl, providerResponder(models.FAILED))
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockTransaction.AccountID, mockTransaction.Amount).
+					Return(&models.Account{AccountID: mockTransaction.AccountID}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustReversedAmount(gomock.Any(), "ref-000", mockTransaction.Amount.Negate()).
+					Return(&models.Transaction{Reference: "ref-000", Status: models.SUCCESS}, nil)
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), mockTransaction.Reference, defaultFailureReason, 0, "").
+					Return(nil)
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case unknownAtProvider:
+				httpmock.RegisterResponder("GET", mockUrl, httpmock.NewJsonResponderOrPanic(http.StatusNotFound, client.ErrorResponse{
+					ErrorMessage: "transaction not found",
+				}))
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockTransaction.AccountID, mockTransaction.Amount).
+					Return(&models.Account{AccountID: mockTransaction.AccountID}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), mockTransaction.Reference, "transaction not found", http.StatusNotFound, "").
+					Return(nil)
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case stillPending:
+				httpmock.RegisterResponder("GET", mockUrl, providerResponder(models.PENDING))
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case errorRetrievingTransaction:
+				httpmock.RegisterResponder("GET", mockUrl, httpmock.NewJsonResponderOrPanic(http.StatusInternalServerError, client.ErrorResponse{
+					ErrorMessage: "service unavailable",
+				}))
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case alreadyFinalized:
+				httpmock.RegisterResponder("GET", mockUrl, providerResponder(models.SUCCESS))
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					UpdateTransactionStatus(gomock.Any(), mockTransaction.Reference, models.SUCCESS).
+					Return(database.ErrTransactionNotPending)
+
+				assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+
+			case errorGettingPendingTransactions:
+				mockDataStore.
+					EXPECT().
+					GetPendingTransactions(gomock.Any(), gomock.Any(), nil, gomock.Any()).
+					Return(nil, errors.New(""))
+
+				assert.Error(t, reconciler.ReconcilePending(context.Background()))
+			}
+		})
+	}
+}
+
+func Test_Reconciler_ReconcilePending_PagesPastStuckTransactions(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+		ReconcileInterval:            time.Minute,
+		ReconcilePendingAge:          5 * time.Minute,
+	}
+
+	httpClient := &http.Client{}
+	httpmock.ActivateNonDefault(httpClient)
+	defer httpmock.DeactivateAndReset()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	reconciler := New(cfg, mockDataStore, client.NewPaymentAPIClientWithHTTPClient(cfg, httpClient))
+
+	createdAt := time.Now().Add(-time.Hour).Unix()
+
+	// a whole batch the provider keeps reporting as pending
+	stuck := make([]models.Transaction, batchSize)
+	for i := range stuck {
+		stuck[i] = models.Transaction{
+			Reference: fmt.Sprintf("stuck-%03d", i),
+			AccountID: "acc_001",
+			Amount:    models.NewMoney(1000, "NGN"),
+			Type:      models.DEBIT,
+			Status:    models.PENDING,
+			CreatedAt: createdAt,
+		}
+		httpmock.RegisterResponder("GET", fmt.Sprintf("%s/payments/%s", cfg.THIRD_PARTY_SERVICE_BASE_URL, stuck[i].Reference),
+			httpmock.NewJsonResponderOrPanic(http.StatusOK, client.PaymentResponse{Reference: stuck[i].Reference, Status: string(models.PENDING)}))
+	}
+
+	settled := models.Transaction{
+		Reference: "ref-001",
+		AccountID: "acc_001",
+		Amount:    models.NewMoney(1000, "NGN"),
+		Type:      models.DEBIT,
+		Status:    models.PENDING,
+		CreatedAt: createdAt + 60,
+	}
+	httpmock.RegisterResponder("GET", fmt.Sprintf("%s/payments/%s", cfg.THIRD_PARTY_SERVICE_BASE_URL, settled.Reference),
+		httpmock.NewJsonResponderOrPanic(http.StatusOK, client.PaymentResponse{Reference: settled.Reference, Status: string(models.SUCCESS)}))
+
+	gomock.InOrder(
+		mockDataStore.
+			EXPECT().
+			GetPendingTransactions(gomock.Any(), gomock.Any(), nil, int64(batchSize)).
+			Return(stuck, nil),
+		mockDataStore.
+			EXPECT().
+			GetPendingTransactions(gomock.Any(), gomock.Any(), &models.TransactionCursor{CreatedAt: createdAt, Reference: "stuck-099"}, int64(batchSize)).
+			Return([]models.Transaction{settled}, nil),
+	)
+
+	mockDataStore.
+		EXPECT().
+		UpdateTransactionStatus(gomock.Any(), settled.Reference, models.SUCCESS).
+		Return(nil)
+
+	assert.NoError(t, reconciler.ReconcilePending(context.Background()))
+}
+
+func Test_Reconciler_ExpireHolds(t *testing.T) {
+	const (
+		holdExpired = iota
+		holdSettledConcurrently
+		errorReleasingHold
+		errorGettingExpiredHolds
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test expired hold is released",
+			testType: holdExpired,
+		},
+
+		{
+			name:     "Test hold captured or voided while expiring is skipped",
+			testType: holdSettledConcurrently,
+		},
+
+		{
+			name:     "Test error releasing hold leaves it for the next run",
+			testType: errorReleasingHold,
+		},
+
+		{
+			name:     "Test error fetching expired holds",
+			testType: errorGettingExpiredHolds,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	reconciler := New(&environment.Config{ReconcileInterval: time.Minute}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	mockHold := models.Transaction{
+		Reference: "auth-001",
+		AccountID: "acc_001",
+		Amount:    models.NewMoney(1000, "NGN"),
+		Type:      models.DEBIT,
+		Status:    models.AUTHORIZED,
+		ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.testType == errorGettingExpiredHolds {
+				mockDataStore.
+					EXPECT().
+					GetExpiredHolds(gomock.Any(), gomock.Any(), nil, gomock.Any()).
+					Return(nil, errors.New("connection reset"))
+
+				assert.Error(t, reconciler.ExpireHolds(context.Background()))
+				return
+			}
+
+			mockDataStore.
+				EXPECT().
+				GetExpiredHolds(gomock.Any(), gomock.Any(), nil, gomock.Any()).
+				DoAndReturn(func(ctx context.Context, expiredBy int64, after *models.TransactionCursor, limit int64) ([]models.Transaction, error) {
+					assert.GreaterOrEqual(t, expiredBy, mockHold.ExpiresAt)
+					return []models.Transaction{mockHold}, nil
+				})
+
+			databasetest.ExpectWithTx(mockDataStore)
+
+			switch testCase.testType {
+			case holdExpired:
+				expired := mockHold
+				expired.Status = models.EXPIRED
+
+				mockDataStore.
+					EXPECT().
+					ReleaseHold(gomock.Any(), "auth-001", models.EXPIRED).
+					Return(&expired, nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAvailableBalance(gomock.Any(), "acc_001", models.NewMoney(1000, "NGN")).
+					Return(&models.Account{AccountID: "acc_001"}, nil)
+
+			case holdSettledConcurrently:
+				mockDataStore.
+					EXPECT().
+					ReleaseHold(gomock.Any(), "auth-001", models.EXPIRED).
+					Return(nil, database.ErrHoldNotActive)
+
+			case errorReleasingHold:
+				mockDataStore.
+					EXPECT().
+					ReleaseHold(gomock.Any(), "auth-001", models.EXPIRED).
+					Return(nil, errors.New("connection reset"))
+			}
+
+			assert.NoError(t, reconciler.ExpireHolds(context.Background()))
+		})
+	}
+}
+
+func Test_Reconciler_ExpireHolds_PagesPastFullBatch(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	reconciler := New(&environment.Config{ReconcileInterval: time.Minute}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	createdAt := time.Now().Add(-time.Hour).Unix()
+
+	// more holds expired than a batch holds
+	holds := make([]models.Transaction, batchSize+1)
+	for i := range holds {
+		holds[i] = models.Transaction{
+			Reference: fmt.Sprintf("auth-%03d", i),
+			AccountID: "acc_001",
+			Amount:    models.NewMoney(1000, "NGN"),
+			Type:      models.DEBIT,
+			Status:    models.AUTHORIZED,
+			ExpiresAt: createdAt + 60,
+			CreatedAt: createdAt,
+		}
+	}
+
+	gomock.InOrder(
+		mockDataStore.
+			EXPECT().
+			GetExpiredHolds(gomock.Any(), gomock.Any(), nil, int64(batchSize)).
+			Return(holds[:batchSize], nil),
+		mockDataStore.
+			EXPECT().
+			GetExpiredHolds(gomock.Any(), gomock.Any(), &models.TransactionCursor{CreatedAt: createdAt, Reference: holds[batchSize-1].Reference}, int64(batchSize)).
+			Return(holds[batchSize:], nil),
+	)
+
+	mockDataStore.
+		EXPECT().
+		WithTx(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, fn func(database.MongoDBStore) error) error {
+			return fn(mockDataStore)
+		}).
+		Times(len(holds))
+
+	mockDataStore.
+		EXPECT().
+		ReleaseHold(gomock.Any(), gomock.Any(), models.EXPIRED).
+		DoAndReturn(func(ctx context.Context, reference string, status models.TransactionStatus) (*models.Transaction, error) {
+			return &models.Transaction{Reference: reference, AccountID: "acc_001", Amount: models.NewMoney(1000, "NGN"), Status: status}, nil
+		}).
+		Times(len(holds))
+
+	mockDataStore.
+		EXPECT().
+		AdjustAvailableBalance(gomock.Any(), "acc_001", models.NewMoney(1000, "NGN")).
+		Return(&models.Account{AccountID: "acc_001"}, nil).
+		Times(len(holds))
+
+	assert.NoError(t, reconciler.ExpireHolds(context.Background()))
+}
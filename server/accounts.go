@@ -0,0 +1,192 @@
+package server
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/logging"
+	"consumer-payment-service/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// CreateUserHandler creates a user with a generated ID, accounts are opened for them separately
+func (handler *HttpHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload models.CreateUserPayload
+	if !handler.decodePayload(w, r, &payload) {
+		return
+	}
+
+	ctx := r.Context()
+	id, err := models.NewID(models.UserIDPrefix)
+	if err != nil {
+		logging.FromContext(ctx).Error("error generating user id", "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	user := &models.User{
+		Id:        id,
+		Name:      strings.TrimSpace(payload.Name),
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := handler.mongodbStore.CreateUser(ctx, user); err != nil {
+		logging.FromContext(ctx).Error("error creating user", "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, models.UserResponse{User: *user, Accounts: []models.Account{}}, http.StatusCreated)
+}
+
+// GetUserHandler returns a user together with their accounts, closed ones included
+func (handler *HttpHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userId := chi.URLParam(r, "id")
+	ctx := r.Context()
+
+	user, err := handler.mongodbStore.GetUserById(ctx, userId)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error getting user", "user_id", userId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	accounts, err := handler.mongodbStore.GetUserAccounts(ctx, userId)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting user accounts", "user_id", userId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, models.UserResponse{User: *user, Accounts: accounts})
+}
+
+// OpenAccountHandler opens an account for a user in the requested currency, starting at a zero balance
+func (handler *HttpHandler) OpenAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var payload models.OpenAccountPayload
+	if !handler.decodePayload(w, r, &payload) {
+		return
+	}
+
+	userId := chi.URLParam(r, "id")
+	ctx := r.Context()
+
+	if _, err := handler.mongodbStore.GetUserById(ctx, userId); err != nil {
+		logging.FromContext(ctx).Warn("error getting user", "user_id", userId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	id, err := models.NewID(models.AccountIDPrefix)
+	if err != nil {
+		logging.FromContext(ctx).Error("error generating account id", "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	account := &models.Account{
+		AccountID: id,
+		Balance:   models.NewMoney(0, payload.Currency),
+		Available: models.NewMoney(0, payload.Currency),
+		UserID:    userId,
+		Status:    models.ACTIVE,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := handler.mongodbStore.CreateAccount(ctx, account); err != nil {
+		logging.FromContext(ctx).Error("error opening account", "user_id", userId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, account, http.StatusCreated)
+}
+
+// CloseAccountHandler closes an account once it holds no money and has no payment in flight
+func (handler *HttpHandler) CloseAccountHandler(w http.ResponseWriter, r *http.Request) {
+	accountId := chi.URLParam(r, "id")
+	ctx := r.Context()
+
+	// close inside a transaction so that a payment recorded in the meantime conflicts with the close
+	var account *models.Account
+	err := handler.mongodbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		var err error
+		account, err = store.CloseAccount(ctx, accountId)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(ctx).Warn("error closing account", "account_id", accountId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, account)
+}
+
+// SetUserTierHandler moves a user to one of the configured tiers of spending limits
+func (handler *HttpHandler) SetUserTierHandler(w http.ResponseWriter, r *http.Request) {
+	var payload models.SetTierPayload
+	if !handler.decodePayload(w, r, &payload) {
+		return
+	}
+
+	if _, ok := handler.config.SpendingLimitTiers[payload.Tier]; !ok {
+		response := models.ErrorResponse{
+			Code:         models.ErrorCodeValidationFailed,
+			ErrorMessage: "request validation failed",
+			Fields:       []models.FieldError{{Field: "tier", Reason: "is not a configured tier"}},
+		}
+		handler.responseWriter(w, response, http.StatusUnprocessableEntity)
+		return
+	}
+
+	userId := chi.URLParam(r, "id")
+	ctx := r.Context()
+
+	user, err := handler.mongodbStore.SetUserTier(ctx, userId, payload.Tier)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error setting user tier", "user_id", userId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, user)
+}
+
+// SetAccountLimitsHandler sets the spending limits of an account, they take precedence over the limits of the tier
+// of its holder. Limits left out of the request fall back to the tier, an empty request removes them all.
+func (handler *HttpHandler) SetAccountLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload models.SpendingLimits
+	if !handler.decodePayload(w, r, &payload) {
+		return
+	}
+
+	accountId := chi.URLParam(r, "id")
+	ctx := r.Context()
+
+	account, err := handler.mongodbStore.GetAccountByID(ctx, accountId)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error getting account", "account_id", accountId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	if currency := payload.Currency(); currency != "" && currency != account.Balance.Currency {
+		handler.errorWriter(w, database.ErrCurrencyMismatch)
+		return
+	}
+
+	var spendingLimits *models.SpendingLimits
+	if payload != (models.SpendingLimits{}) {
+		spendingLimits = &payload
+	}
+
+	account, err = handler.mongodbStore.SetAccountLimits(ctx, accountId, spendingLimits)
+	if err != nil {
+		logging.FromContext(ctx).Error("error setting account limits", "account_id", accountId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, account)
+}
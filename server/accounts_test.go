@@ -0,0 +1,560 @@
+package server
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/database/databasetest"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_HttpHandler_CreateUser(t *testing.T) {
+	const (
+		success = iota
+		errorValidation
+		errorCreatingUser
+	)
+
+	testCases := []struct {
+		name     string
+		body     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			body:     `{"name":" Ada Lovelace "}`,
+			testType: success,
+		},
+
+		{
+			name:     "Test error name is required",
+			body:     `{"name":"  "}`,
+			testType: errorValidation,
+		},
+
+		{
+			name:     "Test error creating user",
+			body:     `{"name":"Ada Lovelace"}`,
+			testType: errorCreatingUser,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	handler := NewHTTPHandler(&environment.Config{}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(testCase.body))
+
+			switch testCase.testType {
+			case success:
+				var created *models.User
+				mockDataStore.
+					EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(ctx context.Context, user *models.User) error {
+						created = user
+						return nil
+					})
+
+				handler.CreateUserHandler(w, r)
+				assert.Equal(t, http.StatusCreated, w.Code)
+
+				var response models.UserResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.True(t, strings.HasPrefix(response.Id, models.UserIDPrefix))
+				assert.Equal(t, created.Id, response.Id)
+				assert.Equal(t, "Ada Lovelace", response.Name)
+				assert.NotZero(t, response.CreatedAt)
+				assert.Empty(t, response.Accounts)
+
+			case errorValidation:
+				handler.CreateUserHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, []models.FieldError{{Field: "name", Reason: "is required"}}, response.Fields)
+
+			case errorCreatingUser:
+				mockDataStore.
+					EXPECT().
+					CreateUser(gomock.Any(), gomock.Any()).
+					Return(errors.New("connection reset"))
+
+				handler.CreateUserHandler(w, r)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
+
+func Test_HttpHandler_GetUser(t *testing.T) {
+	const (
+		success = iota
+		errorUserNotFound
+		errorGettingAccounts
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			testType: success,
+		},
+
+		{
+			name:     "Test error user not found",
+			testType: errorUserNotFound,
+		},
+
+		{
+			name:     "Test error getting accounts",
+			testType: errorGettingAccounts,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	handler := NewHTTPHandler(&environment.Config{}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	mockUser := &models.User{Id: "usr-001", Name: "Ada Lovelace", CreatedAt: 1700000000}
+	mockAccounts := []models.Account{
+		{AccountID: "acc_001", Balance: models.NewMoney(1050, "NGN"), Available: models.NewMoney(850, "NGN"), UserID: "usr-001", Status: models.ACTIVE, CreatedAt: 1700000100},
+		{AccountID: "acc_002", Balance: models.NewMoney(0, "USD"), Available: models.NewMoney(0, "USD"), UserID: "usr-001", Status: models.CLOSED, CreatedAt: 1700000200, ClosedAt: 1700000300},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := newRouteRequest(http.MethodGet, "/users/usr-001", "id", "usr-001", "")
+
+			switch testCase.testType {
+			case success:
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), "usr-001").
+					Return(mockUser, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccounts(gomock.Any(), "usr-001").
+					Return(mockAccounts, nil)
+
+				handler.GetUserHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var response models.UserResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.UserResponse{User: *mockUser, Accounts: mockAccounts}, response)
+
+			case errorUserNotFound:
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), "usr-001").
+					Return(nil, database.ErrUserNotFound)
+
+				handler.GetUserHandler(w, r)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorGettingAccounts:
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), "usr-001").
+					Return(mockUser, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccounts(gomock.Any(), "usr-001").
+					Return(nil, errors.New("connection reset"))
+
+				handler.GetUserHandler(w, r)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
+
+func Test_HttpHandler_OpenAccount(t *testing.T) {
+	const (
+		success = iota
+		errorInvalidCurrency
+		errorUserNotFound
+		errorCreatingAccount
+	)
+
+	testCases := []struct {
+		name     string
+		body     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			body:     `{"currency":"NGN"}`,
+			testType: success,
+		},
+
+		{
+			name:     "Test error invalid currency",
+			body:     `{"currency":"naira"}`,
+			testType: errorInvalidCurrency,
+		},
+
+		{
+			name:     "Test error user not found",
+			body:     `{"currency":"NGN"}`,
+			testType: errorUserNotFound,
+		},
+
+		{
+			name:     "Test error creating account",
+			body:     `{"currency":"NGN"}`,
+			testType: errorCreatingAccount,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	handler := NewHTTPHandler(&environment.Config{}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := newRouteRequest(http.MethodPost, "/users/usr-001/accounts", "id", "usr-001", testCase.body)
+
+			switch testCase.testType {
+			case success:
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), "usr-001").
+					Return(&models.User{Id: "usr-001"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				handler.OpenAccountHandler(w, r)
+				assert.Equal(t, http.StatusCreated, w.Code)
+
+				var account models.Account
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &account))
+				assert.True(t, strings.HasPrefix(account.AccountID, models.AccountIDPrefix))
+				assert.Equal(t, models.NewMoney(0, "NGN"), account.Balance)
+				assert.Equal(t, models.NewMoney(0, "NGN"), account.Available)
+				assert.Equal(t, "usr-001", account.UserID)
+				assert.Equal(t, models.ACTIVE, account.Status)
+
+			case errorInvalidCurrency:
+				handler.OpenAccountHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "currency", response.Fields[0].Field)
+
+			case errorUserNotFound:
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), "usr-001").
+					Return(nil, database.ErrUserNotFound)
+
+				handler.OpenAccountHandler(w, r)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorCreatingAccount:
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), "usr-001").
+					Return(&models.User{Id: "usr-001"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateAccount(gomock.Any(), gomock.Any()).
+					Return(errors.New("connection reset"))
+
+				handler.OpenAccountHandler(w, r)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
+
+func Test_HttpHandler_CloseAccount(t *testing.T) {
+	testCases := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Test success",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Test error account not found",
+			err:            database.ErrAccountNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   models.ErrorCodeAccountNotFound,
+		},
+		{
+			name:           "Test error balance not zero",
+			err:            database.ErrAccountBalanceNotZero,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   models.ErrorCodeAccountBalanceNotZero,
+		},
+		{
+			name:           "Test error payments pending",
+			err:            database.ErrAccountHasPendingPayments,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   models.ErrorCodePaymentsPending,
+		},
+		{
+			name:           "Test error account already closed",
+			err:            database.ErrAccountClosed,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   models.ErrorCodeAccountClosed,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	handler := NewHTTPHandler(&environment.Config{}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := newRouteRequest(http.MethodPost, "/accounts/acc_001/close", "id", "acc_001", "")
+
+			var closed *models.Account
+			if testCase.err == nil {
+				closed = &models.Account{AccountID: "acc_001", Balance: models.NewMoney(0, "NGN"), Available: models.NewMoney(0, "NGN"), Status: models.CLOSED, ClosedAt: 1700000000}
+			}
+
+			databasetest.ExpectWithTx(mockDataStore)
+
+			mockDataStore.
+				EXPECT().
+				CloseAccount(gomock.Any(), "acc_001").
+				Return(closed, testCase.err)
+
+			handler.CloseAccountHandler(w, r)
+			assert.Equal(t, testCase.expectedStatus, w.Code)
+
+			if testCase.err == nil {
+				var account models.Account
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &account))
+				assert.Equal(t, *closed, account)
+				return
+			}
+
+			var response models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, testCase.expectedCode, response.Code)
+		})
+	}
+}
+
+func Test_HttpHandler_SetUserTier(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Test success",
+			body:           `{"tier":"premium"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Test error tier not configured",
+			body:           `{"tier":"gold"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   models.ErrorCodeValidationFailed,
+		},
+		{
+			name:           "Test error user not found",
+			body:           `{"tier":"premium"}`,
+			err:            database.ErrUserNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   models.ErrorCodeUserNotFound,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	cfg := &environment.Config{
+		SpendingLimitTiers: map[string]map[string]models.SpendingLimits{"standard": {}, "premium": {}},
+	}
+	handler := NewHTTPHandler(cfg, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := newRouteRequest(http.MethodPut, "/users/usr-001/tier", "id", "usr-001", testCase.body)
+
+			updated := &models.User{Id: "usr-001", Name: "Ada Obi", Tier: "premium", CreatedAt: 1700000000}
+			if testCase.expectedCode != models.ErrorCodeValidationFailed {
+				if testCase.err != nil {
+					updated = nil
+				}
+
+				mockDataStore.
+					EXPECT().
+					SetUserTier(gomock.Any(), "usr-001", "premium").
+					Return(updated, testCase.err)
+			}
+
+			handler.SetUserTierHandler(w, r)
+			assert.Equal(t, testCase.expectedStatus, w.Code)
+
+			if testCase.expectedCode == "" {
+				var user models.User
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+				assert.Equal(t, *updated, user)
+				return
+			}
+
+			var response models.ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, testCase.expectedCode, response.Code)
+		})
+	}
+}
+
+func Test_HttpHandler_SetAccountLimits(t *testing.T) {
+	const (
+		success = iota
+		successClearingLimits
+		errorInvalidLimits
+		errorCurrencyMismatch
+		errorAccountNotFound
+	)
+
+	testCases := []struct {
+		name     string
+		body     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			body:     `{"daily":{"amount":"5000.00","currency":"NGN"},"daily_count":10}`,
+			testType: success,
+		},
+		{
+			name:     "Test success clearing the limits with an empty request",
+			body:     `{}`,
+			testType: successClearingLimits,
+		},
+		{
+			name:     "Test error invalid limits",
+			body:     `{"daily":{"amount":"0","currency":"NGN"},"monthly":{"amount":"1.00","currency":"USD"}}`,
+			testType: errorInvalidLimits,
+		},
+		{
+			name:     "Test error limits in another currency than the account",
+			body:     `{"daily":{"amount":"5000.00","currency":"USD"}}`,
+			testType: errorCurrencyMismatch,
+		},
+		{
+			name:     "Test error account not found",
+			body:     `{"daily":{"amount":"5000.00","currency":"NGN"}}`,
+			testType: errorAccountNotFound,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	handler := NewHTTPHandler(&environment.Config{}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := newRouteRequest(http.MethodPut, "/accounts/acc_001/limits", "id", "acc_001", testCase.body)
+
+			account := &models.Account{AccountID: "acc_001", Balance: models.NewMoney(0, "NGN"), Available: models.NewMoney(0, "NGN"), Status: models.ACTIVE}
+			daily := models.NewMoney(500000, "NGN")
+			dailyCount := int64(10)
+
+			switch testCase.testType {
+			case success:
+				limits := &models.SpendingLimits{Daily: &daily, DailyCount: &dailyCount}
+				updated := *account
+				updated.Limits = limits
+
+				mockDataStore.EXPECT().GetAccountByID(gomock.Any(), "acc_001").Return(account, nil)
+				mockDataStore.EXPECT().SetAccountLimits(gomock.Any(), "acc_001", limits).Return(&updated, nil)
+
+				handler.SetAccountLimitsHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var response models.Account
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, updated, response)
+
+			case successClearingLimits:
+				mockDataStore.EXPECT().GetAccountByID(gomock.Any(), "acc_001").Return(account, nil)
+				mockDataStore.EXPECT().SetAccountLimits(gomock.Any(), "acc_001", nil).Return(account, nil)
+
+				handler.SetAccountLimitsHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+			case errorInvalidLimits:
+				handler.SetAccountLimitsHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeValidationFailed, response.Code)
+				assert.ElementsMatch(t, []models.FieldError{
+					{Field: "daily", Reason: "must be greater than zero"},
+					{Field: "monthly.currency", Reason: "must match the currency of the other limits"},
+				}, response.Fields)
+
+			case errorCurrencyMismatch:
+				mockDataStore.EXPECT().GetAccountByID(gomock.Any(), "acc_001").Return(account, nil)
+
+				handler.SetAccountLimitsHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeCurrencyMismatch, response.Code)
+
+			case errorAccountNotFound:
+				mockDataStore.EXPECT().GetAccountByID(gomock.Any(), "acc_001").Return(nil, database.ErrAccountNotFound)
+
+				handler.SetAccountLimitsHandler(w, r)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+			}
+		})
+	}
+}
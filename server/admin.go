@@ -0,0 +1,27 @@
+package server
+
+import (
+	"consumer-payment-service/models"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// RequireAdmin lets through only requests carrying the admin token as a bearer token. The endpoints behind it
+// change what clients are allowed to do, so they refuse every request when no admin token is configured.
+func (handler *HttpHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || handler.config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(handler.config.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			response := models.ErrorResponse{
+				Code:         models.ErrorCodeUnauthorized,
+				ErrorMessage: "a valid admin token is required",
+			}
+			handler.responseWriter(w, response, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
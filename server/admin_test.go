@@ -0,0 +1,85 @@
+package server
+
+import (
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_HttpHandler_RequireAdmin(t *testing.T) {
+	testCases := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		expected      int
+	}{
+		{
+			name:          "Test success with the admin token",
+			adminToken:    "s3cret",
+			authorization: "Bearer s3cret",
+			expected:      http.StatusNoContent,
+		},
+
+		{
+			name:       "Test error without a token",
+			adminToken: "s3cret",
+			expected:   http.StatusUnauthorized,
+		},
+
+		{
+			name:          "Test error with another token",
+			adminToken:    "s3cret",
+			authorization: "Bearer guess",
+			expected:      http.StatusUnauthorized,
+		},
+
+		{
+			name:          "Test error with the token outside of a bearer scheme",
+			adminToken:    "s3cret",
+			authorization: "s3cret",
+			expected:      http.StatusUnauthorized,
+		},
+
+		{
+			name:          "Test error when no admin token is configured",
+			authorization: "Bearer ",
+			expected:      http.StatusUnauthorized,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := &environment.Config{AdminToken: testCase.adminToken}
+			handler := NewHTTPHandler(cfg, mocks.NewMockMongoDBStore(controller), mocks.NewMockThirdPartyAPIClient(controller))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/users/usr-001/tier", nil)
+			if testCase.authorization != "" {
+				r.Header.Set("Authorization", testCase.authorization)
+			}
+
+			handler.RequireAdmin(next).ServeHTTP(w, r)
+			assert.Equal(t, testCase.expected, w.Code)
+
+			if testCase.expected == http.StatusUnauthorized {
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeUnauthorized, response.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/limits"
+	"consumer-payment-service/models"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors returned by the third party payment service, by what the client can do about them
+var (
+	errPaymentProvider           = errors.New("payment provider request failed")
+	errProviderUnavailable       = errors.New("payment provider is unavailable, try again later")
+	errPaymentDeclined           = errors.New("payment declined by the payment provider")
+	errProviderInsufficientFunds = errors.New("insufficient funds at the payment provider")
+	errProviderInvalidAccount    = errors.New("account rejected by the payment provider")
+)
+
+// providerError marks err as a failed call to the payment provider by what the provider said. Failures of the
+// provider itself are reported as unavailable when it asked us to back off or its circuit is open.
+func providerError(err error) error {
+	marker := errPaymentProvider
+
+	var providerErr *client.ProviderError
+	switch {
+	case errors.Is(err, client.ErrCircuitOpen):
+		marker = errProviderUnavailable
+	case errors.As(err, &providerErr):
+		switch providerErr.Kind {
+		case client.ProviderErrorDeclined:
+			marker = errPaymentDeclined
+		case client.ProviderErrorInsufficientFunds:
+			marker = errProviderInsufficientFunds
+		case client.ProviderErrorInvalidAccount:
+			marker = errProviderInvalidAccount
+		case client.ProviderErrorTransient:
+			if providerErr.StatusCode == http.StatusServiceUnavailable || providerErr.StatusCode == http.StatusTooManyRequests {
+				marker = errProviderUnavailable
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: %v", marker, err)
+}
+
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorMappings translates the errors handlers run into to the status and code clients see, first match wins
+var errorMappings = []errorMapping{
+	{err: database.ErrUserNotFound, status: http.StatusNotFound, code: models.ErrorCodeUserNotFound},
+	{err: database.ErrAccountNotFound, status: http.StatusNotFound, code: models.ErrorCodeAccountNotFound},
+	{err: database.ErrAccountNotOwned, status: http.StatusForbidden, code: models.ErrorCodeAccountForbidden},
+	{err: database.ErrTransactionNotFound, status: http.StatusNotFound, code: models.ErrorCodePaymentNotFound},
+	{err: database.ErrTransactionNotPending, status: http.StatusConflict, code: models.ErrorCodePaymentFinalized},
+	{err: database.ErrDuplicateReference, status: http.StatusConflict, code: models.ErrorCodeDuplicateReference},
+	{err: database.ErrInsufficientFunds, status: http.StatusUnprocessableEntity, code: models.ErrorCodeInsufficientFunds},
+	{err: database.ErrCurrencyMismatch, status: http.StatusUnprocessableEntity, code: models.ErrorCodeCurrencyMismatch},
+	{err: database.ErrTransactionNotReversible, status: http.StatusConflict, code: models.ErrorCodePaymentNotReversible},
+	{err: database.ErrReversalExceedsAmount, status: http.StatusUnprocessableEntity, code: models.ErrorCodeReversalExceedsAmount},
+	{err: database.ErrHoldNotActive, status: http.StatusConflict, code: models.ErrorCodeAuthorizationInactive},
+	{err: database.ErrCaptureExceedsHold, status: http.StatusUnprocessableEntity, code: models.ErrorCodeCaptureExceedsAmount},
+	{err: limits.ErrLimitExceeded, status: http.StatusUnprocessableEntity, code: models.ErrorCodeLimitExceeded},
+	{err: database.ErrAccountClosed, status: http.StatusConflict, code: models.ErrorCodeAccountClosed},
+	{err: database.ErrAccountBalanceNotZero, status: http.StatusConflict, code: models.ErrorCodeAccountBalanceNotZero},
+	{err: database.ErrAccountHasPendingPayments, status: http.StatusConflict, code: models.ErrorCodePaymentsPending},
+	{err: errPaymentDeclined, status: http.StatusPaymentRequired, code: models.ErrorCodePaymentDeclined},
+	{err: errProviderInsufficientFunds, status: http.StatusUnprocessableEntity, code: models.ErrorCodeInsufficientFunds},
+	{err: errProviderInvalidAccount, status: http.StatusUnprocessableEntity, code: models.ErrorCodeInvalidAccount},
+	{err: errProviderUnavailable, status: http.StatusServiceUnavailable, code: models.ErrorCodeProviderUnavailable},
+	{err: errPaymentProvider, status: http.StatusBadGateway, code: models.ErrorCodeProviderError},
+}
+
+// errorResponse returns the HTTP status and body for err, unknown errors are reported as internal errors
+// without leaking their message. A spending limit that was exceeded is named together with what is left of it.
+func errorResponse(err error) (int, models.ErrorResponse) {
+	var exceeded *limits.ExceededError
+	if errors.As(err, &exceeded) {
+		return http.StatusUnprocessableEntity, models.ErrorResponse{
+			Code:         models.ErrorCodeLimitExceeded,
+			ErrorMessage: exceeded.Error(),
+			Limit:        &exceeded.LimitExceeded,
+		}
+	}
+
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			return mapping.status, models.ErrorResponse{
+				Code:         mapping.code,
+				ErrorMessage: mapping.err.Error(),
+			}
+		}
+	}
+
+	return http.StatusInternalServerError, models.ErrorResponse{
+		Code:         models.ErrorCodeInternalError,
+		ErrorMessage: "internal server error",
+	}
+}
+
+func (handler *HttpHandler) errorWriter(w http.ResponseWriter, err error) {
+	status, response := errorResponse(err)
+	handler.responseWriter(w, response, status)
+}
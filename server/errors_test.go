@@ -0,0 +1,141 @@
+package server
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/limits"
+	"consumer-payment-service/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ErrorResponse(t *testing.T) {
+	testCases := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Test user not found",
+			err:            database.ErrUserNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   models.ErrorCodeUserNotFound,
+		},
+		{
+			name:           "Test wrapped account not found",
+			err:            fmt.Errorf("fetching account: %w", database.ErrAccountNotFound),
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   models.ErrorCodeAccountNotFound,
+		},
+		{
+			name:           "Test duplicate reference",
+			err:            database.ErrDuplicateReference,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   models.ErrorCodeDuplicateReference,
+		},
+		{
+			name:           "Test payment already finalized",
+			err:            database.ErrTransactionNotPending,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   models.ErrorCodePaymentFinalized,
+		},
+		{
+			name:           "Test insufficient funds",
+			err:            database.ErrInsufficientFunds,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   models.ErrorCodeInsufficientFunds,
+		},
+		{
+			name:           "Test payment cannot be reversed",
+			err:            database.ErrTransactionNotReversible,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   models.ErrorCodePaymentNotReversible,
+		},
+		{
+			name:           "Test reversal exceeds payment amount",
+			err:            database.ErrReversalExceedsAmount,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   models.ErrorCodeReversalExceedsAmount,
+		},
+		{
+			name:           "Test authorization no longer active",
+			err:            database.ErrHoldNotActive,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   models.ErrorCodeAuthorizationInactive,
+		},
+		{
+			name:           "Test capture exceeds authorized amount",
+			err:            database.ErrCaptureExceedsHold,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   models.ErrorCodeCaptureExceedsAmount,
+		},
+		{
+			name:           "Test spending limit exceeded",
+			err:            fmt.Errorf("checking limits: %w", &limits.ExceededError{LimitExceeded: models.LimitExceeded{Limit: models.LimitDaily}}),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   models.ErrorCodeLimitExceeded,
+		},
+		{
+			name:           "Test payment provider error",
+			err:            providerError(errors.New("connection refused")),
+			expectedStatus: http.StatusBadGateway,
+			expectedCode:   models.ErrorCodeProviderError,
+		},
+		{
+			name:           "Test payment declined by provider",
+			err:            providerError(&client.ProviderError{StatusCode: http.StatusPaymentRequired, Kind: client.ProviderErrorDeclined}),
+			expectedStatus: http.StatusPaymentRequired,
+			expectedCode:   models.ErrorCodePaymentDeclined,
+		},
+		{
+			name:           "Test insufficient funds at provider",
+			err:            providerError(&client.ProviderError{StatusCode: http.StatusUnprocessableEntity, Kind: client.ProviderErrorInsufficientFunds}),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   models.ErrorCodeInsufficientFunds,
+		},
+		{
+			name:           "Test account rejected by provider",
+			err:            providerError(&client.ProviderError{StatusCode: http.StatusNotFound, Kind: client.ProviderErrorInvalidAccount}),
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedCode:   models.ErrorCodeInvalidAccount,
+		},
+		{
+			name:           "Test payment provider failure",
+			err:            providerError(&client.ProviderError{StatusCode: http.StatusInternalServerError, Kind: client.ProviderErrorTransient}),
+			expectedStatus: http.StatusBadGateway,
+			expectedCode:   models.ErrorCodeProviderError,
+		},
+		{
+			name:           "Test payment provider asked to back off",
+			err:            providerError(&client.ProviderError{StatusCode: http.StatusServiceUnavailable, Kind: client.ProviderErrorTransient}),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   models.ErrorCodeProviderUnavailable,
+		},
+		{
+			name:           "Test payment provider circuit open",
+			err:            providerError(client.ErrCircuitOpen),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   models.ErrorCodeProviderUnavailable,
+		},
+		{
+			name:           "Test unknown error",
+			err:            errors.New("connection reset"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   models.ErrorCodeInternalError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			status, response := errorResponse(testCase.err)
+			assert.Equal(t, testCase.expectedStatus, status)
+			assert.Equal(t, testCase.expectedCode, response.Code)
+			assert.NotEmpty(t, response.ErrorMessage)
+		})
+	}
+}
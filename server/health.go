@@ -0,0 +1,112 @@
+package server
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/models"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// dependencyCheckTimeout bounds each dependency check made by the readiness endpoint
+const dependencyCheckTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	config        *environment.Config
+	mongodbStore  database.MongoDBStore
+	paymentClient client.ThirdPartyAPIClient
+	draining      atomic.Bool
+}
+
+func NewHealthHandler(config *environment.Config, store database.MongoDBStore, paymentClient client.ThirdPartyAPIClient) *HealthHandler {
+	return &HealthHandler{config: config, mongodbStore: store, paymentClient: paymentClient}
+}
+
+// SetDraining makes readiness fail from now on, it is called once the service starts shutting down
+func (handler *HealthHandler) SetDraining() {
+	handler.draining.Store(true)
+}
+
+// LivenessHandler reports that the process is up and able to serve requests
+func (handler *HealthHandler) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, models.HealthResponse{Status: models.HealthStatusOK}, http.StatusOK)
+}
+
+// ReadinessHandler reports whether the service can take traffic, every dependency has to be up. The state of the
+// payment provider circuit is always reported but an open circuit only fails readiness when the provider is checked.
+func (handler *HealthHandler) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	if handler.draining.Load() {
+		writeHealth(w, models.HealthResponse{Status: models.HealthStatusDraining}, http.StatusServiceUnavailable)
+		return
+	}
+
+	checks := map[string]func(ctx context.Context) error{
+		"mongodb": handler.mongodbStore.Ping,
+	}
+	if handler.config.ReadinessCheckProvider {
+		checks["payment_provider"] = handler.paymentClient.Ping
+	}
+
+	response := models.HealthResponse{
+		Status:          models.HealthStatusOK,
+		Checks:          make(map[string]models.DependencyStatus, len(checks)),
+		ProviderCircuit: string(handler.paymentClient.CircuitState()),
+	}
+	statusCode := http.StatusOK
+
+	if handler.config.ReadinessCheckProvider && response.ProviderCircuit == string(client.CircuitOpen) {
+		response.Status = models.HealthStatusDown
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	for name, check := range checks {
+		dependency := checkDependency(r.Context(), check)
+		if dependency.Status != models.HealthStatusUp {
+			response.Status = models.HealthStatusDown
+			statusCode = http.StatusServiceUnavailable
+		}
+		response.Checks[name] = dependency
+	}
+
+	writeHealth(w, response, statusCode)
+}
+
+func checkDependency(ctx context.Context, check func(ctx context.Context) error) models.DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	dependency := models.DependencyStatus{
+		Status:    models.HealthStatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		dependency.Status = models.HealthStatusDown
+		dependency.Error = err.Error()
+	}
+
+	return dependency
+}
+
+func writeHealth(w http.ResponseWriter, response models.HealthResponse, statusCode int) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		slog.Error("error marshalling health response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// health responses must never be cached by proxies
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(data); err != nil {
+		slog.Warn("error writing health response", "error", err)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_HealthHandler_Liveness(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	handler := NewHealthHandler(&environment.Config{}, mocks.NewMockMongoDBStore(controller), mocks.NewMockThirdPartyAPIClient(controller))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+
+	handler.LivenessHandler(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.HealthResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.HealthStatusOK, response.Status)
+}
+
+func Test_HealthHandler_Readiness(t *testing.T) {
+	const (
+		success = iota
+		successWithProviderCheck
+		errorDatabaseDown
+		errorProviderDown
+		circuitOpen
+		circuitOpenWithProviderCheck
+		draining
+	)
+
+	testCases := []struct {
+		name          string
+		checkProvider bool
+		testType      int
+	}{
+		{
+			name:     "Test success",
+			testType: success,
+		},
+
+		{
+			name:          "Test success with payment provider check",
+			checkProvider: true,
+			testType:      successWithProviderCheck,
+		},
+
+		{
+			name:     "Test error database unreachable",
+			testType: errorDatabaseDown,
+		},
+
+		{
+			name:          "Test error payment provider unreachable",
+			checkProvider: true,
+			testType:      errorProviderDown,
+		},
+
+		{
+			name:     "Test open provider circuit is reported",
+			testType: circuitOpen,
+		},
+
+		{
+			name:          "Test not ready while provider circuit is open",
+			checkProvider: true,
+			testType:      circuitOpenWithProviderCheck,
+		},
+
+		{
+			name:     "Test not ready while draining",
+			testType: draining,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := &environment.Config{
+				THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+				ReadinessCheckProvider:       testCase.checkProvider,
+			}
+			handler := NewHealthHandler(cfg, mockDataStore, mockThirdPartyClient)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+
+			var response models.HealthResponse
+
+			switch testCase.testType {
+			case success:
+				mockThirdPartyClient.
+					EXPECT().
+					CircuitState().
+					Return(client.CircuitClosed)
+
+				mockDataStore.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(nil)
+
+				handler.ReadinessHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.HealthStatusOK, response.Status)
+				assert.Equal(t, models.HealthStatusUp, response.Checks["mongodb"].Status)
+				assert.NotContains(t, response.Checks, "payment_provider")
+				assert.Equal(t, string(client.CircuitClosed), response.ProviderCircuit)
+
+			case successWithProviderCheck:
+				mockThirdPartyClient.
+					EXPECT().
+					CircuitState().
+					Return(client.CircuitClosed)
+
+				mockDataStore.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(nil)
+
+				handler.ReadinessHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.HealthStatusUp, response.Checks["mongodb"].Status)
+				assert.Equal(t, models.HealthStatusUp, response.Checks["payment_provider"].Status)
+
+			case errorDatabaseDown:
+				mockThirdPartyClient.
+					EXPECT().
+					CircuitState().
+					Return(client.CircuitClosed)
+
+				mockDataStore.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(errors.New("server selection timeout"))
+
+				handler.ReadinessHandler(w, r)
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.HealthStatusDown, response.Status)
+				assert.Equal(t, models.HealthStatusDown, response.Checks["mongodb"].Status)
+				assert.Equal(t, "server selection timeout", response.Checks["mongodb"].Error)
+
+			case errorProviderDown:
+				mockThirdPartyClient.
+					EXPECT().
+					CircuitState().
+					Return(client.CircuitClosed)
+
+				mockDataStore.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(errors.New("connection refused"))
+
+				handler.ReadinessHandler(w, r)
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.HealthStatusUp, response.Checks["mongodb"].Status)
+				assert.Equal(t, models.HealthStatusDown, response.Checks["payment_provider"].Status)
+
+			case circuitOpen:
+				mockDataStore.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					CircuitState().
+					Return(client.CircuitOpen)
+
+				handler.ReadinessHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.HealthStatusOK, response.Status)
+				assert.Equal(t, string(client.CircuitOpen), response.ProviderCircuit)
+
+			case circuitOpenWithProviderCheck:
+				mockDataStore.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					Ping(gomock.Any()).
+					Return(nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					CircuitState().
+					Return(client.CircuitOpen)
+
+				handler.ReadinessHandler(w, r)
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.HealthStatusDown, response.Status)
+				assert.Equal(t, models.HealthStatusUp, response.Checks["payment_provider"].Status)
+				assert.Equal(t, string(client.CircuitOpen), response.ProviderCircuit)
+
+			case draining:
+				handler.SetDraining()
+
+				handler.ReadinessHandler(w, r)
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.HealthStatusDraining, response.Status)
+			}
+		})
+	}
+}
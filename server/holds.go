@@ -0,0 +1,189 @@
+package server
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/ledger"
+	"consumer-payment-service/limits"
+	"consumer-payment-service/logging"
+	"consumer-payment-service/models"
+	"consumer-payment-service/reconciler"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// Labels of authorizations and their captures in request hashes and metrics
+const (
+	authorizationType = "AUTHORIZATION"
+	captureType       = "CAPTURE"
+)
+
+// AuthorizePaymentHandler places a hold on an account of the user, taking the amount out of its available balance
+// until the authorization is captured, voided or expires. The payment provider is only called on capture.
+func (handler *HttpHandler) AuthorizePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	payload, ok := handler.decodePaymentPayload(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	key := idempotencyKey(r, payload.Reference)
+	hash := requestHash(authorizationType, payload)
+	if previous, seen := handler.previousRequest(ctx, w, key, hash, payload.Reference); seen {
+		if previous != nil {
+			handler.responseWriter(w, previous, http.StatusCreated)
+		}
+		return
+	}
+
+	// validate user exist
+	user, err := handler.mongodbStore.GetUserById(ctx, payload.UserId)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error getting user", "user_id", payload.UserId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	// validate account exist and belongs to the user
+	account, err := handler.mongodbStore.GetUserAccount(ctx, payload.UserId, payload.AccountId)
+	if err != nil {
+		handler.errorWriter(w, err)
+		return
+	}
+
+	if account.Closed() {
+		handler.errorWriter(w, database.ErrAccountClosed)
+		return
+	}
+
+	if account.Balance.Currency != payload.Amount.Currency {
+		handler.errorWriter(w, database.ErrCurrencyMismatch)
+		return
+	}
+
+	spendingLimits := limits.Resolve(handler.config.SpendingLimitTiers, handler.config.DefaultSpendingTier, user, account)
+
+	now := time.Now()
+	transaction := &models.Transaction{
+		Reference:      payload.Reference,
+		UserID:         payload.UserId,
+		AccountID:      payload.AccountId,
+		Amount:         payload.Amount,
+		Type:           models.DEBIT,
+		Status:         models.AUTHORIZED,
+		ExpiresAt:      now.Add(handler.config.HoldExpiry).Unix(),
+		IdempotencyKey: key,
+		RequestHash:    hash,
+		CreatedAt:      now.Unix(),
+	}
+
+	// hold the amount and record the authorization together, the hold only applies when the available balance covers it
+	// and the debits and holds made so far leave room for it under the spending limits of the account. The capture is
+	// counted as the hold was, so it is not checked again.
+	err = handler.mongodbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		if err := limits.Check(ctx, store, account, spendingLimits, transaction.Amount); err != nil {
+			return err
+		}
+
+		if _, err := store.AdjustAvailableBalance(ctx, transaction.AccountID, transaction.Amount.Negate()); err != nil {
+			return err
+		}
+
+		return store.CreateTransaction(ctx, transaction)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error placing hold", "reference", payload.Reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, transaction, http.StatusCreated)
+}
+
+// CapturePaymentHandler pays out all or part of an authorization through the payment provider. The hold is released
+// and the captured amount debited in its place, from then on the capture is a debit like any other.
+func (handler *HttpHandler) CapturePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload models.CaptureRequestPayload
+	if !handler.decodePayload(w, r, &payload) {
+		return
+	}
+
+	reference := chi.URLParam(r, "reference")
+	ctx := r.Context()
+
+	authorization, err := handler.mongodbStore.GetPaymentByReferenceId(ctx, reference)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error getting authorization", "reference", reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	if !authorization.Capturable(time.Now().Unix()) {
+		handler.errorWriter(w, database.ErrHoldNotActive)
+		return
+	}
+
+	amount := authorization.Amount
+	if payload.Amount != nil {
+		if payload.Amount.Currency != amount.Currency {
+			handler.errorWriter(w, database.ErrCurrencyMismatch)
+			return
+		}
+		if payload.Amount.Minor > amount.Minor {
+			handler.errorWriter(w, database.ErrCaptureExceedsHold)
+			return
+		}
+		amount = *payload.Amount
+	}
+
+	// the hold and the debit swap places together with the authorization becoming a pending debit
+	var transaction *models.Transaction
+	err = handler.mongodbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		var err error
+		if transaction, err = store.CaptureHold(ctx, reference, amount); err != nil {
+			return err
+		}
+
+		if _, err := store.AdjustAvailableBalance(ctx, transaction.AccountID, *transaction.AuthorizedAmount); err != nil {
+			return err
+		}
+
+		return ledger.Post(ctx, store, ledger.Withdrawal(transaction))
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error capturing authorization", "reference", reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	if _, err = handler.paymentClient.MakeWithdrawal(ctx, transaction.AccountID, reference, amount); err != nil {
+		handler.failPayment(ctx, transaction, err)
+		handler.errorWriter(w, providerError(err))
+		return
+	}
+
+	// a capture left pending here holds its debit until it is reconciled
+	if err = reconciler.Finalize(ctx, handler.mongodbStore, transaction, models.SUCCESS, "", 0, ""); err != nil {
+		logging.FromContext(ctx).Error("error completing capture", "reference", reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, transaction)
+}
+
+// VoidPaymentHandler cancels an authorization that has not been captured and releases its hold
+func (handler *HttpHandler) VoidPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	reference := chi.URLParam(r, "reference")
+	ctx := r.Context()
+
+	transaction, err := reconciler.EndHold(ctx, handler.mongodbStore, reference, models.VOIDED)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error voiding authorization", "reference", reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, transaction)
+}
@@ -0,0 +1,606 @@
+package server
+
+import (
+	"bytes"
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/database/databasetest"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_HttpHandler_AuthorizePayment(t *testing.T) {
+	const (
+		success = iota
+		successWithinLimits
+		errorInsufficientFunds
+		errorLimitExceeded
+		errorAccountClosed
+		errorCurrencyMismatch
+		replayedRequest
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			testType: success,
+		},
+
+		{
+			name:     "Test success holds and debits so far leave room under the spending limits",
+			testType: successWithinLimits,
+		},
+
+		{
+			name:     "Test error available balance does not cover the hold",
+			testType: errorInsufficientFunds,
+		},
+
+		{
+			name:     "Test error hold exceeds the spending limits",
+			testType: errorLimitExceeded,
+		},
+
+		{
+			name:     "Test error account closed",
+			testType: errorAccountClosed,
+		},
+
+		{
+			name:     "Test error amount in another currency",
+			testType: errorCurrencyMismatch,
+		},
+
+		{
+			name:     "Test replayed request returns the authorization",
+			testType: replayedRequest,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	dailyLimit := models.NewMoney(1500, "NGN")
+	cfg := &environment.Config{
+		HoldExpiry: time.Hour,
+		SpendingLimitTiers: map[string]map[string]models.SpendingLimits{
+			"capped": {"NGN": {Daily: &dailyLimit}},
+		},
+	}
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	handler := NewHTTPHandler(cfg, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	payload := models.PaymentRequestPayload{
+		UserId:    "usr-001",
+		AccountId: "acc_001",
+		Reference: "auth-001",
+		Amount:    models.NewMoney(1000, "NGN"),
+	}
+	body, _ := json.Marshal(payload)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/payments/authorize", bytes.NewBuffer(body))
+
+			mockAccount := &models.Account{
+				AccountID: "acc_001",
+				Balance:   models.NewMoney(5000, "NGN"),
+				Available: models.NewMoney(5000, "NGN"),
+				UserID:    "usr-001",
+			}
+			mockUser := &models.User{Id: "usr-001"}
+
+			expectAccount := func(account *models.Account) {
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "auth-001").
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), "usr-001").
+					Return(mockUser, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), "usr-001", "acc_001").
+					Return(account, nil)
+			}
+
+			switch testCase.testType {
+			case success:
+				expectAccount(mockAccount)
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAvailableBalance(gomock.Any(), "acc_001", models.NewMoney(-1000, "NGN")).
+					Return(mockAccount, nil)
+
+				var authorization *models.Transaction
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ any, transaction *models.Transaction) error {
+						authorization = transaction
+						return nil
+					})
+
+				handler.AuthorizePaymentHandler(w, r)
+				assert.Equal(t, http.StatusCreated, w.Code)
+
+				assert.Equal(t, models.AUTHORIZED, authorization.Status)
+				assert.Equal(t, models.DEBIT, authorization.Type)
+				assert.Equal(t, requestHash(authorizationType, payload), authorization.RequestHash)
+				assert.Equal(t, authorization.CreatedAt+int64(time.Hour.Seconds()), authorization.ExpiresAt)
+
+				var response models.Transaction
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.AUTHORIZED, response.Status)
+				assert.Equal(t, authorization.ExpiresAt, response.ExpiresAt)
+
+			case successWithinLimits:
+				mockUser.Tier = "capped"
+				expectAccount(mockAccount)
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					LockUser(gomock.Any(), "usr-001").
+					Return(mockUser, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserDebitTotals(gomock.Any(), "usr-001", "NGN", gomock.Any(), gomock.Any()).
+					Return(&models.DebitTotals{Daily: 500, DailyCount: 1, Monthly: 500}, nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAvailableBalance(gomock.Any(), "acc_001", models.NewMoney(-1000, "NGN")).
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				handler.AuthorizePaymentHandler(w, r)
+				assert.Equal(t, http.StatusCreated, w.Code)
+
+			case errorLimitExceeded:
+				mockUser.Tier = "capped"
+				expectAccount(mockAccount)
+				databasetest.ExpectWithTx(mockDataStore)
+
+				// the holds still authorized count towards the limits as the debits do
+				mockDataStore.
+					EXPECT().
+					LockUser(gomock.Any(), "usr-001").
+					Return(mockUser, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserDebitTotals(gomock.Any(), "usr-001", "NGN", gomock.Any(), gomock.Any()).
+					Return(&models.DebitTotals{Daily: 900, DailyCount: 2, Monthly: 900}, nil)
+
+				handler.AuthorizePaymentHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeLimitExceeded, response.Code)
+
+				remaining := models.NewMoney(600, "NGN")
+				assert.Equal(t, &models.LimitExceeded{Limit: models.LimitDaily, RemainingAmount: &remaining}, response.Limit)
+
+			case errorInsufficientFunds:
+				expectAccount(mockAccount)
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAvailableBalance(gomock.Any(), "acc_001", models.NewMoney(-1000, "NGN")).
+					Return(nil, database.ErrInsufficientFunds)
+
+				handler.AuthorizePaymentHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeInsufficientFunds, response.Code)
+
+			case errorAccountClosed:
+				mockAccount.Status = models.CLOSED
+				expectAccount(mockAccount)
+
+				handler.AuthorizePaymentHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case errorCurrencyMismatch:
+				mockAccount.Balance = models.NewMoney(5000, "USD")
+				expectAccount(mockAccount)
+
+				handler.AuthorizePaymentHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+			case replayedRequest:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "auth-001").
+					Return(&models.Transaction{
+						Reference:      "auth-001",
+						Amount:         models.NewMoney(1000, "NGN"),
+						Status:         models.AUTHORIZED,
+						IdempotencyKey: "auth-001",
+						RequestHash:    requestHash(authorizationType, payload),
+					}, nil)
+
+				handler.AuthorizePaymentHandler(w, r)
+				assert.Equal(t, http.StatusCreated, w.Code)
+				assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+			}
+		})
+	}
+}
+
+func Test_HttpHandler_CapturePayment(t *testing.T) {
+	const (
+		successFullCapture = iota
+		successPartialCapture
+		errorAuthorizationNotFound
+		errorAuthorizationExpired
+		errorExceedsAuthorizedAmount
+		errorCapturedConcurrently
+		errorMakingWithdrawal
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test success capturing the whole authorization",
+			testType: successFullCapture,
+		},
+
+		{
+			name:     "Test success capturing part of the authorization",
+			testType: successPartialCapture,
+		},
+
+		{
+			name:     "Test error authorization not found",
+			testType: errorAuthorizationNotFound,
+		},
+
+		{
+			name:     "Test error authorization expired",
+			testType: errorAuthorizationExpired,
+		},
+
+		{
+			name:     "Test error amount exceeds the authorized amount",
+			testType: errorExceedsAuthorizedAmount,
+		},
+
+		{
+			name:     "Test error authorization captured by another request in the meantime",
+			testType: errorCapturedConcurrently,
+		},
+
+		{
+			name:     "Test error making withdrawal on third party service releases the debit",
+			testType: errorMakingWithdrawal,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	// captures are not checked against the spending limits again, the hold already counted towards them
+	dailyLimit := models.NewMoney(500, "NGN")
+	cfg := &environment.Config{
+		SpendingLimitTiers:  map[string]map[string]models.SpendingLimits{"capped": {"NGN": {Daily: &dailyLimit}}},
+		DefaultSpendingTier: "capped",
+	}
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
+	handler := NewHTTPHandler(cfg, mockDataStore, mockThirdPartyClient)
+
+	newRequest := func(payload models.CaptureRequestPayload) *http.Request {
+		body, _ := json.Marshal(payload)
+		return newRouteRequest(http.MethodPost, "/payments/auth-001/capture", "reference", "auth-001", string(body))
+	}
+
+	// captured returns the authorization as it is once amount of it has been captured
+	captured := func(authorization *models.Transaction, amount models.Money) *models.Transaction {
+		capture := *authorization
+		capture.AuthorizedAmount = &authorization.Amount
+		capture.Amount = amount
+		capture.Status = models.PENDING
+		return &capture
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			mockAuthorization := &models.Transaction{
+				Reference: "auth-001",
+				UserID:    "usr-001",
+				AccountID: "acc_001",
+				Amount:    models.NewMoney(1000, "NGN"),
+				Type:      models.DEBIT,
+				Status:    models.AUTHORIZED,
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			}
+			mockAccount := &models.Account{AccountID: "acc_001"}
+
+			expectCapture := func(amount models.Money) {
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "auth-001").
+					Return(mockAuthorization, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					CaptureHold(gomock.Any(), "auth-001", amount).
+					Return(captured(mockAuthorization, amount), nil)
+
+				// the whole hold is released and only the captured amount debited
+				mockDataStore.
+					EXPECT().
+					AdjustAvailableBalance(gomock.Any(), "acc_001", models.NewMoney(1000, "NGN")).
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc_001", amount.Negate()).
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+			}
+
+			switch testCase.testType {
+			case successFullCapture:
+				expectCapture(models.NewMoney(1000, "NGN"))
+
+				mockThirdPartyClient.
+					EXPECT().
+					MakeWithdrawal(gomock.Any(), "acc_001", "auth-001", models.NewMoney(1000, "NGN")).
+					Return(&client.PaymentResponse{AccountId: "acc_001", Reference: "auth-001"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					UpdateTransactionStatus(gomock.Any(), "auth-001", models.SUCCESS).
+					Return(nil)
+
+				handler.CapturePaymentHandler(w, newRequest(models.CaptureRequestPayload{}))
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var response models.Transaction
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.SUCCESS, response.Status)
+				assert.Equal(t, models.NewMoney(1000, "NGN"), response.Amount)
+
+			case successPartialCapture:
+				amount := models.NewMoney(400, "NGN")
+				expectCapture(amount)
+
+				mockThirdPartyClient.
+					EXPECT().
+					MakeWithdrawal(gomock.Any(), "acc_001", "auth-001", amount).
+					Return(&client.PaymentResponse{AccountId: "acc_001", Reference: "auth-001"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					UpdateTransactionStatus(gomock.Any(), "auth-001", models.SUCCESS).
+					Return(nil)
+
+				handler.CapturePaymentHandler(w, newRequest(models.CaptureRequestPayload{Amount: &amount}))
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var response models.Transaction
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, amount, response.Amount)
+				assert.Equal(t, models.NewMoney(1000, "NGN"), *response.AuthorizedAmount)
+
+			case errorAuthorizationNotFound:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "auth-001").
+					Return(nil, database.ErrTransactionNotFound)
+
+				handler.CapturePaymentHandler(w, newRequest(models.CaptureRequestPayload{}))
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorAuthorizationExpired:
+				mockAuthorization.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "auth-001").
+					Return(mockAuthorization, nil)
+
+				handler.CapturePaymentHandler(w, newRequest(models.CaptureRequestPayload{}))
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeAuthorizationInactive, response.Code)
+
+			case errorExceedsAuthorizedAmount:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "auth-001").
+					Return(mockAuthorization, nil)
+
+				amount := models.NewMoney(1001, "NGN")
+				handler.CapturePaymentHandler(w, newRequest(models.CaptureRequestPayload{Amount: &amount}))
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeCaptureExceedsAmount, response.Code)
+
+			case errorCapturedConcurrently:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "auth-001").
+					Return(mockAuthorization, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					CaptureHold(gomock.Any(), "auth-001", models.NewMoney(1000, "NGN")).
+					Return(nil, database.ErrHoldNotActive)
+
+				handler.CapturePaymentHandler(w, newRequest(models.CaptureRequestPayload{}))
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case errorMakingWithdrawal:
+				expectCapture(models.NewMoney(1000, "NGN"))
+
+				mockThirdPartyClient.
+					EXPECT().
+					MakeWithdrawal(gomock.Any(), "acc_001", "auth-001", models.NewMoney(1000, "NGN")).
+					Return(nil, &client.ProviderError{StatusCode: http.StatusPaymentRequired, Kind: client.ProviderErrorDeclined, Message: "card declined"})
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc_001", models.NewMoney(1000, "NGN")).
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), "auth-001", "card declined", http.StatusPaymentRequired, string(client.ProviderErrorDeclined)).
+					Return(nil)
+
+				handler.CapturePaymentHandler(w, newRequest(models.CaptureRequestPayload{}))
+				assert.Equal(t, http.StatusPaymentRequired, w.Code)
+			}
+		})
+	}
+}
+
+func Test_HttpHandler_VoidPayment(t *testing.T) {
+	const (
+		success = iota
+		errorAuthorizationNotActive
+		errorReleasingHold
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			testType: success,
+		},
+
+		{
+			name:     "Test error authorization already captured",
+			testType: errorAuthorizationNotActive,
+		},
+
+		{
+			name:     "Test error releasing the hold",
+			testType: errorReleasingHold,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	handler := NewHTTPHandler(&environment.Config{}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	mockVoided := &models.Transaction{
+		Reference: "auth-001",
+		AccountID: "acc_001",
+		Amount:    models.NewMoney(1000, "NGN"),
+		Type:      models.DEBIT,
+		Status:    models.VOIDED,
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := newRouteRequest(http.MethodPost, "/payments/auth-001/void", "reference", "auth-001", "")
+
+			databasetest.ExpectWithTx(mockDataStore)
+
+			switch testCase.testType {
+			case success:
+				mockDataStore.
+					EXPECT().
+					ReleaseHold(gomock.Any(), "auth-001", models.VOIDED).
+					Return(mockVoided, nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAvailableBalance(gomock.Any(), "acc_001", models.NewMoney(1000, "NGN")).
+					Return(&models.Account{AccountID: "acc_001"}, nil)
+
+				handler.VoidPaymentHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var response models.Transaction
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.VOIDED, response.Status)
+
+			case errorAuthorizationNotActive:
+				mockDataStore.
+					EXPECT().
+					ReleaseHold(gomock.Any(), "auth-001", models.VOIDED).
+					Return(nil, database.ErrHoldNotActive)
+
+				handler.VoidPaymentHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case errorReleasingHold:
+				mockDataStore.
+					EXPECT().
+					ReleaseHold(gomock.Any(), "auth-001", models.VOIDED).
+					Return(mockVoided, nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAvailableBalance(gomock.Any(), "acc_001", models.NewMoney(1000, "NGN")).
+					Return(nil, errors.New("connection reset"))
+
+				handler.VoidPaymentHandler(w, r)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
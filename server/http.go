@@ -4,13 +4,19 @@ import (
 	"consumer-payment-service/client"
 	"consumer-payment-service/database"
 	"consumer-payment-service/environment"
+	"consumer-payment-service/logging"
+	"consumer-payment-service/metrics"
+	"consumer-payment-service/models"
+	"consumer-payment-service/tracing"
 	"net/http"
 
 	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func MountServer(cfg *environment.Config, mongodbStore database.MongoDBStore, paymentClient client.ThirdPartyAPIClient) *chi.Mux {
+func MountServer(cfg *environment.Config, mongodbStore database.MongoDBStore, paymentClient client.ThirdPartyAPIClient, healthHandler *HealthHandler, serviceMetrics *metrics.Metrics, tracerProvider trace.TracerProvider) *chi.Mux {
 	router := chi.NewRouter()
+	router.Use(tracing.Middleware(tracerProvider), logging.RequestIDMiddleware, logging.AccessLogMiddleware, serviceMetrics.InFlight)
 
 	httpHandler := NewHTTPHandler(cfg, mongodbStore, paymentClient)
 
@@ -19,9 +25,49 @@ func MountServer(cfg *environment.Config, mongodbStore database.MongoDBStore, pa
 		w.Write([]byte("a simple banking app service"))
 	})
 
-	router.Post("/payments/debit", httpHandler.PaymentDebitHandler)
+	router.Get("/healthz", healthHandler.LivenessHandler)
 
-	router.Post("/payments/credit", httpHandler.PaymentCreditHandler)
+	router.Get("/readyz", healthHandler.ReadinessHandler)
+
+	router.Method(http.MethodGet, "/metrics", serviceMetrics.Handler())
+
+	router.With(serviceMetrics.CountPayments(string(models.DEBIT))).Post("/payments/debit", httpHandler.PaymentDebitHandler)
+
+	router.With(serviceMetrics.CountPayments(string(models.CREDIT))).Post("/payments/credit", httpHandler.PaymentCreditHandler)
+
+	router.With(serviceMetrics.CountPayments(authorizationType)).Post("/payments/authorize", httpHandler.AuthorizePaymentHandler)
+
+	router.Get("/payments/{reference}", httpHandler.GetPaymentHandler)
+
+	router.With(serviceMetrics.CountPayments(captureType)).Post("/payments/{reference}/capture", httpHandler.CapturePaymentHandler)
+
+	router.Post("/payments/{reference}/void", httpHandler.VoidPaymentHandler)
+
+	router.With(serviceMetrics.CountPayments(reversalType)).Post("/payments/{reference}/reverse", httpHandler.ReversePaymentHandler)
+
+	router.With(serviceMetrics.CountPayments(transferType)).Post("/transfers", httpHandler.TransferHandler)
+
+	router.Post("/users", httpHandler.CreateUserHandler)
+
+	router.Get("/users/{id}", httpHandler.GetUserHandler)
+
+	router.Post("/users/{id}/accounts", httpHandler.OpenAccountHandler)
+
+	router.Post("/accounts/{id}/close", httpHandler.CloseAccountHandler)
+
+	router.Get("/accounts/{id}/transactions", httpHandler.ListAccountTransactionsHandler)
+
+	// spending limits are set by operators, clients must not be able to lift their own, and verifying the ledger
+	// reads every account and journal entry
+	router.Group(func(admin chi.Router) {
+		admin.Use(httpHandler.RequireAdmin)
+
+		admin.Get("/ledger/verify", httpHandler.VerifyLedgerHandler)
+
+		admin.Put("/users/{id}/tier", httpHandler.SetUserTierHandler)
+
+		admin.Put("/accounts/{id}/limits", httpHandler.SetAccountLimitsHandler)
+	})
 
 	return router
 }
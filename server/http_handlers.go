@@ -4,12 +4,23 @@ import (
 	"consumer-payment-service/client"
 	"consumer-payment-service/database"
 	"consumer-payment-service/environment"
+	"consumer-payment-service/ledger"
+	"consumer-payment-service/limits"
+	"consumer-payment-service/logging"
 	"consumer-payment-service/models"
+	"consumer-payment-service/reconciler"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/go-chi/chi"
 )
 
 type HttpHandler struct {
@@ -31,7 +42,7 @@ func (handler *HttpHandler) responseWriter(w http.ResponseWriter, response any,
 	if response != nil {
 		data, err := json.Marshal(response)
 		if err != nil {
-			log.Println("Error marshalling response")
+			slog.Error("error marshalling response", "error", err)
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusBadRequest)
 			return
@@ -48,150 +59,404 @@ func (handler *HttpHandler) responseWriter(w http.ResponseWriter, response any,
 	w.WriteHeader(statusCode)
 }
 
-func (handler *HttpHandler) PaymentCreditHandler(w http.ResponseWriter, r *http.Request) {
+// validator is implemented by request payloads, Validate returns every field that cannot be used
+type validator interface {
+	Validate() []models.FieldError
+}
+
+// decodePaymentPayload reads and validates a payment request body. When the request cannot be used the error
+// response has already been written and false is returned.
+func (handler *HttpHandler) decodePaymentPayload(w http.ResponseWriter, r *http.Request) (models.PaymentRequestPayload, bool) {
+	var payload models.PaymentRequestPayload
+	ok := handler.decodePayload(w, r, &payload)
+	return payload, ok
+}
 
+// decodePayload reads a JSON request body into payload and validates it. When the request cannot be used the
+// error response has already been written and false is returned.
+func (handler *HttpHandler) decodePayload(w http.ResponseWriter, r *http.Request, payload validator) bool {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Println("Error reading request body")
+		logging.FromContext(r.Context()).Warn("error reading request body", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
-		return
+		return false
 	}
 
 	defer func() {
 		if err := r.Body.Close(); err != nil {
-			log.Println("Error closing request body")
+			logging.FromContext(r.Context()).Warn("error closing request body", "error", err)
 		}
 	}()
 
-	var payload models.PaymentRequestPayload
-	err = json.Unmarshal(body, &payload)
+	var fieldErrors []models.FieldError
+
+	err = json.Unmarshal(body, payload)
+	switch {
+	case errors.Is(err, models.ErrInvalidAmount):
+		fieldErrors = []models.FieldError{{Field: "amount", Reason: err.Error()}}
+	case errors.Is(err, models.ErrInvalidCurrency):
+		fieldErrors = []models.FieldError{{Field: "amount.currency", Reason: err.Error()}}
+	case err != nil:
+		response := models.ErrorResponse{
+			Code:         models.ErrorCodeInvalidRequest,
+			ErrorMessage: "request body is not valid JSON",
+		}
+		handler.responseWriter(w, response, http.StatusBadRequest)
+		return false
+	default:
+		fieldErrors = payload.Validate()
+	}
+
+	if len(fieldErrors) > 0 {
+		response := models.ErrorResponse{
+			Code:         models.ErrorCodeValidationFailed,
+			ErrorMessage: "request validation failed",
+			Fields:       fieldErrors,
+		}
+		handler.responseWriter(w, response, http.StatusUnprocessableEntity)
+		return false
+	}
+
+	return true
+}
+
+// IdempotencyKeyHeader lets clients pick an idempotency key other than the payment reference
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+func idempotencyKey(r *http.Request, reference string) string {
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		return key
+	}
+	return reference
+}
+
+// requestHash fingerprints a payment request so that replays can be told apart from reused keys
+func requestHash(transactionType models.TransactionType, payload models.PaymentRequestPayload) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s|%s", transactionType, payload.UserId, payload.AccountId, payload.Reference, payload.Amount)))
+	return hex.EncodeToString(sum[:])
+}
+
+// previousRequest looks up the transaction recorded by an earlier request with the same reference or
+// idempotency key. When that request was a different one the idempotency conflict has already been written.
+// It returns false when the request has not been seen before and should be processed.
+func (handler *HttpHandler) previousRequest(ctx context.Context, w http.ResponseWriter, key, hash, reference string) (*models.Transaction, bool) {
+	transaction, err := handler.mongodbStore.GetPaymentByReferenceId(ctx, reference)
+	if errors.Is(err, database.ErrTransactionNotFound) && key != reference {
+		transaction, err = handler.mongodbStore.GetTransactionByIdempotencyKey(ctx, key)
+	}
+
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		if errors.Is(err, database.ErrTransactionNotFound) {
+			return nil, false
+		}
+
+		logging.FromContext(ctx).Error("error checking idempotency key", "reference", reference, "error", err)
+		handler.errorWriter(w, err)
+		return nil, true
+	}
+
+	if transaction.IdempotencyKey != key || transaction.RequestHash != hash {
+		response := models.ErrorResponse{
+			Code:         models.ErrorCodeIdempotencyConflict,
+			ErrorMessage: "idempotency key or reference already used with a different request",
+		}
+		handler.responseWriter(w, response, http.StatusConflict)
+		return nil, true
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	return transaction, true
+}
+
+// replayPayment writes the outcome of a previous request made with the same idempotency key or reference.
+// It returns false when the request has not been seen before and should be processed.
+func (handler *HttpHandler) replayPayment(ctx context.Context, w http.ResponseWriter, key, hash, reference string) bool {
+	transaction, seen := handler.previousRequest(ctx, w, key, hash, reference)
+	if transaction == nil {
+		return seen
+	}
+
+	switch transaction.Status {
+	case models.PENDING:
+		response := models.ErrorResponse{
+			Code:         models.ErrorCodePaymentInProgress,
+			ErrorMessage: "payment is still being processed",
+		}
+		handler.responseWriter(w, response, http.StatusConflict)
+	case models.FAILED:
+		handler.replayFailure(w, transaction)
+	default:
+		handler.responseWriter(w, nil)
+	}
+	return true
+}
+
+// replayFailure writes the error a FAILED payment was first answered with, rebuilt from what the provider said and
+// how it was classified. A payment the provider only reported as failed once it was looked up again gets the generic
+// failure.
+func (handler *HttpHandler) replayFailure(w http.ResponseWriter, transaction *models.Transaction) {
+	switch transaction.FailureKind {
+	case circuitOpenFailure:
+		handler.errorWriter(w, providerError(client.ErrCircuitOpen))
+	case "":
+		response := models.ErrorResponse{
+			Code:         models.ErrorCodePaymentFailed,
+			ErrorMessage: "payment failed at the payment provider: " + transaction.FailureReason,
+		}
+		handler.responseWriter(w, response, http.StatusBadGateway)
+	default:
+		handler.errorWriter(w, providerError(&client.ProviderError{
+			StatusCode: transaction.ProviderStatusCode,
+			Message:    transaction.FailureReason,
+			Kind:       client.ProviderErrorKind(transaction.FailureKind),
+		}))
+	}
+}
+
+func (handler *HttpHandler) PaymentCreditHandler(w http.ResponseWriter, r *http.Request) {
+	payload, ok := handler.decodePaymentPayload(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	key := idempotencyKey(r, payload.Reference)
+	hash := requestHash(models.CREDIT, payload)
+	if handler.replayPayment(ctx, w, key, hash, payload.Reference) {
 		return
 	}
 
 	// validate user exist
-	if _, err = handler.mongodbStore.GetUserById(payload.UserId); err != nil {
-		log.Printf("error getting user %v", err)
-		handler.responseWriter(w, nil, http.StatusInternalServerError)
+	if _, err := handler.mongodbStore.GetUserById(ctx, payload.UserId); err != nil {
+		logging.FromContext(ctx).Warn("error getting user", "user_id", payload.UserId, "error", err)
+		handler.errorWriter(w, err)
 		return
 	}
 
-	// validate account exist
-	account, err := handler.mongodbStore.GetAccountByID(payload.AccountId)
+	// validate account exist and belongs to the user
+	account, err := handler.mongodbStore.GetUserAccount(ctx, payload.UserId, payload.AccountId)
 	if err != nil {
-		handler.responseWriter(w, nil, http.StatusInternalServerError)
+		handler.errorWriter(w, err)
 		return
 	}
 
-	// make credit API call to third party service
-	resp, err := handler.paymentClient.MakeDeposit(payload.AccountId, payload.Reference, payload.Amount)
-	if err != nil {
-		handler.responseWriter(w, nil, http.StatusInternalServerError)
+	if account.Closed() {
+		handler.errorWriter(w, database.ErrAccountClosed)
+		return
+	}
+
+	if account.Balance.Currency != payload.Amount.Currency {
+		handler.errorWriter(w, database.ErrCurrencyMismatch)
 		return
 	}
 
 	transaction := &models.Transaction{
-		Reference: resp.Reference,
-		UserID:    payload.UserId,
-		AccountID: resp.AccountId,
-		Amount:    resp.Amount,
-		Type:      models.CREDIT,
-		Status:    models.SUCCESS,
-		CreatedAt: time.Now().Unix(),
+		Reference:      payload.Reference,
+		UserID:         payload.UserId,
+		AccountID:      payload.AccountId,
+		Amount:         payload.Amount,
+		Type:           models.CREDIT,
+		Status:         models.PENDING,
+		IdempotencyKey: key,
+		RequestHash:    hash,
+		CreatedAt:      time.Now().Unix(),
 	}
 
-	err = handler.mongodbStore.CreateTransaction(transaction)
+	// record the attempt before the provider is called so that every outcome can be traced, the account is locked
+	// with it so that it cannot be closed while the credit is in flight
+	err = handler.mongodbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		if _, err := store.LockAccount(ctx, transaction.AccountID); err != nil {
+			return err
+		}
+
+		return store.CreateTransaction(ctx, transaction)
+	})
 	if err != nil {
-		log.Println("error creating transaction")
-		handler.responseWriter(w, nil, http.StatusNotFound)
+		logging.FromContext(ctx).Error("error recording credit", "reference", payload.Reference, "error", err)
+		handler.errorWriter(w, err)
 		return
 	}
 
-	newBalance := account.Balance + payload.Amount
+	// make credit API call to third party service
+	if _, err = handler.paymentClient.MakeDeposit(ctx, payload.AccountId, payload.Reference, payload.Amount); err != nil {
+		handler.failPayment(ctx, transaction, err)
+		handler.errorWriter(w, providerError(err))
+		return
+	}
 
-	if err = handler.mongodbStore.UpdateAccountBalance(payload.AccountId, newBalance); err != nil {
-		handler.responseWriter(w, nil, http.StatusNotFound)
+	// complete the transaction and credit the account together, a credit left pending here is picked up by the reconciler
+	if err = reconciler.Finalize(ctx, handler.mongodbStore, transaction, models.SUCCESS, "", 0, ""); err != nil {
+		logging.FromContext(ctx).Error("error completing credit", "reference", payload.Reference, "error", err)
+		handler.errorWriter(w, err)
 		return
 	}
 
 	handler.responseWriter(w, nil)
 }
 
-func (handler *HttpHandler) PaymentDebitHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Println("Error reading request body")
-		w.WriteHeader(http.StatusBadRequest)
+// circuitOpenFailure is the failure kind of a payment failed without calling the provider because its circuit was open
+const circuitOpenFailure = "circuit_open"
+
+// providerFailure returns what the payment provider said about a failed call and how its answer was classified
+func providerFailure(err error) (string, int, string) {
+	var providerErr *client.ProviderError
+	switch {
+	case errors.As(err, &providerErr):
+		return providerErr.Message, providerErr.StatusCode, string(providerErr.Kind)
+	case errors.Is(err, client.ErrCircuitOpen):
+		return err.Error(), 0, circuitOpenFailure
+	}
+	return err.Error(), 0, ""
+}
+
+// providerRefused reports whether a failed call certainly did not move any money: the provider refused the payment
+// or the call was never made because its circuit is open. After a timeout or a failure of the provider itself the
+// payment may still have been made.
+func providerRefused(err error) bool {
+	if errors.Is(err, client.ErrCircuitOpen) {
+		return true
+	}
+
+	var providerErr *client.ProviderError
+	return errors.As(err, &providerErr) && providerErr.Kind != client.ProviderErrorTransient
+}
+
+// failPayment marks a payment the provider refused as failed, releasing the amount reserved for a debit. A payment
+// the provider may have made is left pending, with its reservation held, for the reconciler to settle.
+func (handler *HttpHandler) failPayment(ctx context.Context, transaction *models.Transaction, providerErr error) {
+	if !providerRefused(providerErr) {
+		logging.FromContext(ctx).Warn("payment outcome unknown, leaving it pending", "reference", transaction.Reference, "error", providerErr)
 		return
 	}
 
-	defer func() {
-		if err := r.Body.Close(); err != nil {
-			log.Println("Error closing request body")
-		}
-	}()
+	reason, statusCode, kind := providerFailure(providerErr)
+	if err := reconciler.Finalize(ctx, handler.mongodbStore, transaction, models.FAILED, reason, statusCode, kind); err != nil {
+		logging.FromContext(ctx).Error("error failing payment", "reference", transaction.Reference, "error", err)
+	}
+}
 
-	var payload models.PaymentRequestPayload
-	err = json.Unmarshal(body, &payload)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+func (handler *HttpHandler) PaymentDebitHandler(w http.ResponseWriter, r *http.Request) {
+	payload, ok := handler.decodePaymentPayload(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	key := idempotencyKey(r, payload.Reference)
+	hash := requestHash(models.DEBIT, payload)
+	if handler.replayPayment(ctx, w, key, hash, payload.Reference) {
 		return
 	}
 
 	// validate user exist
-	if _, err = handler.mongodbStore.GetUserById(payload.UserId); err != nil {
-		log.Printf("error getting user %v", err)
-		handler.responseWriter(w, nil, http.StatusInternalServerError)
+	user, err := handler.mongodbStore.GetUserById(ctx, payload.UserId)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error getting user", "user_id", payload.UserId, "error", err)
+		handler.errorWriter(w, err)
 		return
 	}
 
-	// validate account exist
-	account, err := handler.mongodbStore.GetAccountByID(payload.AccountId)
+	// validate account exist and belongs to the user
+	account, err := handler.mongodbStore.GetUserAccount(ctx, payload.UserId, payload.AccountId)
 	if err != nil {
-		handler.responseWriter(w, nil, http.StatusInternalServerError)
+		handler.errorWriter(w, err)
 		return
 	}
 
-	// check balance
-	if payload.Amount > float64(account.Balance) {
-		log.Println("insufficient balance")
-		response := models.ErrorResponse{
-			ErrorMessage: "insufficient balance",
-		}
-		handler.responseWriter(w, response, http.StatusInternalServerError)
+	if account.Closed() {
+		handler.errorWriter(w, database.ErrAccountClosed)
 		return
 	}
 
-	// make API call to third party payment service for debit
-	resp, err := handler.paymentClient.MakeWithdrawal(payload.AccountId, payload.Reference, payload.Amount)
-	if err != nil {
-		handler.responseWriter(w, nil, http.StatusInternalServerError)
+	if account.Balance.Currency != payload.Amount.Currency {
+		handler.errorWriter(w, database.ErrCurrencyMismatch)
 		return
 	}
 
-	newBalance := account.Balance - payload.Amount
+	spendingLimits := limits.Resolve(handler.config.SpendingLimitTiers, handler.config.DefaultSpendingTier, user, account)
 
 	transaction := &models.Transaction{
-		Reference: resp.Reference,
-		UserID:    payload.UserId,
-		AccountID: resp.AccountId,
-		Amount:    resp.Amount,
-		Type:      models.DEBIT,
-		Status:    models.SUCCESS,
-		CreatedAt: time.Now().Unix(),
+		Reference:      payload.Reference,
+		UserID:         payload.UserId,
+		AccountID:      payload.AccountId,
+		Amount:         payload.Amount,
+		Type:           models.DEBIT,
+		Status:         models.PENDING,
+		IdempotencyKey: key,
+		RequestHash:    hash,
+		CreatedAt:      time.Now().Unix(),
 	}
 
-	err = handler.mongodbStore.CreateTransaction(transaction)
+	// reserve the amount and record the pending debit together, the balance is only debited when it covers the amount
+	// and the debits made so far leave room for it under the spending limits of the account
+	err = handler.mongodbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		if err := limits.Check(ctx, store, account, spendingLimits, transaction.Amount); err != nil {
+			return err
+		}
+
+		if err := ledger.Post(ctx, store, ledger.Withdrawal(transaction)); err != nil {
+			return err
+		}
+
+		return store.CreateTransaction(ctx, transaction)
+	})
 	if err != nil {
-		handler.responseWriter(w, nil, http.StatusInternalServerError)
+		logging.FromContext(ctx).Error("error reserving debit", "reference", payload.Reference, "error", err)
+		handler.errorWriter(w, err)
 		return
 	}
 
-	if err = handler.mongodbStore.UpdateAccountBalance(payload.AccountId, newBalance); err != nil {
-		handler.responseWriter(w, nil, http.StatusInternalServerError)
+	// make API call to third party payment service for debit
+	if _, err = handler.paymentClient.MakeWithdrawal(ctx, payload.AccountId, payload.Reference, payload.Amount); err != nil {
+		handler.failPayment(ctx, transaction, err)
+		handler.errorWriter(w, providerError(err))
+		return
+	}
+
+	// the money has moved at the provider, a debit left pending here holds its reservation until it is reconciled
+	if err = reconciler.Finalize(ctx, handler.mongodbStore, transaction, models.SUCCESS, "", 0, ""); err != nil {
+		logging.FromContext(ctx).Error("error completing debit", "reference", payload.Reference, "error", err)
+		handler.errorWriter(w, err)
 		return
 	}
 
 	handler.responseWriter(w, nil)
 }
+
+func (handler *HttpHandler) GetPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	reference := chi.URLParam(r, "reference")
+	ctx := r.Context()
+
+	transaction, err := handler.mongodbStore.GetPaymentByReferenceId(ctx, reference)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting payment", "reference", reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	// refresh a pending payment from third party payment service when requested, finalized payments do not change
+	if r.URL.Query().Get("refresh") == "true" && transaction.Status == models.PENDING {
+		resp, err := handler.paymentClient.RetrieveTransaction(ctx, reference)
+
+		var providerErr *client.ProviderError
+		switch {
+		case errors.As(err, &providerErr) && providerErr.Kind == client.ProviderErrorPaymentNotFound:
+			// the provider never received the payment so no money moved
+			err = reconciler.Finalize(ctx, handler.mongodbStore, transaction, models.FAILED, providerErr.Message, providerErr.StatusCode, "")
+		case err != nil:
+			logging.FromContext(ctx).Error("error retrieving payment from third party service", "reference", reference, "error", err)
+			handler.errorWriter(w, providerError(err))
+			return
+		default:
+			err = reconciler.Finalize(ctx, handler.mongodbStore, transaction, models.TransactionStatus(resp.Status), "", 0, "")
+		}
+
+		if err != nil {
+			logging.FromContext(ctx).Error("error updating payment status", "reference", reference, "error", err)
+			handler.errorWriter(w, err)
+			return
+		}
+	}
+
+	handler.responseWriter(w, transaction)
+}
@@ -3,27 +3,52 @@ package server
 import (
 	"bytes"
 	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/database/databasetest"
 	"consumer-payment-service/environment"
 	"consumer-payment-service/mocks"
 	"consumer-payment-service/models"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 )
 
+// newRouteRequest returns a request routed with the URL parameter param set to value
+func newRouteRequest(method, target, param, value, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add(param, value)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+}
+
 func Test_HttpHandler_PaymentCredit(t *testing.T) {
 	const (
 		success = iota
 		errorGettingUser
 		errorGettingAccount
+		errorAccountNotOwned
 		errorMakingDeposit
 		errorCreatingTransaction
 		errorUpdatingAccountBalance
+		replayedRequest
+		replayedFailedRequest
+		replayedDeclinedRequest
+		replayedInsufficientFundsRequest
+		replayedCircuitOpenRequest
+		errorIdempotencyConflict
+		errorDuplicateReference
+		errorCurrencyMismatch
+		errorAccountClosed
+		errorAccountClosedConcurrently
 	)
 
 	testCases := []struct {
@@ -45,6 +70,11 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 			testType: errorGettingAccount,
 		},
 
+		{
+			name:     "Test error account belongs to another user",
+			testType: errorAccountNotOwned,
+		},
+
 		{
 			name:     "Test error making deposit on third party service",
 			testType: errorMakingDeposit,
@@ -59,6 +89,56 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 			name:     "Test error while updating account balance",
 			testType: errorUpdatingAccountBalance,
 		},
+
+		{
+			name:     "Test replayed request returns original outcome",
+			testType: replayedRequest,
+		},
+
+		{
+			name:     "Test replayed request for a payment reported failed by the provider returns the provider reason",
+			testType: replayedFailedRequest,
+		},
+
+		{
+			name:     "Test replayed request for a declined payment returns the decline",
+			testType: replayedDeclinedRequest,
+		},
+
+		{
+			name:     "Test replayed request for a payment refused for the error code the provider sent returns the same refusal",
+			testType: replayedInsufficientFundsRequest,
+		},
+
+		{
+			name:     "Test replayed request for a payment failed on an open circuit returns provider unavailable",
+			testType: replayedCircuitOpenRequest,
+		},
+
+		{
+			name:     "Test error reference reused with a different payload",
+			testType: errorIdempotencyConflict,
+		},
+
+		{
+			name:     "Test error duplicate reference while creating transaction record",
+			testType: errorDuplicateReference,
+		},
+
+		{
+			name:     "Test error amount currency differs from account currency",
+			testType: errorCurrencyMismatch,
+		},
+
+		{
+			name:     "Test error account closed",
+			testType: errorAccountClosed,
+		},
+
+		{
+			name:     "Test error account closed while the credit is being recorded",
+			testType: errorAccountClosedConcurrently,
+		},
 	}
 
 	controller := gomock.NewController(t)
@@ -79,7 +159,7 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 				UserId:    "usr-001",
 				AccountId: "acc_001",
 				Reference: "ref-001",
-				Amount:    10,
+				Amount:    models.NewMoney(1000, "NGN"),
 			}
 			mockPayload, err := json.Marshal(mockRequest)
 			assert.NoError(t, err)
@@ -88,7 +168,7 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 			case success:
 				mockAccount := models.Account{
 					AccountID: mockRequest.AccountId,
-					Balance:   1,
+					Balance:   models.NewMoney(100, "NGN"),
 				}
 
 				w := httptest.NewRecorder()
@@ -96,33 +176,58 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
 					Return(&mockAccount, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					LockAccount(gomock.Any(), mockRequest.AccountId).
+					Return(&models.Account{AccountID: mockRequest.AccountId, Status: models.ACTIVE}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(nil)
+
 				mockThirdPartyClient.
 					EXPECT().
-					MakeDeposit(mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
+					MakeDeposit(gomock.Any(), mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
 					Return(&client.PaymentResponse{
 						AccountId: mockRequest.AccountId,
 						Reference: mockRequest.Reference,
-						Amount:    mockRequest.Amount,
+						Amount:    json.Number(mockRequest.Amount.Decimal()),
 					}, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
 				mockDataStore.
 					EXPECT().
-					CreateTransaction(gomock.Any()).
+					UpdateTransactionStatus(gomock.Any(), mockRequest.Reference, models.SUCCESS).
 					Return(nil)
 
-				newBalance := mockAccount.Balance + mockRequest.Amount
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount).
+					Return(&mockAccount, nil)
 
-				mockDataStore.EXPECT().UpdateAccountBalance(mockRequest.AccountId, newBalance).Return(nil)
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
 
 				handler.PaymentCreditHandler(w, r)
 				assert.Equal(t, http.StatusOK, w.Code)
@@ -133,11 +238,44 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
-					Return(nil, errors.New("not found"))
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(nil, database.ErrUserNotFound)
 
 				handler.PaymentCreditHandler(w, r)
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorAccountNotOwned:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/credit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{
+						Id: mockRequest.UserId,
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(nil, database.ErrAccountNotOwned)
+
+				handler.PaymentCreditHandler(w, r)
+				assert.Equal(t, http.StatusForbidden, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeAccountForbidden, response.Code)
 
 			case errorGettingAccount:
 				w := httptest.NewRecorder()
@@ -145,18 +283,23 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
-					Return(nil, errors.New("not found"))
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(nil, database.ErrAccountNotFound)
 
 				handler.PaymentCreditHandler(w, r)
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
+				assert.Equal(t, http.StatusNotFound, w.Code)
 
 			case errorMakingDeposit:
 
@@ -165,31 +308,53 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
 					Return(&models.Account{
 						AccountID: mockRequest.AccountId,
-						Balance:   1,
+						Balance:   models.NewMoney(100, "NGN"),
 					}, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					LockAccount(gomock.Any(), mockRequest.AccountId).
+					Return(&models.Account{AccountID: mockRequest.AccountId, Status: models.ACTIVE}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(nil)
+
 				mockThirdPartyClient.
 					EXPECT().
-					MakeDeposit(mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
-					Return(nil, errors.New(""))
+					MakeDeposit(gomock.Any(), mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
+					Return(nil, &client.ProviderError{StatusCode: http.StatusNotFound, Message: "account not found", Kind: client.ProviderErrorInvalidAccount})
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), mockRequest.Reference, "account not found", http.StatusNotFound, string(client.ProviderErrorInvalidAccount)).
+					Return(nil)
 
 				handler.PaymentCreditHandler(w, r)
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 
 			case errorCreatingTransaction:
 				mockAccount := models.Account{
 					AccountID: mockRequest.AccountId,
-					Balance:   1,
+					Balance:   models.NewMoney(100, "NGN"),
 				}
 
 				w := httptest.NewRecorder()
@@ -197,38 +362,41 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
 					Return(&mockAccount, nil)
 
-				mockThirdPartyClient.
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
 					EXPECT().
-					MakeDeposit(mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
-					Return(&client.PaymentResponse{
-						AccountId: mockRequest.AccountId,
-						Reference: mockRequest.Reference,
-						Amount:    mockRequest.Amount,
-					}, nil)
+					LockAccount(gomock.Any(), mockRequest.AccountId).
+					Return(&models.Account{AccountID: mockRequest.AccountId, Status: models.ACTIVE}, nil)
 
 				mockDataStore.
 					EXPECT().
-					CreateTransaction(gomock.Any()).
+					CreateTransaction(gomock.Any(), gomock.Any()).
 					Return(errors.New(""))
 
 				handler.PaymentCreditHandler(w, r)
-				assert.Equal(t, http.StatusNotFound, w.Code)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
 
 			case errorUpdatingAccountBalance:
 
 				mockAccount := models.Account{
 					AccountID: mockRequest.AccountId,
-					Balance:   1,
+					Balance:   models.NewMoney(100, "NGN"),
 				}
 
 				w := httptest.NewRecorder()
@@ -236,39 +404,268 @@ func Test_HttpHandler_PaymentCredit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
 					Return(&mockAccount, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					LockAccount(gomock.Any(), mockRequest.AccountId).
+					Return(&models.Account{AccountID: mockRequest.AccountId, Status: models.ACTIVE}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(nil)
+
 				mockThirdPartyClient.
 					EXPECT().
-					MakeDeposit(mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
+					MakeDeposit(gomock.Any(), mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
 					Return(&client.PaymentResponse{
 						AccountId: mockRequest.AccountId,
 						Reference: mockRequest.Reference,
-						Amount:    mockRequest.Amount,
+						Amount:    json.Number(mockRequest.Amount.Decimal()),
 					}, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
 				mockDataStore.
 					EXPECT().
-					CreateTransaction(gomock.Any()).
+					UpdateTransactionStatus(gomock.Any(), mockRequest.Reference, models.SUCCESS).
 					Return(nil)
 
-				newBalance := mockAccount.Balance + mockRequest.Amount
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount).
+					Return(nil, errors.New(""))
+
+				handler.PaymentCreditHandler(w, r)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+			case replayedRequest:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/credit", bytes.NewBuffer(mockPayload))
 
 				mockDataStore.
 					EXPECT().
-					UpdateAccountBalance(mockRequest.AccountId, newBalance).
-					Return(errors.New(""))
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(&models.Transaction{
+						Reference:      mockRequest.Reference,
+						Status:         models.SUCCESS,
+						IdempotencyKey: mockRequest.Reference,
+						RequestHash:    requestHash(models.CREDIT, mockRequest),
+					}, nil)
 
 				handler.PaymentCreditHandler(w, r)
-				assert.Equal(t, http.StatusNotFound, w.Code)
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+
+			case replayedFailedRequest, replayedDeclinedRequest, replayedInsufficientFundsRequest, replayedCircuitOpenRequest:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/credit", bytes.NewBuffer(mockPayload))
+
+				failed := &models.Transaction{
+					Reference:      mockRequest.Reference,
+					Status:         models.FAILED,
+					FailureReason:  "transaction failed",
+					IdempotencyKey: mockRequest.Reference,
+					RequestHash:    requestHash(models.CREDIT, mockRequest),
+				}
+				expectedStatus, expectedCode := http.StatusBadGateway, models.ErrorCodePaymentFailed
+
+				switch testCase.testType {
+				case replayedDeclinedRequest:
+					failed.FailureReason = "card declined"
+					failed.ProviderStatusCode = http.StatusPaymentRequired
+					failed.FailureKind = string(client.ProviderErrorDeclined)
+					expectedStatus, expectedCode = http.StatusPaymentRequired, models.ErrorCodePaymentDeclined
+				case replayedInsufficientFundsRequest:
+					// the provider answered 400 with an insufficient_funds error code, the status alone reads as a decline
+					failed.FailureReason = "not enough funds"
+					failed.ProviderStatusCode = http.StatusBadRequest
+					failed.FailureKind = string(client.ProviderErrorInsufficientFunds)
+					expectedStatus, expectedCode = http.StatusUnprocessableEntity, models.ErrorCodeInsufficientFunds
+				case replayedCircuitOpenRequest:
+					failed.FailureReason = client.ErrCircuitOpen.Error()
+					failed.FailureKind = circuitOpenFailure
+					expectedStatus, expectedCode = http.StatusServiceUnavailable, models.ErrorCodeProviderUnavailable
+				}
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(failed, nil)
+
+				handler.PaymentCreditHandler(w, r)
+				assert.Equal(t, expectedStatus, w.Code)
+				assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, expectedCode, response.Code)
+				if testCase.testType == replayedFailedRequest {
+					assert.Contains(t, response.ErrorMessage, "transaction failed")
+				}
+
+			case errorIdempotencyConflict:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/credit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(&models.Transaction{
+						Reference:      mockRequest.Reference,
+						Status:         models.SUCCESS,
+						IdempotencyKey: mockRequest.Reference,
+						RequestHash:    requestHash(models.DEBIT, mockRequest),
+					}, nil)
+
+				handler.PaymentCreditHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case errorDuplicateReference:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/credit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{
+						Id: mockRequest.UserId,
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&models.Account{
+						AccountID: mockRequest.AccountId,
+						Balance:   models.NewMoney(100, "NGN"),
+					}, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					LockAccount(gomock.Any(), mockRequest.AccountId).
+					Return(&models.Account{AccountID: mockRequest.AccountId, Status: models.ACTIVE}, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(database.ErrDuplicateReference)
+
+				handler.PaymentCreditHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case errorCurrencyMismatch:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/credit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{
+						Id: mockRequest.UserId,
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&models.Account{
+						AccountID: mockRequest.AccountId,
+						Balance:   models.NewMoney(100, "USD"),
+					}, nil)
+
+				handler.PaymentCreditHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+			case errorAccountClosed:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/credit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{
+						Id: mockRequest.UserId,
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&models.Account{
+						AccountID: mockRequest.AccountId,
+						Balance:   models.NewMoney(0, "NGN"),
+						Status:    models.CLOSED,
+					}, nil)
+
+				handler.PaymentCreditHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case errorAccountClosedConcurrently:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/credit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{
+						Id: mockRequest.UserId,
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&models.Account{
+						AccountID: mockRequest.AccountId,
+						Balance:   models.NewMoney(0, "NGN"),
+						Status:    models.ACTIVE,
+					}, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				// closed after it was read, no credit is recorded and the provider is not called
+				mockDataStore.
+					EXPECT().
+					LockAccount(gomock.Any(), mockRequest.AccountId).
+					Return(nil, database.ErrAccountClosed)
+
+				handler.PaymentCreditHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
 			}
 		})
 	}
@@ -280,11 +677,18 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 		success = iota
 		errorGettingUser
 		errorGettingAccount
+		errorAccountNotOwned
 		errorInsufficientBalance
 		errorMakingWithdrawal
+		errorWithdrawalTimeout
 		errorCreatingTransaction
 		errorUpdatingAccountBalance
 		errorMarshalResponse
+		replayedRequestWithIdempotencyKey
+		errorIdempotencyKeyConflict
+		errorDuplicateReference
+		errorCompletingDebit
+		errorLimitExceeded
 	)
 
 	testCases := []struct {
@@ -306,6 +710,11 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 			testType: errorGettingAccount,
 		},
 
+		{
+			name:     "Test error account belongs to another user",
+			testType: errorAccountNotOwned,
+		},
+
 		{
 			name:     "Test error insufficient balance",
 			testType: errorInsufficientBalance,
@@ -317,10 +726,15 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 		},
 
 		{
-			name:     "Test error making withdrawal on third party service",
+			name:     "Test error making withdrawal on third party service leaves the debit pending",
 			testType: errorMakingWithdrawal,
 		},
 
+		{
+			name:     "Test withdrawal timing out on third party service leaves the debit pending",
+			testType: errorWithdrawalTimeout,
+		},
+
 		{
 			name:     "Test error creating transaction record",
 			testType: errorCreatingTransaction,
@@ -330,13 +744,42 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 			name:     "Test error while updating account balance",
 			testType: errorUpdatingAccountBalance,
 		},
-	}
 
-	controller := gomock.NewController(t)
-	defer controller.Finish()
+		{
+			name:     "Test replayed request with idempotency key returns original outcome",
+			testType: replayedRequestWithIdempotencyKey,
+		},
+
+		{
+			name:     "Test error idempotency key reused with a different payload",
+			testType: errorIdempotencyKeyConflict,
+		},
+
+		{
+			name:     "Test error duplicate reference",
+			testType: errorDuplicateReference,
+		},
+
+		{
+			name:     "Test error completing debit after withdrawal",
+			testType: errorCompletingDebit,
+		},
 
+		{
+			name:     "Test error debit over the daily spending limit of the user tier",
+			testType: errorLimitExceeded,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	dailyLimit := models.NewMoney(1000, "NGN")
 	cfg := &environment.Config{
 		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+		SpendingLimitTiers: map[string]map[string]models.SpendingLimits{
+			"capped": {"NGN": {Daily: &dailyLimit}},
+		},
 	}
 
 	mockDataStore := mocks.NewMockMongoDBStore(controller)
@@ -351,7 +794,7 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 				UserId:    "usr-001",
 				AccountId: "acc_001",
 				Reference: "ref-001",
-				Amount:    1.50,
+				Amount:    models.NewMoney(150, "NGN"),
 			}
 			mockPayload, err := json.Marshal(mockRequest)
 			assert.NoError(t, err)
@@ -360,7 +803,7 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 			case success:
 				mockAccount := models.Account{
 					AccountID: mockRequest.AccountId,
-					Balance:   10,
+					Balance:   models.NewMoney(1000, "NGN"),
 				}
 
 				w := httptest.NewRecorder()
@@ -368,34 +811,52 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount.Negate()).
 					Return(&mockAccount, nil)
 
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(nil)
+
 				mockThirdPartyClient.
 					EXPECT().
-					MakeWithdrawal(mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
+					MakeWithdrawal(gomock.Any(), mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
 					Return(&client.PaymentResponse{
 						AccountId: mockRequest.AccountId,
 						Reference: mockRequest.Reference,
-						Amount:    mockRequest.Amount,
+						Amount:    json.Number(mockRequest.Amount.Decimal()),
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					CreateTransaction(gomock.Any()).
+					UpdateTransactionStatus(gomock.Any(), mockRequest.Reference, models.SUCCESS).
 					Return(nil)
 
-				newBalance := mockAccount.Balance - mockRequest.Amount
-
-				mockDataStore.EXPECT().UpdateAccountBalance(mockRequest.AccountId, newBalance).Return(nil)
-
 				handler.PaymentDebitHandler(w, r)
 				assert.Equal(t, http.StatusOK, w.Code)
 
@@ -405,11 +866,44 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
-					Return(nil, errors.New(""))
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(nil, database.ErrUserNotFound)
 
 				handler.PaymentDebitHandler(w, r)
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorAccountNotOwned:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/debit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{
+						Id: mockRequest.UserId,
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(nil, database.ErrAccountNotOwned)
+
+				handler.PaymentDebitHandler(w, r)
+				assert.Equal(t, http.StatusForbidden, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeAccountForbidden, response.Code)
 
 			case errorGettingAccount:
 				w := httptest.NewRecorder()
@@ -417,18 +911,23 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
-					Return(nil, errors.New(""))
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(nil, database.ErrAccountNotFound)
 
 				handler.PaymentDebitHandler(w, r)
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
+				assert.Equal(t, http.StatusNotFound, w.Code)
 
 			case errorInsufficientBalance:
 
@@ -437,21 +936,33 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
 					Return(&models.Account{
 						AccountID: mockRequest.AccountId,
-						Balance:   0.50,
+						Balance:   models.NewMoney(50, "NGN"),
 					}, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount.Negate()).
+					Return(nil, database.ErrInsufficientFunds)
+
 				handler.PaymentDebitHandler(w, r)
-				assert.Equal(t, http.StatusInternalServerError, w.Code)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 
 			case errorMarshalResponse:
 				w := httptest.NewRecorder()
@@ -461,10 +972,15 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 				handler.responseWriter(w, input)
 				assert.Equal(t, http.StatusBadRequest, w.Code)
 
-			case errorMakingWithdrawal:
+			case errorMakingWithdrawal, errorWithdrawalTimeout:
+				providerErr := errors.New("connection reset by peer")
+				if testCase.testType == errorWithdrawalTimeout {
+					providerErr = &url.Error{Op: "Post", URL: "http://example.domain.com/third-party/withdrawals", Err: context.DeadlineExceeded}
+				}
+
 				mockAccount := models.Account{
 					AccountID: mockRequest.AccountId,
-					Balance:   10,
+					Balance:   models.NewMoney(1000, "NGN"),
 				}
 
 				w := httptest.NewRecorder()
@@ -472,28 +988,134 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount.Negate()).
 					Return(&mockAccount, nil)
 
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(nil)
+
 				mockThirdPartyClient.
 					EXPECT().
-					MakeWithdrawal(mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
+					MakeWithdrawal(gomock.Any(), mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
+					Return(nil, providerErr)
+
+				// the provider may have paid out, so the reservation is neither released nor the debit failed
+				handler.PaymentDebitHandler(w, r)
+				assert.Equal(t, http.StatusBadGateway, w.Code)
+
+			case errorCreatingTransaction:
+				mockAccount := models.Account{
+					AccountID: mockRequest.AccountId,
+					Balance:   models.NewMoney(1000, "NGN"),
+				}
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/debit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{
+						Id: mockRequest.UserId,
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount.Negate()).
+					Return(&mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(errors.New(""))
+
+				handler.PaymentDebitHandler(w, r)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+			case errorUpdatingAccountBalance:
+				mockAccount := models.Account{
+					AccountID: mockRequest.AccountId,
+					Balance:   models.NewMoney(1000, "NGN"),
+				}
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/debit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{
+						Id: mockRequest.UserId,
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount.Negate()).
 					Return(nil, errors.New(""))
 
 				handler.PaymentDebitHandler(w, r)
 				assert.Equal(t, http.StatusInternalServerError, w.Code)
 
-			case errorCreatingTransaction:
+			case errorLimitExceeded:
 				mockAccount := models.Account{
 					AccountID: mockRequest.AccountId,
-					Balance:   10,
+					UserID:    mockRequest.UserId,
+					Balance:   models.NewMoney(5000, "NGN"),
 				}
 
 				w := httptest.NewRecorder()
@@ -501,37 +1123,156 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{Id: mockRequest.UserId, Tier: "capped"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
+					Return(&mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				// the tier limits cap the debits of every account of the user
+				mockDataStore.
+					EXPECT().
+					LockUser(gomock.Any(), mockRequest.UserId).
+					Return(&models.User{Id: mockRequest.UserId, Tier: "capped"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserDebitTotals(gomock.Any(), mockRequest.UserId, "NGN", gomock.Any(), gomock.Any()).
+					Return(&models.DebitTotals{Daily: 900, DailyCount: 3, Monthly: 900}, nil)
+
+				handler.PaymentDebitHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeLimitExceeded, response.Code)
+
+				remaining := models.NewMoney(100, "NGN")
+				assert.Equal(t, &models.LimitExceeded{Limit: models.LimitDaily, RemainingAmount: &remaining}, response.Limit)
+
+			case errorCompletingDebit:
+				mockAccount := models.Account{
+					AccountID: mockRequest.AccountId,
+					Balance:   models.NewMoney(1000, "NGN"),
+				}
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/debit", bytes.NewBuffer(mockPayload))
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
 					Return(&mockAccount, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount.Negate()).
+					Return(&mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(nil)
+
 				mockThirdPartyClient.
 					EXPECT().
-					MakeWithdrawal(mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
+					MakeWithdrawal(gomock.Any(), mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
 					Return(&client.PaymentResponse{
 						AccountId: mockRequest.AccountId,
 						Reference: mockRequest.Reference,
-						Amount:    mockRequest.Amount,
+						Amount:    json.Number(mockRequest.Amount.Decimal()),
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					CreateTransaction(gomock.Any()).
+					UpdateTransactionStatus(gomock.Any(), mockRequest.Reference, models.SUCCESS).
 					Return(errors.New(""))
 
 				handler.PaymentDebitHandler(w, r)
 				assert.Equal(t, http.StatusInternalServerError, w.Code)
 
-			case errorUpdatingAccountBalance:
+			case replayedRequestWithIdempotencyKey:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/debit", bytes.NewBuffer(mockPayload))
+				r.Header.Set(IdempotencyKeyHeader, "idem-key-001")
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetTransactionByIdempotencyKey(gomock.Any(), "idem-key-001").
+					Return(&models.Transaction{
+						Reference:      mockRequest.Reference,
+						Status:         models.SUCCESS,
+						IdempotencyKey: "idem-key-001",
+						RequestHash:    requestHash(models.DEBIT, mockRequest),
+					}, nil)
+
+				handler.PaymentDebitHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+
+			case errorIdempotencyKeyConflict:
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/payments/debit", bytes.NewBuffer(mockPayload))
+				r.Header.Set(IdempotencyKeyHeader, "idem-key-001")
+
+				changedRequest := mockRequest
+				changedRequest.Amount = models.NewMoney(10000, "NGN")
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetTransactionByIdempotencyKey(gomock.Any(), "idem-key-001").
+					Return(&models.Transaction{
+						Reference:      mockRequest.Reference,
+						Status:         models.SUCCESS,
+						IdempotencyKey: "idem-key-001",
+						RequestHash:    requestHash(models.DEBIT, changedRequest),
+					}, nil)
+
+				handler.PaymentDebitHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case errorDuplicateReference:
 				mockAccount := models.Account{
 					AccountID: mockRequest.AccountId,
-					Balance:   10,
+					Balance:   models.NewMoney(1000, "NGN"),
 				}
 
 				w := httptest.NewRecorder()
@@ -539,39 +1280,392 @@ func Test_HttpHandler_PaymentDebit(t *testing.T) {
 
 				mockDataStore.
 					EXPECT().
-					GetUserById(mockRequest.UserId).
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
 					Return(&models.User{
 						Id: mockRequest.UserId,
 					}, nil)
 
 				mockDataStore.
 					EXPECT().
-					GetAccountByID(mockRequest.AccountId).
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.AccountId).
 					Return(&mockAccount, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockRequest.AccountId, mockRequest.Amount.Negate()).
+					Return(&mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(database.ErrDuplicateReference)
+
+				handler.PaymentDebitHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+			}
+		})
+	}
+}
+
+func Test_HttpHandler_PaymentValidation(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedCode   int
+		expectedFields []models.FieldError
+	}{
+		{
+			name:         "Test error malformed body",
+			body:         `{"user_id":`,
+			expectedCode: http.StatusBadRequest,
+		},
+
+		{
+			name:         "Test error missing fields and zero amount",
+			body:         `{"amount":{"amount":"0","currency":"NGN"}}`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedFields: []models.FieldError{
+				{Field: "user_id", Reason: "is required"},
+				{Field: "account_id", Reason: "is required"},
+				{Field: "reference", Reason: "is required"},
+				{Field: "amount", Reason: "must be greater than zero"},
+			},
+		},
+
+		{
+			name:         "Test error negative amount",
+			body:         `{"user_id":"usr-001","account_id":"acc_001","reference":"ref-001","amount":{"amount":"-1.00","currency":"NGN"}}`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedFields: []models.FieldError{
+				{Field: "amount", Reason: "must be greater than zero"},
+			},
+		},
+
+		{
+			name:         "Test error amount with too many decimal places",
+			body:         `{"user_id":"usr-001","account_id":"acc_001","reference":"ref-001","amount":{"amount":"1.001","currency":"NGN"}}`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedFields: []models.FieldError{
+				{Field: "amount", Reason: models.ErrInvalidAmount.Error()},
+			},
+		},
+
+		{
+			name:         "Test error missing amount",
+			body:         `{"user_id":"usr-001","account_id":"acc_001","reference":"ref-001"}`,
+			expectedCode: http.StatusUnprocessableEntity,
+			expectedFields: []models.FieldError{
+				{Field: "amount", Reason: "must be greater than zero"},
+				{Field: "amount.currency", Reason: models.ErrInvalidCurrency.Error()},
+			},
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+	}
+
+	// nothing may reach the store or the third party service
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
+
+	handler := NewHTTPHandler(cfg, mockDataStore, mockThirdPartyClient)
+
+	handlers := map[string]http.HandlerFunc{
+		"/payments/credit": handler.PaymentCreditHandler,
+		"/payments/debit":  handler.PaymentDebitHandler,
+	}
+
+	for _, testCase := range testCases {
+		for path, handlerFunc := range handlers {
+			t.Run(testCase.name+" "+path, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(testCase.body))
+
+				handlerFunc(w, r)
+				assert.Equal(t, testCase.expectedCode, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, testCase.expectedFields, response.Fields)
+				if testCase.expectedCode == http.StatusUnprocessableEntity {
+					assert.Equal(t, models.ErrorCodeValidationFailed, response.Code)
+				}
+			})
+		}
+	}
+}
+
+func Test_HttpHandler_GetPayment(t *testing.T) {
+	const (
+		success = iota
+		successWithRefresh
+		errorPaymentNotFound
+		errorGettingPayment
+		errorRetrievingPayment
+		errorUpdatingPaymentStatus
+		refreshFinalizedPayment
+		refreshPaymentUnknownAtProvider
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			testType: success,
+		},
+
+		{
+			name:     "Test success refreshing status from third party service",
+			testType: successWithRefresh,
+		},
+
+		{
+			name:     "Test error payment not found",
+			testType: errorPaymentNotFound,
+		},
+
+		{
+			name:     "Test error fetching payment",
+			testType: errorGettingPayment,
+		},
+
+		{
+			name:     "Test error retrieving payment on third party service",
+			testType: errorRetrievingPayment,
+		},
+
+		{
+			name:     "Test error updating payment status",
+			testType: errorUpdatingPaymentStatus,
+		},
+
+		{
+			name:     "Test refreshing a finalized payment does not call third party service",
+			testType: refreshFinalizedPayment,
+		},
+
+		{
+			name:     "Test refreshing a payment the provider never received fails it",
+			testType: refreshPaymentUnknownAtProvider,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+	}
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
+
+	handler := NewHTTPHandler(cfg, mockDataStore, mockThirdPartyClient)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			mockTransaction := models.Transaction{
+				Reference: "ref-001",
+				UserID:    "usr-001",
+				AccountID: "acc_001",
+				Amount:    models.NewMoney(1000, "NGN"),
+				Type:      models.CREDIT,
+				Status:    models.SUCCESS,
+			}
+
+			switch testCase.testType {
+			case success:
+				w := httptest.NewRecorder()
+				r := newRouteRequest(http.MethodGet, "/payments/ref-001", "reference", mockTransaction.Reference, "")
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockTransaction.Reference).
+					Return(&mockTransaction, nil)
+
+				handler.GetPaymentHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var transaction models.Transaction
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &transaction))
+				assert.Equal(t, mockTransaction, transaction)
+
+			case successWithRefresh:
+				w := httptest.NewRecorder()
+				r := newRouteRequest(http.MethodGet, "/payments/ref-001?refresh=true", "reference", mockTransaction.Reference, "")
+
+				mockTransaction.Status = models.PENDING
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockTransaction.Reference).
+					Return(&mockTransaction, nil)
+
 				mockThirdPartyClient.
 					EXPECT().
-					MakeWithdrawal(mockRequest.AccountId, mockRequest.Reference, mockRequest.Amount).
+					RetrieveTransaction(gomock.Any(), mockTransaction.Reference).
 					Return(&client.PaymentResponse{
-						AccountId: mockRequest.AccountId,
-						Reference: mockRequest.Reference,
-						Amount:    mockRequest.Amount,
+						AccountId: mockTransaction.AccountID,
+						Reference: mockTransaction.Reference,
+						Amount:    json.Number(mockTransaction.Amount.Decimal()),
+						Status:    string(models.SUCCESS),
 					}, nil)
 
+				databasetest.ExpectWithTx(mockDataStore)
+
 				mockDataStore.
 					EXPECT().
-					CreateTransaction(gomock.Any()).
+					UpdateTransactionStatus(gomock.Any(), mockTransaction.Reference, models.SUCCESS).
 					Return(nil)
 
-				newBalance := mockAccount.Balance - mockRequest.Amount
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), mockTransaction.AccountID, mockTransaction.Amount).
+					Return(&models.Account{AccountID: mockTransaction.AccountID}, nil)
 
 				mockDataStore.
 					EXPECT().
-					UpdateAccountBalance(mockRequest.AccountId, newBalance).
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				handler.GetPaymentHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var transaction models.Transaction
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &transaction))
+				assert.Equal(t, models.SUCCESS, transaction.Status)
+
+			case errorPaymentNotFound:
+				w := httptest.NewRecorder()
+				r := newRouteRequest(http.MethodGet, "/payments/invalid-ref", "reference", "invalid-ref", "")
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "invalid-ref").
+					Return(nil, database.ErrTransactionNotFound)
+
+				handler.GetPaymentHandler(w, r)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorGettingPayment:
+				w := httptest.NewRecorder()
+				r := newRouteRequest(http.MethodGet, "/payments/ref-001", "reference", mockTransaction.Reference, "")
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockTransaction.Reference).
+					Return(nil, errors.New(""))
+
+				handler.GetPaymentHandler(w, r)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+			case errorRetrievingPayment:
+				w := httptest.NewRecorder()
+				r := newRouteRequest(http.MethodGet, "/payments/ref-001?refresh=true", "reference", mockTransaction.Reference, "")
+				mockTransaction.Status = models.PENDING
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockTransaction.Reference).
+					Return(&mockTransaction, nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					RetrieveTransaction(gomock.Any(), mockTransaction.Reference).
+					Return(nil, errors.New(""))
+
+				handler.GetPaymentHandler(w, r)
+				assert.Equal(t, http.StatusBadGateway, w.Code)
+
+			case errorUpdatingPaymentStatus:
+				w := httptest.NewRecorder()
+				r := newRouteRequest(http.MethodGet, "/payments/ref-001?refresh=true", "reference", mockTransaction.Reference, "")
+				mockTransaction.Status = models.PENDING
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockTransaction.Reference).
+					Return(&mockTransaction, nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					RetrieveTransaction(gomock.Any(), mockTransaction.Reference).
+					Return(&client.PaymentResponse{
+						AccountId: mockTransaction.AccountID,
+						Reference: mockTransaction.Reference,
+						Amount:    json.Number(mockTransaction.Amount.Decimal()),
+						Status:    string(models.FAILED),
+					}, nil)
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), mockTransaction.Reference, gomock.Any(), 0, "").
 					Return(errors.New(""))
 
-				handler.PaymentDebitHandler(w, r)
+				handler.GetPaymentHandler(w, r)
 				assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+			case refreshFinalizedPayment:
+				w := httptest.NewRecorder()
+				r := newRouteRequest(http.MethodGet, "/payments/ref-001?refresh=true", "reference", mockTransaction.Reference, "")
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockTransaction.Reference).
+					Return(&mockTransaction, nil)
+
+				handler.GetPaymentHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var transaction models.Transaction
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &transaction))
+				assert.Equal(t, models.SUCCESS, transaction.Status)
+
+			case refreshPaymentUnknownAtProvider:
+				w := httptest.NewRecorder()
+				r := newRouteRequest(http.MethodGet, "/payments/ref-001?refresh=true", "reference", mockTransaction.Reference, "")
+				mockTransaction.Status = models.PENDING
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockTransaction.Reference).
+					Return(&mockTransaction, nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					RetrieveTransaction(gomock.Any(), mockTransaction.Reference).
+					Return(nil, &client.ProviderError{StatusCode: http.StatusNotFound, Message: "transaction not found", Kind: client.ProviderErrorPaymentNotFound})
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), mockTransaction.Reference, "transaction not found", http.StatusNotFound, "").
+					Return(nil)
+
+				handler.GetPaymentHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var transaction models.Transaction
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &transaction))
+				assert.Equal(t, models.FAILED, transaction.Status)
+				assert.Equal(t, "transaction not found", transaction.FailureReason)
 			}
 		})
 	}
@@ -2,10 +2,15 @@ package server
 
 import (
 	"consumer-payment-service/environment"
+	"consumer-payment-service/metrics"
 	"consumer-payment-service/mocks"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace/noop"
 	"go.uber.org/mock/gomock"
 )
 
@@ -20,7 +25,14 @@ func TestHttpMount(t *testing.T) {
 	mockDataStore := mocks.NewMockMongoDBStore(controller)
 	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
 
-	router := MountServer(cfg, mockDataStore, mockThirdPartyClient)
+	healthHandler := NewHealthHandler(cfg, mockDataStore, mockThirdPartyClient)
+	router := MountServer(cfg, mockDataStore, mockThirdPartyClient, healthHandler, metrics.New(), noop.NewTracerProvider())
 	assert.NotNil(t, router)
 
+	// changing spending limits is refused without the admin token, before reaching the store
+	for _, target := range []string{"/users/usr-001/tier", "/accounts/acc_001/limits"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, target, strings.NewReader(`{}`)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
 }
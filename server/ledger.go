@@ -0,0 +1,30 @@
+package server
+
+import (
+	"consumer-payment-service/ledger"
+	"consumer-payment-service/logging"
+	"net/http"
+)
+
+// VerifyLedgerHandler recomputes every account balance from the ledger and reports the accounts that drifted
+// from it, each of them is also logged
+func (handler *HttpHandler) VerifyLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	report, err := ledger.Verify(ctx, handler.mongodbStore)
+	if err != nil {
+		logging.FromContext(ctx).Error("error verifying ledger", "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	for _, drift := range report.Drift {
+		logging.FromContext(ctx).Warn("account balance drifted from ledger",
+			"account_id", drift.AccountID, "cached", drift.Cached.String(), "derived", drift.Derived.String())
+	}
+	for _, total := range report.Unbalanced {
+		logging.FromContext(ctx).Warn("ledger does not balance", "total", total.String())
+	}
+
+	handler.responseWriter(w, report)
+}
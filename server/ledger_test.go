@@ -0,0 +1,117 @@
+package server
+
+import (
+	"consumer-payment-service/database/databasetest"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_HttpHandler_VerifyLedger(t *testing.T) {
+	const (
+		success = iota
+		balanceDrifted
+		errorGettingBalances
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			testType: success,
+		},
+
+		{
+			name:     "Test balance drifted from the ledger",
+			testType: balanceDrifted,
+		},
+
+		{
+			name:     "Test error getting ledger balances",
+			testType: errorGettingBalances,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	handler := NewHTTPHandler(&environment.Config{}, mockDataStore, mocks.NewMockThirdPartyAPIClient(controller))
+
+	mockBalances := []models.LedgerBalance{
+		{AccountID: "acc_001", Balance: models.NewMoney(1000, "NGN")},
+		{AccountID: models.ProviderClearingAccount, Balance: models.NewMoney(-1000, "NGN")},
+	}
+	mockEntries := []models.JournalEntry{
+		{
+			EntryID: "jrn_001",
+			Postings: []models.Posting{
+				{AccountID: "acc_001", Amount: models.NewMoney(1000, "NGN")},
+				{AccountID: models.ProviderClearingAccount, Amount: models.NewMoney(-1000, "NGN")},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/ledger/verify", nil)
+
+			databasetest.ExpectWithTx(mockDataStore)
+
+			switch testCase.testType {
+			case success:
+				mockDataStore.
+					EXPECT().
+					GetAccounts(gomock.Any(), "", gomock.Any()).
+					Return([]models.Account{{AccountID: "acc_001", Balance: models.NewMoney(1000, "NGN")}}, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(mockBalances, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "", gomock.Any()).Return(mockEntries, nil)
+
+				handler.VerifyLedgerHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var report models.LedgerReport
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+				assert.True(t, report.OK)
+				assert.Equal(t, 1, report.CheckedAccounts)
+				assert.Empty(t, report.Drift)
+
+			case balanceDrifted:
+				mockDataStore.
+					EXPECT().
+					GetAccounts(gomock.Any(), "", gomock.Any()).
+					Return([]models.Account{{AccountID: "acc_001", Balance: models.NewMoney(1500, "NGN")}}, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(mockBalances, nil)
+				mockDataStore.EXPECT().GetJournalEntries(gomock.Any(), "", gomock.Any()).Return(mockEntries, nil)
+
+				handler.VerifyLedgerHandler(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				var report models.LedgerReport
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+				assert.False(t, report.OK)
+				assert.Equal(t, []models.BalanceDrift{
+					{AccountID: "acc_001", Cached: models.NewMoney(1500, "NGN"), Derived: models.NewMoney(1000, "NGN")},
+				}, report.Drift)
+
+			case errorGettingBalances:
+				mockDataStore.EXPECT().GetAccounts(gomock.Any(), "", gomock.Any()).Return([]models.Account{}, nil)
+				mockDataStore.EXPECT().GetLedgerBalances(gomock.Any(), "", "").Return(nil, errors.New("connection reset"))
+
+				handler.VerifyLedgerHandler(w, r)
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
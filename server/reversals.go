@@ -0,0 +1,147 @@
+package server
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/ledger"
+	"consumer-payment-service/logging"
+	"consumer-payment-service/models"
+	"consumer-payment-service/reconciler"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// reversalType labels reversals in request hashes and metrics
+const reversalType = "REVERSAL"
+
+// reversalRequestHash fingerprints a reversal request so that replays can be told apart from reused keys
+func reversalRequestHash(originalReference string, payload models.ReversalRequestPayload) string {
+	amount := "full"
+	if payload.Amount != nil {
+		amount = payload.Amount.String()
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s", reversalType, originalReference, payload.Reference, amount)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ReversePaymentHandler undoes all or part of a completed payment by making the opposite call to the payment
+// provider. The amount is reserved on the payment before the provider is called so that reversals in flight
+// can never add up to more than the payment.
+func (handler *HttpHandler) ReversePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload models.ReversalRequestPayload
+	if !handler.decodePayload(w, r, &payload) {
+		return
+	}
+
+	originalReference := chi.URLParam(r, "reference")
+	ctx := r.Context()
+	key := idempotencyKey(r, payload.Reference)
+	hash := reversalRequestHash(originalReference, payload)
+	if handler.replayPayment(ctx, w, key, hash, payload.Reference) {
+		return
+	}
+
+	original, err := handler.mongodbStore.GetPaymentByReferenceId(ctx, originalReference)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error getting payment", "reference", originalReference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	if !original.Reversible() {
+		handler.errorWriter(w, database.ErrTransactionNotReversible)
+		return
+	}
+
+	amount := original.Unreversed()
+	if payload.Amount != nil {
+		if payload.Amount.Currency != original.Amount.Currency {
+			handler.errorWriter(w, database.ErrCurrencyMismatch)
+			return
+		}
+		if payload.Amount.Minor > amount.Minor {
+			handler.errorWriter(w, database.ErrReversalExceedsAmount)
+			return
+		}
+		amount = *payload.Amount
+	}
+
+	account, err := handler.mongodbStore.GetAccountByID(ctx, original.AccountID)
+	if err != nil {
+		logging.FromContext(ctx).Error("error getting account", "account_id", original.AccountID, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	if account.Closed() {
+		handler.errorWriter(w, database.ErrAccountClosed)
+		return
+	}
+
+	// a credit is reversed by taking the money back out of the account and a debit by putting it back
+	transactionType := models.DEBIT
+	if original.Type == models.DEBIT {
+		transactionType = models.CREDIT
+	}
+
+	reversal := &models.Transaction{
+		Reference:         payload.Reference,
+		UserID:            original.UserID,
+		AccountID:         original.AccountID,
+		Amount:            amount,
+		Type:              transactionType,
+		Status:            models.PENDING,
+		OriginalReference: original.Reference,
+		IdempotencyKey:    key,
+		RequestHash:       hash,
+		CreatedAt:         time.Now().Unix(),
+	}
+
+	// reserve the amount on the payment, and on the account when money leaves it, together with the pending reversal.
+	// An account money comes back to is locked instead so that it cannot be closed while the reversal is in flight.
+	err = handler.mongodbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		if _, err := store.AdjustReversedAmount(ctx, original.Reference, amount); err != nil {
+			return err
+		}
+
+		if reversal.Type == models.DEBIT {
+			if err := ledger.Post(ctx, store, ledger.Withdrawal(reversal)); err != nil {
+				return err
+			}
+		} else if _, err := store.LockAccount(ctx, reversal.AccountID); err != nil {
+			return err
+		}
+
+		return store.CreateTransaction(ctx, reversal)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error reserving reversal", "reference", payload.Reference, "original_reference", original.Reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	if reversal.Type == models.DEBIT {
+		_, err = handler.paymentClient.MakeWithdrawal(ctx, reversal.AccountID, reversal.Reference, amount)
+	} else {
+		_, err = handler.paymentClient.MakeDeposit(ctx, reversal.AccountID, reversal.Reference, amount)
+	}
+	if err != nil {
+		handler.failPayment(ctx, reversal, err)
+		handler.errorWriter(w, providerError(err))
+		return
+	}
+
+	// a reversal left pending here holds its reservations until it is reconciled
+	if err = reconciler.Finalize(ctx, handler.mongodbStore, reversal, models.SUCCESS, "", 0, ""); err != nil {
+		logging.FromContext(ctx).Error("error completing reversal", "reference", payload.Reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, nil)
+}
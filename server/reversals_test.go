@@ -0,0 +1,441 @@
+package server
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/database/databasetest"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_HttpHandler_ReversePayment(t *testing.T) {
+	const (
+		successFullReversalOfCredit = iota
+		successPartialReversalOfDebit
+		errorValidation
+		errorPaymentNotFound
+		errorPaymentNotReversible
+		errorTransferNotReversible
+		errorCurrencyMismatch
+		errorExceedsUnreversedAmount
+		errorReversedConcurrently
+		errorMakingWithdrawal
+		errorWithdrawalTimeout
+		replayedRequest
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test success reversing the whole of a credit",
+			testType: successFullReversalOfCredit,
+		},
+
+		{
+			name:     "Test success reversing part of a debit",
+			testType: successPartialReversalOfDebit,
+		},
+
+		{
+			name:     "Test error invalid amount",
+			testType: errorValidation,
+		},
+
+		{
+			name:     "Test error payment not found",
+			testType: errorPaymentNotFound,
+		},
+
+		{
+			name:     "Test error payment still pending",
+			testType: errorPaymentNotReversible,
+		},
+
+		{
+			name:     "Test error transfers cannot be reversed",
+			testType: errorTransferNotReversible,
+		},
+
+		{
+			name:     "Test error amount in another currency",
+			testType: errorCurrencyMismatch,
+		},
+
+		{
+			name:     "Test error amount exceeds what is left to reverse",
+			testType: errorExceedsUnreversedAmount,
+		},
+
+		{
+			name:     "Test error payment reversed by another request in the meantime",
+			testType: errorReversedConcurrently,
+		},
+
+		{
+			name:     "Test withdrawal declined by third party service releases the reservations",
+			testType: errorMakingWithdrawal,
+		},
+
+		{
+			name:     "Test withdrawal timing out on third party service leaves the reversal pending",
+			testType: errorWithdrawalTimeout,
+		},
+
+		{
+			name:     "Test replayed request returns original outcome",
+			testType: replayedRequest,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+	}
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
+
+	handler := NewHTTPHandler(cfg, mockDataStore, mockThirdPartyClient)
+
+	newRequest := func(reference string, payload models.ReversalRequestPayload) *http.Request {
+		body, _ := json.Marshal(payload)
+		return newRouteRequest(http.MethodPost, "/payments/"+reference+"/reverse", "reference", reference, string(body))
+	}
+
+	mockAccount := &models.Account{
+		AccountID: "acc_001",
+		Balance:   models.NewMoney(5000, "NGN"),
+		UserID:    "usr-001",
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			mockOriginal := &models.Transaction{
+				Reference: "ref-001",
+				UserID:    "usr-001",
+				AccountID: "acc_001",
+				Amount:    models.NewMoney(1000, "NGN"),
+				Type:      models.CREDIT,
+				Status:    models.SUCCESS,
+			}
+			fullReversal := models.ReversalRequestPayload{Reference: "rev-001"}
+
+			expectOriginal := func(original *models.Transaction) {
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "rev-001").
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "ref-001").
+					Return(original, nil)
+			}
+
+			switch testCase.testType {
+			case successFullReversalOfCredit:
+				expectOriginal(mockOriginal)
+
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustReversedAmount(gomock.Any(), "ref-001", models.NewMoney(1000, "NGN")).
+					Return(mockOriginal, nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc_001", models.NewMoney(-1000, "NGN")).
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				var reversal *models.Transaction
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ any, transaction *models.Transaction) error {
+						reversal = transaction
+						return nil
+					})
+
+				mockThirdPartyClient.
+					EXPECT().
+					MakeWithdrawal(gomock.Any(), "acc_001", "rev-001", models.NewMoney(1000, "NGN")).
+					Return(&client.PaymentResponse{AccountId: "acc_001", Reference: "rev-001"}, nil)
+
+				mockDataStore.
+					EXPECT().
+					UpdateTransactionStatus(gomock.Any(), "rev-001", models.SUCCESS).
+					Return(nil)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", fullReversal))
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				assert.Equal(t, models.DEBIT, reversal.Type)
+				assert.Equal(t, "ref-001", reversal.OriginalReference)
+				assert.Equal(t, "usr-001", reversal.UserID)
+				assert.Equal(t, reversalRequestHash("ref-001", fullReversal), reversal.RequestHash)
+				assert.Equal(t, models.SUCCESS, reversal.Status)
+
+			case successPartialReversalOfDebit:
+				mockOriginal.Type = models.DEBIT
+				mockOriginal.Status = models.PARTIALLY_REVERSED
+				mockOriginal.ReversedAmount = &models.Money{Minor: 400, Currency: "NGN"}
+				amount := models.NewMoney(600, "NGN")
+
+				expectOriginal(mockOriginal)
+
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustReversedAmount(gomock.Any(), "ref-001", amount).
+					Return(mockOriginal, nil)
+
+				// the money comes back to the account, which is locked so that it cannot be closed meanwhile
+				mockDataStore.
+					EXPECT().
+					LockAccount(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					DoAndReturn(func(_ any, transaction *models.Transaction) error {
+						assert.Equal(t, models.CREDIT, transaction.Type)
+						return nil
+					})
+
+				mockThirdPartyClient.
+					EXPECT().
+					MakeDeposit(gomock.Any(), "acc_001", "rev-001", amount).
+					Return(&client.PaymentResponse{AccountId: "acc_001", Reference: "rev-001"}, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					UpdateTransactionStatus(gomock.Any(), "rev-001", models.SUCCESS).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc_001", amount).
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", models.ReversalRequestPayload{Reference: "rev-001", Amount: &amount}))
+				assert.Equal(t, http.StatusOK, w.Code)
+
+			case errorValidation:
+				amount := models.NewMoney(0, "NGN")
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", models.ReversalRequestPayload{Amount: &amount}))
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, []models.FieldError{
+					{Field: "reference", Reason: "is required"},
+					{Field: "amount", Reason: "must be greater than zero"},
+				}, response.Fields)
+
+			case errorPaymentNotFound:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "rev-001").
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "ref-001").
+					Return(nil, database.ErrTransactionNotFound)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", fullReversal))
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorPaymentNotReversible:
+				mockOriginal.Status = models.PENDING
+				expectOriginal(mockOriginal)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", fullReversal))
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodePaymentNotReversible, response.Code)
+
+			case errorTransferNotReversible:
+				mockOriginal.TransferID = "trf_001"
+				expectOriginal(mockOriginal)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", fullReversal))
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case errorCurrencyMismatch:
+				amount := models.NewMoney(100, "USD")
+				expectOriginal(mockOriginal)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", models.ReversalRequestPayload{Reference: "rev-001", Amount: &amount}))
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeCurrencyMismatch, response.Code)
+
+			case errorExceedsUnreversedAmount:
+				mockOriginal.Status = models.PARTIALLY_REVERSED
+				mockOriginal.ReversedAmount = &models.Money{Minor: 400, Currency: "NGN"}
+				amount := models.NewMoney(700, "NGN")
+				expectOriginal(mockOriginal)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", models.ReversalRequestPayload{Reference: "rev-001", Amount: &amount}))
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeReversalExceedsAmount, response.Code)
+
+			case errorReversedConcurrently:
+				expectOriginal(mockOriginal)
+
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustReversedAmount(gomock.Any(), "ref-001", models.NewMoney(1000, "NGN")).
+					Return(nil, database.ErrReversalExceedsAmount)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", fullReversal))
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+			case errorMakingWithdrawal, errorWithdrawalTimeout:
+				expectOriginal(mockOriginal)
+
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustReversedAmount(gomock.Any(), "ref-001", models.NewMoney(1000, "NGN")).
+					Return(mockOriginal, nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc_001", models.NewMoney(-1000, "NGN")).
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockThirdPartyClient.
+					EXPECT().
+					MakeWithdrawal(gomock.Any(), "acc_001", "rev-001", models.NewMoney(1000, "NGN")).
+					DoAndReturn(func(context.Context, string, string, models.Money) (*client.PaymentResponse, error) {
+						if testCase.testType == errorWithdrawalTimeout {
+							return nil, &url.Error{Op: "Post", URL: "http://example.domain.com/third-party/withdrawals", Err: context.DeadlineExceeded}
+						}
+						return nil, &client.ProviderError{StatusCode: http.StatusPaymentRequired, Message: "card declined", Kind: client.ProviderErrorDeclined}
+					})
+
+				if testCase.testType == errorWithdrawalTimeout {
+					// the provider may have paid out, so the reservations are held until the reversal is reconciled
+					handler.ReversePaymentHandler(w, newRequest("ref-001", fullReversal))
+					assert.Equal(t, http.StatusBadGateway, w.Code)
+					return
+				}
+
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc_001", models.NewMoney(1000, "NGN")).
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					AdjustReversedAmount(gomock.Any(), "ref-001", models.NewMoney(-1000, "NGN")).
+					Return(mockOriginal, nil)
+
+				mockDataStore.
+					EXPECT().
+					FailTransaction(gomock.Any(), "rev-001", "card declined", http.StatusPaymentRequired, string(client.ProviderErrorDeclined)).
+					Return(nil)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", fullReversal))
+				assert.Equal(t, http.StatusPaymentRequired, w.Code)
+
+			case replayedRequest:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), "rev-001").
+					Return(&models.Transaction{
+						Reference:         "rev-001",
+						Status:            models.SUCCESS,
+						OriginalReference: "ref-001",
+						IdempotencyKey:    "rev-001",
+						RequestHash:       reversalRequestHash("ref-001", fullReversal),
+					}, nil)
+
+				handler.ReversePaymentHandler(w, newRequest("ref-001", fullReversal))
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"consumer-payment-service/logging"
+	"consumer-payment-service/models"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	defaultTransactionPageSize = 20
+	maxTransactionPageSize     = 100
+)
+
+// encodeCursor makes the position of transaction opaque to clients
+func encodeCursor(transaction models.Transaction) string {
+	data, _ := json.Marshal(models.TransactionCursor{CreatedAt: transaction.CreatedAt, Reference: transaction.Reference})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (*models.TransactionCursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+
+	var position models.TransactionCursor
+	if err := json.Unmarshal(data, &position); err != nil || position.Reference == "" {
+		return nil, false
+	}
+	return &position, true
+}
+
+// parseTransactionFilter reads the filters of a transaction history request, amounts are decimals in the
+// currency of the account and the created_at window is given as RFC 3339 timestamps
+func parseTransactionFilter(query url.Values, account *models.Account) (models.TransactionFilter, []models.FieldError) {
+	filter := models.TransactionFilter{AccountID: account.AccountID, Limit: defaultTransactionPageSize}
+	var fieldErrors []models.FieldError
+
+	switch transactionType := models.TransactionType(query.Get("type")); transactionType {
+	case "", models.DEBIT, models.CREDIT:
+		filter.Type = transactionType
+	default:
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "type", Reason: "must be DEBIT or CREDIT"})
+	}
+
+	switch status := models.TransactionStatus(query.Get("status")); status {
+	case "", models.PENDING, models.SUCCESS, models.FAILED, models.PARTIALLY_REVERSED, models.REVERSED,
+		models.AUTHORIZED, models.VOIDED, models.EXPIRED:
+		filter.Status = status
+	default:
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "status", Reason: "must be PENDING, SUCCESS, FAILED, PARTIALLY_REVERSED, REVERSED, AUTHORIZED, VOIDED or EXPIRED"})
+	}
+
+	amounts := []struct {
+		field string
+		value **int64
+	}{
+		{field: "min_amount", value: &filter.MinAmount},
+		{field: "max_amount", value: &filter.MaxAmount},
+	}
+	for _, amount := range amounts {
+		value := query.Get(amount.field)
+		if value == "" {
+			continue
+		}
+
+		money, err := models.ParseMoney(value, account.Balance.Currency)
+		if err != nil {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: amount.field, Reason: err.Error()})
+			continue
+		}
+		*amount.value = &money.Minor
+	}
+
+	timestamps := []struct {
+		field string
+		value *int64
+	}{
+		{field: "created_from", value: &filter.CreatedFrom},
+		{field: "created_to", value: &filter.CreatedTo},
+	}
+	for _, timestamp := range timestamps {
+		value := query.Get(timestamp.field)
+		if value == "" {
+			continue
+		}
+
+		createdAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: timestamp.field, Reason: "must be an RFC 3339 timestamp"})
+			continue
+		}
+		*timestamp.value = createdAt.Unix()
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxTransactionPageSize {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "limit", Reason: "must be between 1 and " + strconv.Itoa(maxTransactionPageSize)})
+		} else {
+			filter.Limit = limit
+		}
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		position, ok := decodeCursor(value)
+		if !ok {
+			fieldErrors = append(fieldErrors, models.FieldError{Field: "cursor", Reason: "is not a valid cursor"})
+		}
+		filter.After = position
+	}
+
+	return filter, fieldErrors
+}
+
+// ListAccountTransactionsHandler lists the transactions of an account newest first, a page ends with a cursor
+// to pass back for the next one
+func (handler *HttpHandler) ListAccountTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	accountId := chi.URLParam(r, "id")
+	ctx := r.Context()
+
+	account, err := handler.mongodbStore.GetAccountByID(ctx, accountId)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error getting account", "account_id", accountId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	filter, fieldErrors := parseTransactionFilter(r.URL.Query(), account)
+	if len(fieldErrors) > 0 {
+		response := models.ErrorResponse{
+			Code:         models.ErrorCodeValidationFailed,
+			ErrorMessage: "request validation failed",
+			Fields:       fieldErrors,
+		}
+		handler.responseWriter(w, response, http.StatusUnprocessableEntity)
+		return
+	}
+
+	// fetch one more than asked for to find out whether there is a next page
+	pageSize := filter.Limit
+	filter.Limit++
+
+	transactions, err := handler.mongodbStore.ListTransactions(ctx, filter)
+	if err != nil {
+		logging.FromContext(ctx).Error("error listing transactions", "account_id", accountId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	page := models.TransactionPage{Transactions: transactions}
+	if int64(len(transactions)) > pageSize {
+		page.Transactions = transactions[:pageSize]
+		page.NextCursor = encodeCursor(page.Transactions[pageSize-1])
+	}
+
+	handler.responseWriter(w, page)
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_HttpHandler_ListAccountTransactions(t *testing.T) {
+	const (
+		success = iota
+		successWithNextPage
+		successWithFilters
+		successWithCursor
+		errorInvalidFilters
+		errorAccountNotFound
+		errorListingTransactions
+	)
+
+	testCases := []struct {
+		name     string
+		target   string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			target:   "/accounts/acc_001/transactions",
+			testType: success,
+		},
+
+		{
+			name:     "Test success with a next page",
+			target:   "/accounts/acc_001/transactions?limit=2",
+			testType: successWithNextPage,
+		},
+
+		{
+			name:     "Test success with filters",
+			target:   "/accounts/acc_001/transactions?type=DEBIT&status=SUCCESS&min_amount=10.50&max_amount=100&created_from=2024-01-01T00:00:00Z&created_to=2024-02-01T00:00:00Z",
+			testType: successWithFilters,
+		},
+
+		{
+			name:     "Test success resuming from a cursor",
+			testType: successWithCursor,
+		},
+
+		{
+			name:     "Test error invalid filters",
+			target:   "/accounts/acc_001/transactions?type=REFUND&status=DONE&min_amount=ten&created_from=yesterday&limit=500&cursor=not-a-cursor",
+			testType: errorInvalidFilters,
+		},
+
+		{
+			name:     "Test error account not found",
+			target:   "/accounts/acc_001/transactions",
+			testType: errorAccountNotFound,
+		},
+
+		{
+			name:     "Test error listing transactions",
+			target:   "/accounts/acc_001/transactions",
+			testType: errorListingTransactions,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+	}
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
+
+	handler := NewHTTPHandler(cfg, mockDataStore, mockThirdPartyClient)
+
+	mockAccount := &models.Account{
+		AccountID: "acc_001",
+		Balance:   models.NewMoney(100000, "NGN"),
+		UserID:    "usr-001",
+	}
+
+	mockTransactions := []models.Transaction{
+		{Reference: "ref-003", AccountID: "acc_001", Amount: models.NewMoney(300, "NGN"), Type: models.DEBIT, Status: models.SUCCESS, CreatedAt: 1700000300},
+		{Reference: "ref-002", AccountID: "acc_001", Amount: models.NewMoney(200, "NGN"), Type: models.CREDIT, Status: models.SUCCESS, CreatedAt: 1700000200},
+		{Reference: "ref-001", AccountID: "acc_001", Amount: models.NewMoney(100, "NGN"), Type: models.CREDIT, Status: models.FAILED, CreatedAt: 1700000100},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			var page models.TransactionPage
+
+			switch testCase.testType {
+			case success:
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					ListTransactions(gomock.Any(), models.TransactionFilter{AccountID: "acc_001", Limit: defaultTransactionPageSize + 1}).
+					Return(mockTransactions, nil)
+
+				handler.ListAccountTransactionsHandler(w, newRouteRequest(http.MethodGet, testCase.target, "id", "acc_001", ""))
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+				assert.Equal(t, mockTransactions, page.Transactions)
+				assert.Empty(t, page.NextCursor)
+
+			case successWithNextPage:
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					ListTransactions(gomock.Any(), models.TransactionFilter{AccountID: "acc_001", Limit: 3}).
+					Return(mockTransactions, nil)
+
+				handler.ListAccountTransactionsHandler(w, newRouteRequest(http.MethodGet, testCase.target, "id", "acc_001", ""))
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+				assert.Equal(t, mockTransactions[:2], page.Transactions)
+
+				cursor, ok := decodeCursor(page.NextCursor)
+				assert.True(t, ok)
+				assert.Equal(t, &models.TransactionCursor{CreatedAt: 1700000200, Reference: "ref-002"}, cursor)
+
+			case successWithFilters:
+				minAmount, maxAmount := int64(1050), int64(10000)
+
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					ListTransactions(gomock.Any(), models.TransactionFilter{
+						AccountID:   "acc_001",
+						Type:        models.DEBIT,
+						Status:      models.SUCCESS,
+						MinAmount:   &minAmount,
+						MaxAmount:   &maxAmount,
+						CreatedFrom: 1704067200,
+						CreatedTo:   1706745600,
+						Limit:       defaultTransactionPageSize + 1,
+					}).
+					Return(mockTransactions[:1], nil)
+
+				handler.ListAccountTransactionsHandler(w, newRouteRequest(http.MethodGet, testCase.target, "id", "acc_001", ""))
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+				assert.Equal(t, mockTransactions[:1], page.Transactions)
+
+			case successWithCursor:
+				cursor := encodeCursor(mockTransactions[1])
+
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					ListTransactions(gomock.Any(), models.TransactionFilter{
+						AccountID: "acc_001",
+						After:     &models.TransactionCursor{CreatedAt: 1700000200, Reference: "ref-002"},
+						Limit:     defaultTransactionPageSize + 1,
+					}).
+					Return(mockTransactions[2:], nil)
+
+				handler.ListAccountTransactionsHandler(w, newRouteRequest(http.MethodGet, fmt.Sprintf("/accounts/acc_001/transactions?cursor=%s", cursor), "id", "acc_001", ""))
+				assert.Equal(t, http.StatusOK, w.Code)
+
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+				assert.Equal(t, mockTransactions[2:], page.Transactions)
+				assert.Empty(t, page.NextCursor)
+
+			case errorInvalidFilters:
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				handler.ListAccountTransactionsHandler(w, newRouteRequest(http.MethodGet, testCase.target, "id", "acc_001", ""))
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeValidationFailed, response.Code)
+
+				fields := make([]string, 0, len(response.Fields))
+				for _, field := range response.Fields {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, []string{"type", "status", "min_amount", "created_from", "limit", "cursor"}, fields)
+
+			case errorAccountNotFound:
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(nil, database.ErrAccountNotFound)
+
+				handler.ListAccountTransactionsHandler(w, newRouteRequest(http.MethodGet, testCase.target, "id", "acc_001", ""))
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorListingTransactions:
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), "acc_001").
+					Return(mockAccount, nil)
+
+				mockDataStore.
+					EXPECT().
+					ListTransactions(gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("connection reset"))
+
+				handler.ListAccountTransactionsHandler(w, newRouteRequest(http.MethodGet, testCase.target, "id", "acc_001", ""))
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+			}
+		})
+	}
+}
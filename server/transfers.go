@@ -0,0 +1,143 @@
+package server
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/ledger"
+	"consumer-payment-service/logging"
+	"consumer-payment-service/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// transferType labels transfers in request hashes and metrics, a transfer is recorded as a DEBIT and a CREDIT
+const transferType = "TRANSFER"
+
+// creditLegSuffix is appended to the client reference of a transfer to reference its CREDIT leg, the DEBIT leg
+// keeps the client reference so that the transfer can be found and replayed by it
+const creditLegSuffix = ":credit"
+
+// transferRequestHash fingerprints a transfer request so that replays can be told apart from reused keys
+func transferRequestHash(payload models.TransferRequestPayload) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s|%s|%s", transferType, payload.UserId, payload.FromAccountId, payload.ToAccountId, payload.Reference, payload.Amount)))
+	return hex.EncodeToString(sum[:])
+}
+
+// transferResponse describes the transfer a DEBIT leg belongs to
+func transferResponse(debit models.Transaction) models.TransferResponse {
+	return models.TransferResponse{
+		TransferID:    debit.TransferID,
+		Reference:     debit.Reference,
+		FromAccountID: debit.AccountID,
+		ToAccountID:   debit.CounterpartyAccountID,
+		Amount:        debit.Amount,
+		CreatedAt:     debit.CreatedAt,
+	}
+}
+
+// TransferHandler moves money from an account of the user to another account without calling the payment
+// provider, its journal entry, both balances and both legs of the transfer are written in a single transaction
+func (handler *HttpHandler) TransferHandler(w http.ResponseWriter, r *http.Request) {
+	var payload models.TransferRequestPayload
+	if !handler.decodePayload(w, r, &payload) {
+		return
+	}
+
+	ctx := r.Context()
+	key := idempotencyKey(r, payload.Reference)
+	hash := transferRequestHash(payload)
+	if previous, seen := handler.previousRequest(ctx, w, key, hash, payload.Reference); seen {
+		if previous != nil {
+			handler.responseWriter(w, transferResponse(*previous), http.StatusCreated)
+		}
+		return
+	}
+
+	// validate user exist
+	if _, err := handler.mongodbStore.GetUserById(ctx, payload.UserId); err != nil {
+		logging.FromContext(ctx).Warn("error getting user", "user_id", payload.UserId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	// money can only leave an account of the user, it can go to any account
+	from, err := handler.mongodbStore.GetUserAccount(ctx, payload.UserId, payload.FromAccountId)
+	if err != nil {
+		handler.errorWriter(w, err)
+		return
+	}
+
+	to, err := handler.mongodbStore.GetAccountByID(ctx, payload.ToAccountId)
+	if err != nil {
+		logging.FromContext(ctx).Warn("error getting account", "account_id", payload.ToAccountId, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	for _, account := range []*models.Account{from, to} {
+		if account.Closed() {
+			handler.errorWriter(w, database.ErrAccountClosed)
+			return
+		}
+
+		if account.Balance.Currency != payload.Amount.Currency {
+			handler.errorWriter(w, database.ErrCurrencyMismatch)
+			return
+		}
+	}
+
+	transferId, err := models.NewID(models.TransferIDPrefix)
+	if err != nil {
+		logging.FromContext(ctx).Error("error generating transfer id", "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	createdAt := time.Now().Unix()
+	debit := &models.Transaction{
+		Reference:             payload.Reference,
+		UserID:                payload.UserId,
+		AccountID:             from.AccountID,
+		Amount:                payload.Amount,
+		Type:                  models.DEBIT,
+		Status:                models.SUCCESS,
+		TransferID:            transferId,
+		CounterpartyAccountID: to.AccountID,
+		IdempotencyKey:        key,
+		RequestHash:           hash,
+		CreatedAt:             createdAt,
+	}
+	credit := &models.Transaction{
+		Reference:             payload.Reference + creditLegSuffix,
+		UserID:                to.UserID,
+		AccountID:             to.AccountID,
+		Amount:                payload.Amount,
+		Type:                  models.CREDIT,
+		Status:                models.SUCCESS,
+		TransferID:            transferId,
+		CounterpartyAccountID: from.AccountID,
+		CreatedAt:             createdAt,
+	}
+
+	// the debit only applies when the balance covers it, nothing is written unless every step succeeds
+	err = handler.mongodbStore.WithTx(ctx, func(store database.MongoDBStore) error {
+		if err := ledger.Post(ctx, store, ledger.Transfer(debit)); err != nil {
+			return err
+		}
+
+		if err := store.CreateTransaction(ctx, debit); err != nil {
+			return err
+		}
+
+		return store.CreateTransaction(ctx, credit)
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("error making transfer", "reference", payload.Reference, "error", err)
+		handler.errorWriter(w, err)
+		return
+	}
+
+	handler.responseWriter(w, transferResponse(*debit), http.StatusCreated)
+}
@@ -0,0 +1,400 @@
+package server
+
+import (
+	"bytes"
+	"consumer-payment-service/database"
+	"consumer-payment-service/database/databasetest"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_HttpHandler_Transfer(t *testing.T) {
+	const (
+		success = iota
+		errorValidation
+		errorGettingUser
+		errorAccountNotOwned
+		errorDestinationNotFound
+		errorDestinationClosed
+		errorCurrencyMismatch
+		errorInsufficientFunds
+		errorCreatingTransaction
+		replayedRequest
+		errorIdempotencyConflict
+	)
+
+	testCases := []struct {
+		name     string
+		testType int
+	}{
+		{
+			name:     "Test success",
+			testType: success,
+		},
+
+		{
+			name:     "Test error transfer to the same account",
+			testType: errorValidation,
+		},
+
+		{
+			name:     "Test error fetching user",
+			testType: errorGettingUser,
+		},
+
+		{
+			name:     "Test error source account belongs to another user",
+			testType: errorAccountNotOwned,
+		},
+
+		{
+			name:     "Test error destination account not found",
+			testType: errorDestinationNotFound,
+		},
+
+		{
+			name:     "Test error destination account closed",
+			testType: errorDestinationClosed,
+		},
+
+		{
+			name:     "Test error destination account in another currency",
+			testType: errorCurrencyMismatch,
+		},
+
+		{
+			name:     "Test error insufficient balance",
+			testType: errorInsufficientFunds,
+		},
+
+		{
+			name:     "Test error creating transaction record",
+			testType: errorCreatingTransaction,
+		},
+
+		{
+			name:     "Test replayed request returns original transfer",
+			testType: replayedRequest,
+		},
+
+		{
+			name:     "Test error reference reused with a different payload",
+			testType: errorIdempotencyConflict,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	cfg := &environment.Config{
+		THIRD_PARTY_SERVICE_BASE_URL: "http://example.domain.com/third-party",
+	}
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+	mockThirdPartyClient := mocks.NewMockThirdPartyAPIClient(controller)
+
+	handler := NewHTTPHandler(cfg, mockDataStore, mockThirdPartyClient)
+
+	mockRequest := models.TransferRequestPayload{
+		UserId:        "usr-001",
+		FromAccountId: "acc-001",
+		ToAccountId:   "acc-002",
+		Reference:     "trf-ref-001",
+		Amount:        models.NewMoney(2500, "NGN"),
+	}
+	mockPayload, _ := json.Marshal(mockRequest)
+
+	mockUser := &models.User{Id: "usr-001", Name: "Ada Lovelace"}
+	mockFrom := &models.Account{AccountID: "acc-001", Balance: models.NewMoney(10000, "NGN"), UserID: "usr-001"}
+	mockTo := &models.Account{AccountID: "acc-002", Balance: models.NewMoney(0, "NGN"), UserID: "usr-002"}
+
+	expectLookups := func(to *models.Account) {
+		mockDataStore.
+			EXPECT().
+			GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+			Return(nil, database.ErrTransactionNotFound)
+
+		mockDataStore.
+			EXPECT().
+			GetUserById(gomock.Any(), mockRequest.UserId).
+			Return(mockUser, nil)
+
+		mockDataStore.
+			EXPECT().
+			GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.FromAccountId).
+			Return(mockFrom, nil)
+
+		mockDataStore.
+			EXPECT().
+			GetAccountByID(gomock.Any(), mockRequest.ToAccountId).
+			Return(to, nil)
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/transfers", bytes.NewBuffer(mockPayload))
+
+			switch testCase.testType {
+			case success:
+				expectLookups(mockTo)
+				databasetest.ExpectWithTx(mockDataStore)
+
+				var entry *models.JournalEntry
+				var legs []*models.Transaction
+				gomock.InOrder(
+					mockDataStore.
+						EXPECT().
+						AdjustAccountBalance(gomock.Any(), "acc-001", models.NewMoney(-2500, "NGN")).
+						Return(mockFrom, nil),
+					mockDataStore.
+						EXPECT().
+						AdjustAccountBalance(gomock.Any(), "acc-002", models.NewMoney(2500, "NGN")).
+						Return(mockTo, nil),
+					mockDataStore.
+						EXPECT().
+						CreateJournalEntry(gomock.Any(), gomock.Any()).
+						DoAndReturn(func(_ any, journalEntry *models.JournalEntry) error {
+							entry = journalEntry
+							return nil
+						}),
+					mockDataStore.
+						EXPECT().
+						CreateTransaction(gomock.Any(), gomock.Any()).
+						Times(2).
+						DoAndReturn(func(_ any, transaction *models.Transaction) error {
+							legs = append(legs, transaction)
+							return nil
+						}),
+				)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusCreated, w.Code)
+
+				var response models.TransferResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Regexp(t, "^trf_[0-9a-f]{24}$", response.TransferID)
+				assert.Equal(t, "trf-ref-001", response.Reference)
+				assert.Equal(t, "acc-001", response.FromAccountID)
+				assert.Equal(t, "acc-002", response.ToAccountID)
+				assert.Equal(t, mockRequest.Amount, response.Amount)
+
+				assert.Equal(t, "trf-ref-001", entry.Reference)
+				assert.Equal(t, []models.Posting{
+					{AccountID: "acc-001", Amount: models.NewMoney(-2500, "NGN")},
+					{AccountID: "acc-002", Amount: models.NewMoney(2500, "NGN")},
+				}, entry.Postings)
+
+				assert.Len(t, legs, 2)
+				debit, credit := legs[0], legs[1]
+				assert.Equal(t, models.DEBIT, debit.Type)
+				assert.Equal(t, "trf-ref-001", debit.Reference)
+				assert.Equal(t, "usr-001", debit.UserID)
+				assert.Equal(t, "acc-002", debit.CounterpartyAccountID)
+				assert.Equal(t, transferRequestHash(mockRequest), debit.RequestHash)
+				assert.Equal(t, models.CREDIT, credit.Type)
+				assert.Equal(t, "trf-ref-001:credit", credit.Reference)
+				assert.Equal(t, "usr-002", credit.UserID)
+				assert.Equal(t, "acc-001", credit.CounterpartyAccountID)
+				assert.Empty(t, credit.IdempotencyKey)
+				for _, leg := range legs {
+					assert.Equal(t, response.TransferID, leg.TransferID)
+					assert.Equal(t, models.SUCCESS, leg.Status)
+				}
+
+			case errorValidation:
+				sameAccount := mockRequest
+				sameAccount.ToAccountId = sameAccount.FromAccountId
+				payload, _ := json.Marshal(sameAccount)
+
+				handler.TransferHandler(w, httptest.NewRequest(http.MethodPost, "/transfers", bytes.NewBuffer(payload)))
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, []models.FieldError{{Field: "to_account_id", Reason: "must differ from from_account_id"}}, response.Fields)
+
+			case errorGettingUser:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(nil, database.ErrUserNotFound)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorAccountNotOwned:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(mockUser, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.FromAccountId).
+					Return(nil, database.ErrAccountNotOwned)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusForbidden, w.Code)
+
+			case errorDestinationNotFound:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(nil, database.ErrTransactionNotFound)
+
+				mockDataStore.
+					EXPECT().
+					GetUserById(gomock.Any(), mockRequest.UserId).
+					Return(mockUser, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetUserAccount(gomock.Any(), mockRequest.UserId, mockRequest.FromAccountId).
+					Return(mockFrom, nil)
+
+				mockDataStore.
+					EXPECT().
+					GetAccountByID(gomock.Any(), mockRequest.ToAccountId).
+					Return(nil, database.ErrAccountNotFound)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+
+			case errorDestinationClosed:
+				closed := *mockTo
+				closed.Status = models.CLOSED
+				expectLookups(&closed)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeAccountClosed, response.Code)
+
+			case errorCurrencyMismatch:
+				dollars := *mockTo
+				dollars.Balance = models.NewMoney(0, "USD")
+				expectLookups(&dollars)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeCurrencyMismatch, response.Code)
+
+			case errorInsufficientFunds:
+				expectLookups(mockTo)
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), "acc-001", models.NewMoney(-2500, "NGN")).
+					Return(nil, database.ErrInsufficientFunds)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeInsufficientFunds, response.Code)
+
+			case errorCreatingTransaction:
+				expectLookups(mockTo)
+				databasetest.ExpectWithTx(mockDataStore)
+
+				mockDataStore.
+					EXPECT().
+					AdjustAccountBalance(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(2).
+					Return(mockFrom, nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateJournalEntry(gomock.Any(), gomock.Any()).
+					Return(nil)
+
+				mockDataStore.
+					EXPECT().
+					CreateTransaction(gomock.Any(), gomock.Any()).
+					Return(database.ErrDuplicateReference)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+			case replayedRequest:
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(&models.Transaction{
+						Reference:             mockRequest.Reference,
+						AccountID:             "acc-001",
+						Amount:                mockRequest.Amount,
+						Type:                  models.DEBIT,
+						Status:                models.SUCCESS,
+						TransferID:            "trf_001",
+						CounterpartyAccountID: "acc-002",
+						IdempotencyKey:        mockRequest.Reference,
+						RequestHash:           transferRequestHash(mockRequest),
+						CreatedAt:             1700000000,
+					}, nil)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusCreated, w.Code)
+				assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+
+				var response models.TransferResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.TransferResponse{
+					TransferID:    "trf_001",
+					Reference:     "trf-ref-001",
+					FromAccountID: "acc-001",
+					ToAccountID:   "acc-002",
+					Amount:        mockRequest.Amount,
+					CreatedAt:     1700000000,
+				}, response)
+
+			case errorIdempotencyConflict:
+				changedRequest := mockRequest
+				changedRequest.ToAccountId = "acc-003"
+
+				mockDataStore.
+					EXPECT().
+					GetPaymentByReferenceId(gomock.Any(), mockRequest.Reference).
+					Return(&models.Transaction{
+						Reference:      mockRequest.Reference,
+						Status:         models.SUCCESS,
+						IdempotencyKey: mockRequest.Reference,
+						RequestHash:    transferRequestHash(changedRequest),
+					}, nil)
+
+				handler.TransferHandler(w, r)
+				assert.Equal(t, http.StatusConflict, w.Code)
+
+				var response models.ErrorResponse
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, models.ErrorCodeIdempotencyConflict, response.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/models"
+	"context"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// referenceKey records the payment reference on provider spans
+const referenceKey = attribute.Key("payment.reference")
+
+type tracedClient struct {
+	next   client.ThirdPartyAPIClient
+	tracer trace.Tracer
+}
+
+// TraceClient returns a ThirdPartyAPIClient that records a span for every call made to the payment provider
+func TraceClient(paymentClient client.ThirdPartyAPIClient, provider trace.TracerProvider) client.ThirdPartyAPIClient {
+	return &tracedClient{next: paymentClient, tracer: provider.Tracer(instrumentationName)}
+}
+
+func (c *tracedClient) start(ctx context.Context, method string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "ThirdPartyAPIClient."+method, trace.WithAttributes(attributes...))
+}
+
+func (c *tracedClient) MakeDeposit(ctx context.Context, accountId, reference string, amount models.Money) (resp *client.PaymentResponse, err error) {
+	ctx, span := c.start(ctx, "MakeDeposit", referenceKey.String(reference))
+	defer func() { end(span, err) }()
+	return c.next.MakeDeposit(ctx, accountId, reference, amount)
+}
+
+func (c *tracedClient) MakeWithdrawal(ctx context.Context, accountId, reference string, amount models.Money) (resp *client.PaymentResponse, err error) {
+	ctx, span := c.start(ctx, "MakeWithdrawal", referenceKey.String(reference))
+	defer func() { end(span, err) }()
+	return c.next.MakeWithdrawal(ctx, accountId, reference, amount)
+}
+
+func (c *tracedClient) RetrieveTransaction(ctx context.Context, reference string) (resp *client.PaymentResponse, err error) {
+	ctx, span := c.start(ctx, "RetrieveTransaction", referenceKey.String(reference))
+	defer func() { end(span, err) }()
+	return c.next.RetrieveTransaction(ctx, reference)
+}
+
+func (c *tracedClient) Ping(ctx context.Context) (err error) {
+	ctx, span := c.start(ctx, "Ping")
+	defer func() { end(span, err) }()
+	return c.next.Ping(ctx)
+}
+
+func (c *tracedClient) CircuitState() client.CircuitState {
+	return c.next.CircuitState()
+}
+
+type transport struct {
+	next   http.RoundTripper
+	tracer trace.Tracer
+}
+
+// Transport returns an http.RoundTripper that records a client span for every request sent through next and
+// passes the trace context on to the server with the global propagator (W3C traceparent once Setup has run)
+func Transport(next http.RoundTripper, provider trace.TracerProvider) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next, tracer: provider.Tracer(instrumentationName)}
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(r.Context(), "HTTP "+r.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLFull(r.URL.String()),
+			semconv.ServerAddress(r.URL.Hostname()),
+		),
+	)
+	defer span.End()
+
+	// RoundTrip must not modify the caller's request
+	r = r.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, strconv.Itoa(resp.StatusCode))
+	}
+	return resp, nil
+}
@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"consumer-payment-service/database"
+	"consumer-payment-service/models"
+	"context"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracedStore struct {
+	next   database.MongoDBStore
+	tracer trace.Tracer
+}
+
+// TraceStore returns a MongoDBStore that records a span for every call made to store
+func TraceStore(store database.MongoDBStore, provider trace.TracerProvider) database.MongoDBStore {
+	return &tracedStore{next: store, tracer: provider.Tracer(instrumentationName)}
+}
+
+func (s *tracedStore) start(ctx context.Context, method string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "MongoDBStore."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemMongoDB, semconv.DBOperation(method)),
+	)
+}
+
+func (s *tracedStore) GetAccountByID(ctx context.Context, accountId string) (account *models.Account, err error) {
+	ctx, span := s.start(ctx, "GetAccountByID")
+	defer func() { end(span, err) }()
+	return s.next.GetAccountByID(ctx, accountId)
+}
+
+func (s *tracedStore) GetUserAccount(ctx context.Context, userId, accountId string) (account *models.Account, err error) {
+	ctx, span := s.start(ctx, "GetUserAccount")
+	defer func() { end(span, err) }()
+	return s.next.GetUserAccount(ctx, userId, accountId)
+}
+
+func (s *tracedStore) AdjustAccountBalance(ctx context.Context, accountId string, amount models.Money) (account *models.Account, err error) {
+	ctx, span := s.start(ctx, "AdjustAccountBalance")
+	defer func() { end(span, err) }()
+	return s.next.AdjustAccountBalance(ctx, accountId, amount)
+}
+
+func (s *tracedStore) AdjustAvailableBalance(ctx context.Context, accountId string, amount models.Money) (account *models.Account, err error) {
+	ctx, span := s.start(ctx, "AdjustAvailableBalance")
+	defer func() { end(span, err) }()
+	return s.next.AdjustAvailableBalance(ctx, accountId, amount)
+}
+
+func (s *tracedStore) LockAccount(ctx context.Context, accountId string) (account *models.Account, err error) {
+	ctx, span := s.start(ctx, "LockAccount")
+	defer func() { end(span, err) }()
+	return s.next.LockAccount(ctx, accountId)
+}
+
+func (s *tracedStore) CreateTransaction(ctx context.Context, transaction *models.Transaction) (err error) {
+	ctx, span := s.start(ctx, "CreateTransaction")
+	defer func() { end(span, err) }()
+	return s.next.CreateTransaction(ctx, transaction)
+}
+
+func (s *tracedStore) GetPaymentByReferenceId(ctx context.Context, referenceId string) (transaction *models.Transaction, err error) {
+	ctx, span := s.start(ctx, "GetPaymentByReferenceId")
+	defer func() { end(span, err) }()
+	return s.next.GetPaymentByReferenceId(ctx, referenceId)
+}
+
+func (s *tracedStore) UpdateTransactionStatus(ctx context.Context, referenceId string, status models.TransactionStatus) (err error) {
+	ctx, span := s.start(ctx, "UpdateTransactionStatus")
+	defer func() { end(span, err) }()
+	return s.next.UpdateTransactionStatus(ctx, referenceId, status)
+}
+
+func (s *tracedStore) FailTransaction(ctx context.Context, referenceId, reason string, providerStatusCode int, failureKind string) (err error) {
+	ctx, span := s.start(ctx, "FailTransaction")
+	defer func() { end(span, err) }()
+	return s.next.FailTransaction(ctx, referenceId, reason, providerStatusCode, failureKind)
+}
+
+func (s *tracedStore) AdjustReversedAmount(ctx context.Context, referenceId string, amount models.Money) (transaction *models.Transaction, err error) {
+	ctx, span := s.start(ctx, "AdjustReversedAmount")
+	defer func() { end(span, err) }()
+	return s.next.AdjustReversedAmount(ctx, referenceId, amount)
+}
+
+func (s *tracedStore) CaptureHold(ctx context.Context, referenceId string, amount models.Money) (transaction *models.Transaction, err error) {
+	ctx, span := s.start(ctx, "CaptureHold")
+	defer func() { end(span, err) }()
+	return s.next.CaptureHold(ctx, referenceId, amount)
+}
+
+func (s *tracedStore) ReleaseHold(ctx context.Context, referenceId string, status models.TransactionStatus) (transaction *models.Transaction, err error) {
+	ctx, span := s.start(ctx, "ReleaseHold")
+	defer func() { end(span, err) }()
+	return s.next.ReleaseHold(ctx, referenceId, status)
+}
+
+func (s *tracedStore) GetExpiredHolds(ctx context.Context, expiredBy int64, after *models.TransactionCursor, limit int64) (transactions []models.Transaction, err error) {
+	ctx, span := s.start(ctx, "GetExpiredHolds")
+	defer func() { end(span, err) }()
+	return s.next.GetExpiredHolds(ctx, expiredBy, after, limit)
+}
+
+func (s *tracedStore) GetTransactionByIdempotencyKey(ctx context.Context, key string) (transaction *models.Transaction, err error) {
+	ctx, span := s.start(ctx, "GetTransactionByIdempotencyKey")
+	defer func() { end(span, err) }()
+	return s.next.GetTransactionByIdempotencyKey(ctx, key)
+}
+
+func (s *tracedStore) GetPendingTransactions(ctx context.Context, createdBefore int64, after *models.TransactionCursor, limit int64) (transactions []models.Transaction, err error) {
+	ctx, span := s.start(ctx, "GetPendingTransactions")
+	defer func() { end(span, err) }()
+	return s.next.GetPendingTransactions(ctx, createdBefore, after, limit)
+}
+
+func (s *tracedStore) ListTransactions(ctx context.Context, filter models.TransactionFilter) (transactions []models.Transaction, err error) {
+	ctx, span := s.start(ctx, "ListTransactions")
+	defer func() { end(span, err) }()
+	return s.next.ListTransactions(ctx, filter)
+}
+
+func (s *tracedStore) GetDebitTotals(ctx context.Context, accountId string, dayStart, monthStart int64) (totals *models.DebitTotals, err error) {
+	ctx, span := s.start(ctx, "GetDebitTotals")
+	defer func() { end(span, err) }()
+	return s.next.GetDebitTotals(ctx, accountId, dayStart, monthStart)
+}
+
+func (s *tracedStore) GetUserDebitTotals(ctx context.Context, userId, currency string, dayStart, monthStart int64) (totals *models.DebitTotals, err error) {
+	ctx, span := s.start(ctx, "GetUserDebitTotals")
+	defer func() { end(span, err) }()
+	return s.next.GetUserDebitTotals(ctx, userId, currency, dayStart, monthStart)
+}
+
+func (s *tracedStore) GetUserById(ctx context.Context, userId string) (user *models.User, err error) {
+	ctx, span := s.start(ctx, "GetUserById")
+	defer func() { end(span, err) }()
+	return s.next.GetUserById(ctx, userId)
+}
+
+func (s *tracedStore) LockUser(ctx context.Context, userId string) (user *models.User, err error) {
+	ctx, span := s.start(ctx, "LockUser")
+	defer func() { end(span, err) }()
+	return s.next.LockUser(ctx, userId)
+}
+
+func (s *tracedStore) CreateUser(ctx context.Context, user *models.User) (err error) {
+	ctx, span := s.start(ctx, "CreateUser")
+	defer func() { end(span, err) }()
+	return s.next.CreateUser(ctx, user)
+}
+
+func (s *tracedStore) CreateAccount(ctx context.Context, account *models.Account) (err error) {
+	ctx, span := s.start(ctx, "CreateAccount")
+	defer func() { end(span, err) }()
+	return s.next.CreateAccount(ctx, account)
+}
+
+func (s *tracedStore) SetUserTier(ctx context.Context, userId, tier string) (user *models.User, err error) {
+	ctx, span := s.start(ctx, "SetUserTier")
+	defer func() { end(span, err) }()
+	return s.next.SetUserTier(ctx, userId, tier)
+}
+
+func (s *tracedStore) GetUserAccounts(ctx context.Context, userId string) (accounts []models.Account, err error) {
+	ctx, span := s.start(ctx, "GetUserAccounts")
+	defer func() { end(span, err) }()
+	return s.next.GetUserAccounts(ctx, userId)
+}
+
+func (s *tracedStore) CloseAccount(ctx context.Context, accountId string) (account *models.Account, err error) {
+	ctx, span := s.start(ctx, "CloseAccount")
+	defer func() { end(span, err) }()
+	return s.next.CloseAccount(ctx, accountId)
+}
+
+func (s *tracedStore) SetAccountLimits(ctx context.Context, accountId string, limits *models.SpendingLimits) (account *models.Account, err error) {
+	ctx, span := s.start(ctx, "SetAccountLimits")
+	defer func() { end(span, err) }()
+	return s.next.SetAccountLimits(ctx, accountId, limits)
+}
+
+func (s *tracedStore) GetAccounts(ctx context.Context, after string, limit int64) (accounts []models.Account, err error) {
+	ctx, span := s.start(ctx, "GetAccounts")
+	defer func() { end(span, err) }()
+	return s.next.GetAccounts(ctx, after, limit)
+}
+
+func (s *tracedStore) CreateJournalEntry(ctx context.Context, entry *models.JournalEntry) (err error) {
+	ctx, span := s.start(ctx, "CreateJournalEntry")
+	defer func() { end(span, err) }()
+	return s.next.CreateJournalEntry(ctx, entry)
+}
+
+func (s *tracedStore) GetJournalEntries(ctx context.Context, after string, limit int64) (entries []models.JournalEntry, err error) {
+	ctx, span := s.start(ctx, "GetJournalEntries")
+	defer func() { end(span, err) }()
+	return s.next.GetJournalEntries(ctx, after, limit)
+}
+
+func (s *tracedStore) GetLedgerBalances(ctx context.Context, after, until string) (balances []models.LedgerBalance, err error) {
+	ctx, span := s.start(ctx, "GetLedgerBalances")
+	defer func() { end(span, err) }()
+	return s.next.GetLedgerBalances(ctx, after, until)
+}
+
+// WithTx spans the whole unit of work and keeps tracing the calls made inside it
+func (s *tracedStore) WithTx(ctx context.Context, fn func(store database.MongoDBStore) error) (err error) {
+	ctx, span := s.start(ctx, "WithTx")
+	defer func() { end(span, err) }()
+
+	return s.next.WithTx(ctx, func(store database.MongoDBStore) error {
+		return fn(&tracedStore{next: store, tracer: s.tracer})
+	})
+}
+
+func (s *tracedStore) Ping(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "Ping")
+	defer func() { end(span, err) }()
+	return s.next.Ping(ctx)
+}
@@ -0,0 +1,205 @@
+package tracing
+
+import (
+	"consumer-payment-service/client"
+	"consumer-payment-service/database"
+	"consumer-payment-service/environment"
+	"consumer-payment-service/mocks"
+	"consumer-payment-service/models"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/mock/gomock"
+)
+
+// newTestProvider returns a tracer provider keeping every ended span in memory
+func newTestProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), recorder
+}
+
+// spanNamed returns the ended span called name
+func spanNamed(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q", name)
+	return nil
+}
+
+func Test_Setup(t *testing.T) {
+	t.Run("Test tracing is a no-op without an OTLP endpoint", func(t *testing.T) {
+		shutdown, err := Setup(context.Background(), &environment.Config{ServiceName: "consumer-payment-service"})
+		assert.NoError(t, err)
+		assert.NoError(t, shutdown(context.Background()))
+		assert.ElementsMatch(t, []string{"traceparent", "tracestate", "baggage"}, otel.GetTextMapPropagator().Fields())
+	})
+}
+
+func Test_TraceStore(t *testing.T) {
+	testCases := []struct {
+		name           string
+		err            error
+		expectedStatus codes.Code
+	}{
+		{
+			name:           "Test successful call",
+			expectedStatus: codes.Unset,
+		},
+		{
+			name:           "Test failed call",
+			err:            errors.New("connection reset"),
+			expectedStatus: codes.Error,
+		},
+	}
+
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	mockDataStore := mocks.NewMockMongoDBStore(controller)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			provider, recorder := newTestProvider()
+			store := TraceStore(mockDataStore, provider)
+
+			mockDataStore.
+				EXPECT().
+				GetAccountByID(gomock.Any(), "acc_001").
+				Return(nil, testCase.err)
+
+			_, err := store.GetAccountByID(context.Background(), "acc_001")
+			assert.Equal(t, testCase.err, err)
+
+			span := spanNamed(t, recorder, "MongoDBStore.GetAccountByID")
+			assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+			assert.Equal(t, testCase.expectedStatus, span.Status().Code)
+			assert.Contains(t, span.Attributes(), semconv.DBSystemMongoDB)
+		})
+	}
+
+	t.Run("Test calls are children of the caller's span", func(t *testing.T) {
+		provider, recorder := newTestProvider()
+		store := TraceStore(mockDataStore, provider)
+
+		mockDataStore.
+			EXPECT().
+			WithTx(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(ctx context.Context, fn func(database.MongoDBStore) error) error {
+				return fn(mockDataStore)
+			})
+
+		mockDataStore.
+			EXPECT().
+			UpdateTransactionStatus(gomock.Any(), "ref-001", models.SUCCESS).
+			Return(nil)
+
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+		err := store.WithTx(ctx, func(store database.MongoDBStore) error {
+			return store.UpdateTransactionStatus(ctx, "ref-001", models.SUCCESS)
+		})
+		parent.End()
+		assert.NoError(t, err)
+
+		withTx := spanNamed(t, recorder, "MongoDBStore.WithTx")
+		update := spanNamed(t, recorder, "MongoDBStore.UpdateTransactionStatus")
+		assert.Equal(t, parent.SpanContext().SpanID(), withTx.Parent().SpanID())
+		assert.Equal(t, parent.SpanContext().SpanID(), update.Parent().SpanID())
+		assert.Equal(t, parent.SpanContext().TraceID(), update.SpanContext().TraceID())
+	})
+}
+
+func Test_TraceClient(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"account_id":"acc_001","reference":"ref-001","amount":10.00,"status":"SUCCESS"}`))
+	}))
+	defer provider.Close()
+
+	tracerProvider, recorder := newTestProvider()
+
+	cfg := &environment.Config{THIRD_PARTY_SERVICE_BASE_URL: provider.URL}
+	paymentClient := TraceClient(client.NewPaymentAPIClientWithHTTPClient(cfg, &http.Client{
+		Transport: Transport(http.DefaultTransport, tracerProvider),
+	}), tracerProvider)
+
+	_, err := paymentClient.MakeDeposit(context.Background(), "acc_001", "ref-001", models.Money{Minor: 1000, Currency: "USD"})
+	assert.NoError(t, err)
+
+	deposit := spanNamed(t, recorder, "ThirdPartyAPIClient.MakeDeposit")
+	request := spanNamed(t, recorder, "HTTP POST")
+	assert.Equal(t, deposit.SpanContext().SpanID(), request.Parent().SpanID())
+	assert.Equal(t, trace.SpanKindClient, request.SpanKind())
+
+	// the provider continues the trace from the HTTP client span
+	assert.Equal(t, "00-"+request.SpanContext().TraceID().String()+"-"+request.SpanContext().SpanID().String()+"-01", traceparent)
+}
+
+func Test_Middleware(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	testCases := []struct {
+		name           string
+		statusCode     int
+		expectedStatus codes.Code
+	}{
+		{
+			name:           "Test successful request",
+			statusCode:     http.StatusOK,
+			expectedStatus: codes.Unset,
+		},
+		{
+			name:           "Test rejected request",
+			statusCode:     http.StatusUnprocessableEntity,
+			expectedStatus: codes.Unset,
+		},
+		{
+			name:           "Test failed request",
+			statusCode:     http.StatusBadGateway,
+			expectedStatus: codes.Error,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			provider, recorder := newTestProvider()
+
+			var handlerSpan trace.SpanContext
+			router := chi.NewRouter()
+			router.Use(Middleware(provider))
+			router.Get("/payments/{reference}", func(w http.ResponseWriter, r *http.Request) {
+				handlerSpan = trace.SpanContextFromContext(r.Context())
+				w.WriteHeader(testCase.statusCode)
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/payments/ref-001", nil)
+			request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			router.ServeHTTP(httptest.NewRecorder(), request)
+
+			span := spanNamed(t, recorder, "GET /payments/{reference}")
+			assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+			assert.Equal(t, testCase.expectedStatus, span.Status().Code)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+			assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+			assert.Equal(t, span.SpanContext().SpanID(), handlerSpan.SpanID())
+		})
+	}
+}